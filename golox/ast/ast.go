@@ -13,7 +13,8 @@ type Node interface {
 
 // Program is the root node of the AST.
 type Program struct {
-	Stmts []Stmt `print:"unnamed"`
+	Stmts    []Stmt        `print:"unnamed"`
+	Comments []token.Token // Comments in the order that they appear in the source code
 }
 
 func (p Program) Start() token.Position { return p.Stmts[0].Start() }
@@ -56,7 +57,7 @@ func (d FunDecl) End() token.Position   { return d.RightBrace.End }
 
 // ClassDecl is a class declaration, such as
 //
-//	class Foo {
+//	class Foo < Bar {
 //	  bar() {
 //	    return "baz";
 //	  }
@@ -64,6 +65,7 @@ func (d FunDecl) End() token.Position   { return d.RightBrace.End }
 type ClassDecl struct {
 	Class      token.Token
 	Name       token.Token  `print:"named"`
+	Superclass Expr         `print:"named"`
 	Body       []MethodDecl `print:"named"`
 	RightBrace token.Token
 	stmt
@@ -88,6 +90,18 @@ type MethodDecl struct {
 func (m MethodDecl) Start() token.Position { return m.Name.Start }
 func (m MethodDecl) End() token.Position   { return m.RightBrace.End }
 
+// ImportDecl is an import declaration, such as import "path/to/mod.lox" as mod.
+type ImportDecl struct {
+	Import    token.Token
+	Path      token.Token `print:"named"`
+	Alias     token.Token `print:"named"`
+	Semicolon token.Token
+	stmt
+}
+
+func (d ImportDecl) Start() token.Position { return d.Import.Start }
+func (d ImportDecl) End() token.Position   { return d.Semicolon.End }
+
 // ExprStmt is an expression statement, such as a function call.
 type ExprStmt struct {
 	Expr      Expr `print:"unnamed"`
@@ -142,7 +156,12 @@ type IfStmt struct {
 }
 
 func (i IfStmt) Start() token.Position { return i.If.Start }
-func (i IfStmt) End() token.Position   { return i.Else.End() }
+func (i IfStmt) End() token.Position {
+	if i.Else != nil {
+		return i.Else.End()
+	}
+	return i.Then.End()
+}
 
 // WhileStmt is a while statement, such as
 //
@@ -216,6 +235,49 @@ type ReturnStmt struct {
 func (c ReturnStmt) Start() token.Position { return c.Return.Start }
 func (c ReturnStmt) End() token.Position   { return c.Semicolon.End }
 
+// ThrowStmt is a throw statement, such as throw Error("abc").
+type ThrowStmt struct {
+	Throw     token.Token
+	Value     Expr `print:"unnamed"`
+	Semicolon token.Token
+	stmt
+}
+
+func (t ThrowStmt) Start() token.Position { return t.Throw.Start }
+func (t ThrowStmt) End() token.Position   { return t.Semicolon.End }
+
+// TryStmt is a try statement, such as
+//
+//	try {
+//	    print 1 / 0;
+//	} catch (e) {
+//	    print e.message;
+//	} finally {
+//	    print "done";
+//	}
+//
+// At least one of CatchBody and FinallyBody is set.
+type TryStmt struct {
+	Try         token.Token
+	Body        BlockStmt   `print:"named"`
+	CatchIdent  token.Token `print:"named"`
+	CatchBody   Stmt        `print:"named"` // BlockStmt or nil
+	FinallyBody Stmt        `print:"named"` // BlockStmt or nil
+	stmt
+}
+
+func (t TryStmt) Start() token.Position { return t.Try.Start }
+func (t TryStmt) End() token.Position {
+	switch {
+	case t.FinallyBody != nil:
+		return t.FinallyBody.End()
+	case t.CatchBody != nil:
+		return t.CatchBody.End()
+	default:
+		return t.Body.End()
+	}
+}
+
 // Expr is the interface which all expression nodes implement.
 type Expr interface {
 	Node
@@ -258,6 +320,47 @@ type LiteralExpr struct {
 func (l LiteralExpr) Start() token.Position { return l.Value.Start }
 func (l LiteralExpr) End() token.Position   { return l.Value.End }
 
+// InterpolationExpr is an interpolated string expression, such as "a ${b} c". Parts contains the literal segments of the
+// string, which are [LiteralExpr]s, interleaved with the interpolated expressions.
+type InterpolationExpr struct {
+	Parts []Expr `print:"unnamed"`
+	expr
+}
+
+func (i InterpolationExpr) Start() token.Position { return i.Parts[0].Start() }
+func (i InterpolationExpr) End() token.Position   { return i.Parts[len(i.Parts)-1].End() }
+
+// ListExpr is a list expression, such as [1, 2, 3].
+type ListExpr struct {
+	LeftBracket  token.Token
+	Elements     []Expr `print:"unnamed"`
+	RightBracket token.Token
+	expr
+}
+
+func (l ListExpr) Start() token.Position { return l.LeftBracket.Start }
+func (l ListExpr) End() token.Position   { return l.RightBracket.End }
+
+// MapExpr is a map expression, such as {"a": 1, "b": 2}.
+type MapExpr struct {
+	LeftBrace  token.Token
+	Entries    []MapEntry `print:"unnamed"`
+	RightBrace token.Token
+	expr
+}
+
+func (m MapExpr) Start() token.Position { return m.LeftBrace.Start }
+func (m MapExpr) End() token.Position   { return m.RightBrace.End }
+
+// MapEntry is a key-value pair in a map expression, such as "a": 1.
+type MapEntry struct {
+	Key   Expr `print:"named"`
+	Value Expr `print:"named"`
+}
+
+func (m MapEntry) Start() token.Position { return m.Key.Start() }
+func (m MapEntry) End() token.Position   { return m.Value.End() }
+
 // VariableExpr is a variable expression, such as a or b.
 type VariableExpr struct {
 	Name token.Token
@@ -276,6 +379,16 @@ type ThisExpr struct {
 func (t ThisExpr) Start() token.Position { return t.This.Start }
 func (t ThisExpr) End() token.Position   { return t.This.End }
 
+// SuperExpr is a superclass method access expression, such as super.foo.
+type SuperExpr struct {
+	Super  token.Token
+	Method token.Token `print:"named"`
+	expr
+}
+
+func (s SuperExpr) Start() token.Position { return s.Super.Start }
+func (s SuperExpr) End() token.Position   { return s.Method.End }
+
 // CallExpr is a call expression, such as add(x, 1).
 type CallExpr struct {
 	Callee     Expr   `print:"named"`
@@ -297,6 +410,29 @@ type GetExpr struct {
 func (g GetExpr) Start() token.Position { return g.Object.Start() }
 func (g GetExpr) End() token.Position   { return g.Name.End }
 
+// IndexExpr is an index expression, such as a[0] or b["c"].
+type IndexExpr struct {
+	Object       Expr `print:"named"`
+	Index        Expr `print:"named"`
+	RightBracket token.Token
+	expr
+}
+
+func (i IndexExpr) Start() token.Position { return i.Object.Start() }
+func (i IndexExpr) End() token.Position   { return i.RightBracket.End }
+
+// SliceExpr is a slice expression, such as a[1:3], a[1:] or a[:3].
+type SliceExpr struct {
+	Object       Expr `print:"named"`
+	Low          Expr `print:"named"`
+	High         Expr `print:"named"`
+	RightBracket token.Token
+	expr
+}
+
+func (s SliceExpr) Start() token.Position { return s.Object.Start() }
+func (s SliceExpr) End() token.Position   { return s.RightBracket.End }
+
 // UnaryExpr is a unary operator expression, such as !a.
 type UnaryExpr struct {
 	Op    token.Token `print:"named"`
@@ -349,3 +485,14 @@ type SetExpr struct {
 
 func (s SetExpr) Start() token.Position { return s.Object.Start() }
 func (s SetExpr) End() token.Position   { return s.Value.End() }
+
+// IndexSetExpr is an index assignment expression, such as a[0] = 2 or b["c"] = 3.
+type IndexSetExpr struct {
+	Object Expr `print:"named"`
+	Index  Expr `print:"named"`
+	Value  Expr `print:"named"`
+	expr
+}
+
+func (i IndexSetExpr) Start() token.Position { return i.Object.Start() }
+func (i IndexSetExpr) End() token.Position   { return i.Value.End() }
@@ -70,7 +70,8 @@ func sprint(node Node, depth int) string {
 			prefix = field.Name + ": "
 		}
 
-		if value.Kind() == reflect.Interface && value.IsNil() {
+		// Optional fields which aren't set are omitted.
+		if value.IsZero() {
 			continue
 		}
 
@@ -0,0 +1,137 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// request is a request which is sent by the client.
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// response is the server's response to a request. Message is the error message of an unsuccessful response.
+type response struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+// event is an event which is sent by the server.
+type event struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+// requestError is the error which is returned by a handler when a request fails.
+type requestError struct {
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func newRequestError(format string, args ...any) *requestError {
+	return &requestError{message: fmt.Sprintf(format, args...)}
+}
+
+// conn reads and writes Debug Adapter Protocol messages which are framed by a header containing their length, as
+// described in https://microsoft.github.io/debug-adapter-protocol/overview#base-protocol.
+// Messages can be written from multiple goroutines.
+type conn struct {
+	r *textproto.Reader
+
+	mu  sync.Mutex
+	w   io.Writer
+	seq int // sequence number of the last message which was written
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+// Read reads the next request. io.EOF is returned if there are no more requests.
+func (c *conn) Read() (*request, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading message header: %s", err)
+	}
+	lengthStr := header.Get("Content-Length")
+	if lengthStr == "" {
+		return nil, errors.New("reading message header: Content-Length is missing")
+	}
+	length, err := strconv.Atoi(lengthStr)
+	if err != nil {
+		return nil, fmt.Errorf("reading message header: invalid Content-Length: %s", err)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, content); err != nil {
+		return nil, fmt.Errorf("reading message content: %s", err)
+	}
+	req := &request{}
+	if err := json.Unmarshal(content, req); err != nil {
+		return nil, fmt.Errorf("parsing message: %s", err)
+	}
+	return req, nil
+}
+
+// WriteResponse writes the response to a request. If err is non-nil, then the response is unsuccessful and err is its
+// message.
+func (c *conn) WriteResponse(req *request, body any, err error) error {
+	resp := &response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+		resp.Body = nil
+	}
+	return c.write(func(seq int) any {
+		resp.Seq = seq
+		return resp
+	})
+}
+
+// WriteEvent writes an event with the given body, which can be nil.
+func (c *conn) WriteEvent(name string, body any) error {
+	return c.write(func(seq int) any {
+		return &event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// write writes the message which is returned by newMsg when it's passed the message's sequence number.
+func (c *conn) write(newMsg func(seq int) any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	content, err := json.Marshal(newMsg(c.seq))
+	if err != nil {
+		return fmt.Errorf("writing message: %s", err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		return fmt.Errorf("writing message: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+// Package dap implements a Debug Adapter Protocol server for Lox, which lets editors drive the debugger of the
+// tree-walking interpreter. The server supports launching a program, breakpoints, stepping, inspecting the call stack
+// and the variables in each scope of a call frame, and evaluating expressions.
+// See https://microsoft.github.io/debug-adapter-protocol/ for details of the protocol.
+package dap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/interpreter"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/parser"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// threadID is the ID of the only thread, since Lox programs are single-threaded.
+const threadID = 1
+
+// resumeCommands are the debugger commands which are given by the requests which resume a paused program.
+var resumeCommands = map[string]interpreter.Command{
+	"continue": interpreter.CommandContinue,
+	"next":     interpreter.CommandStepOver,
+	"stepIn":   interpreter.CommandStepIn,
+	"stepOut":  interpreter.CommandStepOut,
+}
+
+// Serve runs a debug adapter which reads requests from r and writes responses and events to w until the client sends
+// the disconnect request or closes r. The program which is launched by the client is run once the client has finished
+// configuring it, and anything that it prints is sent to the client in output events.
+func Serve(r io.Reader, w io.Writer) error {
+	s := &server{
+		conn:     newConn(r, w),
+		commands: make(chan interpreter.Command),
+	}
+	s.debugger = interpreter.NewDebugger(s.handlePause)
+	return s.serve()
+}
+
+type server struct {
+	conn        *conn
+	debugger    *interpreter.Debugger
+	program     *ast.Program // program which has been launched, or nil if the launch request hasn't been received
+	noDebug     bool
+	stopOnEntry bool // whether the program is yet to pause before its first statement
+	configured  bool // whether the configurationDone request has been received
+	started     bool
+	commands    chan interpreter.Command // commands which resume the paused program
+
+	mu             sync.Mutex
+	pause          *interpreter.Pause // nil if the program isn't paused
+	variablesByRef map[int]func() []interpreter.Variable
+}
+
+func (s *server) serve() error {
+	for {
+		req, err := s.conn.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			// The server doesn't send any requests, so there shouldn't be any responses.
+			continue
+		}
+
+		body, err := s.handleRequest(req)
+		var reqErr *requestError
+		if err != nil && !errors.As(err, &reqErr) {
+			return err
+		}
+		if err := s.conn.WriteResponse(req, body, err); err != nil {
+			return err
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+		if err == nil {
+			if err := s.afterResponse(req); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleRequest handles a request and returns the body of its response. If the request failed, then a
+// [*requestError] is returned. Any other error is fatal.
+func (s *server) handleRequest(req *request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		return capabilities{SupportsConfigurationDoneRequest: true, SupportsEvaluateForHovers: true}, nil
+	case "launch":
+		return handle(req, s.launch)
+	case "setBreakpoints":
+		return handle(req, s.setBreakpoints)
+	case "configurationDone":
+		s.configured = true
+		return nil, nil
+	case "threads":
+		return threadsResponseBody{Threads: []thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		return handle(req, s.stackTrace)
+	case "scopes":
+		return handle(req, s.scopes)
+	case "variables":
+		return handle(req, s.variables)
+	case "evaluate":
+		return handle(req, s.evaluate)
+	case "continue", "next", "stepIn", "stepOut":
+		return s.resume(req.Command)
+	case "pause":
+		s.debugger.RequestPause()
+		return nil, nil
+	case "disconnect":
+		return nil, nil
+	default:
+		return nil, newRequestError("unsupported command: %s", req.Command)
+	}
+}
+
+// handle unmarshals the arguments of a request and calls a handler with them.
+func handle[A any, B any](req *request, handler func(*A) (B, error)) (any, error) {
+	args := new(A)
+	if len(req.Arguments) > 0 {
+		if err := json.Unmarshal(req.Arguments, args); err != nil {
+			return nil, newRequestError("invalid %s arguments: %s", req.Command, err)
+		}
+	}
+	return handler(args)
+}
+
+// afterResponse performs the actions which have to wait until a successful response to a request has been sent.
+func (s *server) afterResponse(req *request) error {
+	switch req.Command {
+	case "initialize":
+		return s.conn.WriteEvent("initialized", nil)
+	case "launch", "configurationDone":
+		if s.program != nil && s.configured && !s.started {
+			s.started = true
+			go s.run()
+		}
+	default:
+		if cmd, ok := resumeCommands[req.Command]; ok {
+			s.commands <- cmd
+		}
+	}
+	return nil
+}
+
+func (s *server) launch(args *launchArguments) (any, error) {
+	if s.program != nil {
+		return nil, newRequestError("a program has already been launched")
+	}
+	if args.Program == "" {
+		return nil, newRequestError("program to launch must be specified")
+	}
+	f, err := os.Open(args.Program)
+	if err != nil {
+		return nil, newRequestError("%s", err)
+	}
+	defer f.Close()
+	program, err := parser.Parse(f)
+	if err != nil {
+		return nil, newRequestError("%s", err)
+	}
+	s.program = &program
+	s.noDebug = args.NoDebug
+	s.stopOnEntry = args.StopOnEntry && !args.NoDebug
+	if s.stopOnEntry {
+		s.debugger.RequestPause()
+	}
+	return nil, nil
+}
+
+func (s *server) setBreakpoints(args *setBreakpointsArguments) (*setBreakpointsResponseBody, error) {
+	lines := make([]int, len(args.Breakpoints))
+	breakpoints := make([]breakpoint, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		lines[i] = bp.Line
+		breakpoints[i] = breakpoint{Verified: true, Line: bp.Line}
+	}
+	s.debugger.SetBreakpoints(args.Source.Path, lines)
+	return &setBreakpointsResponseBody{Breakpoints: breakpoints}, nil
+}
+
+func (s *server) stackTrace(args *stackTraceArguments) (*stackTraceResponseBody, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pause == nil {
+		return nil, newRequestError("program is not paused")
+	}
+	frames := s.pause.Frames
+	start := min(max(args.StartFrame, 0), len(frames))
+	end := len(frames)
+	if args.Levels > 0 {
+		end = min(start+args.Levels, end)
+	}
+	stackFrames := make([]stackFrame, 0, end-start)
+	for i := start; i < end; i++ {
+		frame := frames[i]
+		stackFrame := stackFrame{ID: i + 1, Name: frame.Name}
+		if pos := frame.Pos; pos.File != nil {
+			stackFrame.Source = newSource(pos.File)
+			stackFrame.Line = pos.Line
+			stackFrame.Column = utf16Column(pos)
+		}
+		stackFrames = append(stackFrames, stackFrame)
+	}
+	return &stackTraceResponseBody{StackFrames: stackFrames, TotalFrames: len(frames)}, nil
+}
+
+func newSource(file *token.File) *source {
+	path := file.Name
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return &source{Name: filepath.Base(path), Path: path}
+}
+
+// utf16Column returns the 1-based column of a position, measured in UTF-16 code units.
+func utf16Column(pos token.Position) int {
+	line := pos.File.Line(pos.Line)
+	return len(utf16.Encode([]rune(string(line[:pos.Column])))) + 1
+}
+
+// frame returns the frame of the paused program with the given ID. s.mu must be held.
+func (s *server) frame(id int) (*interpreter.Frame, error) {
+	if s.pause == nil {
+		return nil, newRequestError("program is not paused")
+	}
+	if id < 1 || id > len(s.pause.Frames) {
+		return nil, newRequestError("invalid frame ID: %d", id)
+	}
+	return s.pause.Frames[id-1], nil
+}
+
+// newVariablesReference returns a reference which the client can use to request the variables which are returned by
+// variables. References are only valid until the program is resumed. s.mu must be held.
+func (s *server) newVariablesReference(variables func() []interpreter.Variable) int {
+	ref := len(s.variablesByRef) + 1
+	s.variablesByRef[ref] = variables
+	return ref
+}
+
+func (s *server) scopes(args *scopesArguments) (*scopesResponseBody, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	scopes := []scope{}
+	for _, sc := range frame.Scopes() {
+		scope := scope{
+			Name:               sc.Name,
+			VariablesReference: s.newVariablesReference(func() []interpreter.Variable { return sc.Variables }),
+		}
+		if sc.Name == "Locals" {
+			scope.PresentationHint = "locals"
+		}
+		scopes = append(scopes, scope)
+	}
+	return &scopesResponseBody{Scopes: scopes}, nil
+}
+
+func (s *server) variables(args *variablesArguments) (*variablesResponseBody, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	getVariables, ok := s.variablesByRef[args.VariablesReference]
+	if !ok {
+		return nil, newRequestError("invalid variables reference: %d", args.VariablesReference)
+	}
+	variables := []variable{}
+	for _, v := range getVariables() {
+		variable := variable{Name: v.Name, Value: v.Value, Type: v.Type}
+		if v.HasChildren() {
+			variable.VariablesReference = s.newVariablesReference(v.Children)
+		}
+		variables = append(variables, variable)
+	}
+	return &variablesResponseBody{Variables: variables}, nil
+}
+
+// evaluate evaluates an expression in a frame of the paused program. If a frame isn't specified, then the innermost
+// frame is used.
+func (s *server) evaluate(args *evaluateArguments) (*evaluateResponseBody, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := args.FrameID
+	if id == 0 {
+		id = 1
+	}
+	frame, err := s.frame(id)
+	if err != nil {
+		return nil, err
+	}
+	result, err := frame.Eval(args.Expression)
+	if err != nil {
+		return nil, newRequestError("%s", errorMessage(err))
+	}
+	return &evaluateResponseBody{Result: result}, nil
+}
+
+// errorMessage returns the messages of the Lox errors which make up an error returned by [*interpreter.Frame.Eval],
+// without the source code that they refer to, since that's just the expression which was evaluated.
+func errorMessage(err error) string {
+	var errs []error
+	if joinedErr, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joinedErr.Unwrap()
+	} else {
+		errs = []error{err}
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+		var loxErr *lox.Error
+		if errors.As(err, &loxErr) {
+			msgs[i] = loxErr.Message()
+		}
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// resume checks that the program can be resumed by a continue or stepping request and returns the body of the
+// response. The program is resumed once the response has been sent.
+func (s *server) resume(command string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pause == nil {
+		return nil, newRequestError("program is not paused")
+	}
+	s.pause = nil
+	s.variablesByRef = nil
+	if command == "continue" {
+		return continueResponseBody{AllThreadsContinued: true}, nil
+	}
+	return nil, nil
+}
+
+// handlePause is called by the debugger when the program pauses. It tells the client that the program has stopped
+// and then waits for the client to resume it.
+func (s *server) handlePause(pause *interpreter.Pause) interpreter.Command {
+	reason := pause.Reason.String()
+	if s.stopOnEntry {
+		s.stopOnEntry = false
+		reason = "entry"
+	}
+	s.mu.Lock()
+	s.pause = pause
+	s.variablesByRef = map[int]func() []interpreter.Variable{}
+	s.mu.Unlock()
+	// If the client has gone away, then the main loop will return when it fails to read the next request.
+	_ = s.conn.WriteEvent("stopped", stoppedEventBody{Reason: reason, ThreadID: threadID, AllThreadsStopped: true})
+	return <-s.commands
+}
+
+// run runs the launched program and tells the client when it has finished.
+func (s *server) run() {
+	opts := []interpreter.Option{
+		interpreter.Stdout(outputWriter{server: s, category: "stdout"}),
+		interpreter.Stderr(outputWriter{server: s, category: "stderr"}),
+		// Standard input carries the protocol messages, so the program can't read from it.
+		interpreter.Stdin(strings.NewReader("")),
+	}
+	if !s.noDebug {
+		opts = append(opts, interpreter.Debug(s.debugger))
+	}
+	interp := interpreter.New(opts...)
+	err := interp.Interpret(*s.program)
+	var exitErr *lox.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		fmt.Fprintln(interp.Stderr(), err)
+	}
+	_ = s.conn.WriteEvent("exited", exitedEventBody{ExitCode: lox.ExitCode(err)})
+	_ = s.conn.WriteEvent("terminated", nil)
+}
+
+// outputWriter sends anything that's written to it to the client in output events of the given category.
+type outputWriter struct {
+	server   *server
+	category string
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.server.writeOutput(w.category, string(p))
+	return len(p), nil
+}
+
+func (s *server) writeOutput(category string, output string) {
+	_ = s.conn.WriteEvent("output", outputEventBody{Category: category, Output: output})
+}
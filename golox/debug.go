@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/marcuscaisey/lox/golox/interpreter"
+)
+
+const debugHelp = `Commands:
+  break [file:]line    Set a breakpoint (alias b)
+  clear [file:]line    Clear a breakpoint
+  continue             Continue until the next breakpoint (alias c)
+  step                 Step to the next statement, entering any function which is called (alias s)
+  next                 Step to the next statement in the current function (alias n)
+  out                  Step out of the current function (alias o)
+  backtrace            Display the call stack (alias bt)
+  frame n              Select the frame with number n in the call stack (alias f)
+  locals               Display the variables which are in scope in the selected frame (alias l)
+  print expr           Evaluate an expression in the selected frame (alias p)
+  help                 Display this help (alias h)
+  quit                 Stop debugging and exit (alias q)
+An empty line repeats the previous command.`
+
+// debugger is an interactive debugger which reads commands from stdin and writes its output to stderr, so that it
+// doesn't get mixed up with the output of the program.
+type debugger struct {
+	*interpreter.Debugger
+	in       *bufio.Scanner
+	out      io.Writer
+	detached bool   // whether stdin has been closed, after which the program runs without pausing
+	prevLine string // previous command, which is repeated when an empty line is entered
+}
+
+// newDebugger returns a debugger which pauses before the first statement of the program is executed, so that
+// breakpoints can be set.
+func newDebugger() *debugger {
+	d := &debugger{
+		in:  bufio.NewScanner(os.Stdin),
+		out: os.Stderr,
+	}
+	d.Debugger = interpreter.NewDebugger(d.handlePause)
+	d.RequestPause()
+	return d
+}
+
+func (d *debugger) handlePause(pause *interpreter.Pause) interpreter.Command {
+	if d.detached {
+		return interpreter.CommandContinue
+	}
+	fmt.Fprintf(d.out, "Paused at %s (%s)\n", pause.Frames[0].Pos, pause.Reason)
+	d.printFrame(pause.Frames[0])
+
+	selected := 0
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			d.detached = true
+			return interpreter.CommandContinue
+		}
+		line := strings.TrimSpace(d.in.Text())
+		if line == "" {
+			line = d.prevLine
+		}
+		d.prevLine = line
+		cmd, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		frame := pause.Frames[selected]
+
+		switch cmd {
+		case "":
+		case "c", "continue":
+			return interpreter.CommandContinue
+		case "s", "step":
+			return interpreter.CommandStepIn
+		case "n", "next":
+			return interpreter.CommandStepOver
+		case "o", "out":
+			return interpreter.CommandStepOut
+		case "b", "break":
+			path, lineNum, err := parseLocation(arg, frame)
+			if err != nil {
+				fmt.Fprintln(d.out, err)
+				continue
+			}
+			d.SetBreakpoint(path, lineNum)
+			fmt.Fprintf(d.out, "Breakpoint set at %s:%d\n", path, lineNum)
+		case "clear":
+			path, lineNum, err := parseLocation(arg, frame)
+			if err != nil {
+				fmt.Fprintln(d.out, err)
+				continue
+			}
+			if d.ClearBreakpoint(path, lineNum) {
+				fmt.Fprintf(d.out, "Breakpoint cleared at %s:%d\n", path, lineNum)
+			} else {
+				fmt.Fprintf(d.out, "No breakpoint at %s:%d\n", path, lineNum)
+			}
+		case "bt", "backtrace":
+			for n, frame := range pause.Frames {
+				marker := " "
+				if n == selected {
+					marker = "*"
+				}
+				fmt.Fprintf(d.out, "%s #%d %s at %s\n", marker, n, frame.Name, frame.Pos)
+			}
+		case "f", "frame":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 || n >= len(pause.Frames) {
+				fmt.Fprintf(d.out, "frame number must be between 0 and %d\n", len(pause.Frames)-1)
+				continue
+			}
+			selected = n
+			fmt.Fprintf(d.out, "#%d %s at %s\n", n, pause.Frames[n].Name, pause.Frames[n].Pos)
+			d.printFrame(pause.Frames[n])
+		case "l", "locals":
+			fmt.Fprintln(d.out, frame.Locals())
+		case "p", "print":
+			result, err := frame.Eval(arg)
+			if err != nil {
+				fmt.Fprintln(d.out, err)
+				continue
+			}
+			fmt.Fprintln(d.out, result)
+		case "h", "help":
+			fmt.Fprintln(d.out, debugHelp)
+		case "q", "quit":
+			os.Exit(0)
+		default:
+			fmt.Fprintf(d.out, "unknown command %q, type help for a list of commands\n", cmd)
+		}
+	}
+}
+
+// printFrame prints the line of source code which a frame is executing.
+func (d *debugger) printFrame(frame *interpreter.Frame) {
+	if frame.Pos.File == nil {
+		return
+	}
+	fmt.Fprintf(d.out, "%5d | %s\n", frame.Pos.Line, frame.Pos.File.Line(frame.Pos.Line))
+}
+
+// parseLocation parses a breakpoint location of the form [file:]line. If the file is omitted, then the file which the
+// frame is executing is used.
+func parseLocation(loc string, frame *interpreter.Frame) (path string, line int, err error) {
+	lineStr := loc
+	if i := strings.LastIndex(loc, ":"); i != -1 {
+		path, lineStr = loc[:i], loc[i+1:]
+	} else if frame.Pos.File != nil {
+		path = frame.Pos.File.Name
+	}
+	line, err = strconv.Atoi(lineStr)
+	if err != nil || line < 1 {
+		return "", 0, fmt.Errorf("invalid breakpoint location %q, expected [file:]line", loc)
+	}
+	return path, line, nil
+}
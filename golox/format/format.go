@@ -0,0 +1,545 @@
+// Package format implements formatting of Lox source code in a canonical style.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/parser"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+const indentation = "  "
+
+// Format formats the Lox source code read from r. Comments are preserved, as are single blank lines between
+// statements. An error is returned if the source code can't be parsed.
+//
+// Formatting is idempotent: formatting the output of Format again produces the same output.
+func Format(r io.Reader) ([]byte, error) {
+	program, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return Program(program), nil
+}
+
+// Program formats a program which was parsed without error.
+func Program(program ast.Program) []byte {
+	p := &printer{comments: program.Comments}
+	p.stmts(program.Stmts, token.Position{Line: -1})
+	if p.buf.Len() > 0 {
+		p.buf.WriteByte('\n')
+	}
+	return p.buf.Bytes()
+}
+
+// printer prints the AST of a program as source code.
+//
+// Comments aren't part of the AST, so they're printed in between the nodes which surround them. Before each node is
+// printed, the comments which come before it in the source code are printed first. Comments on their own line or lines
+// are kept on their own line and comments which follow a statement on the same line are kept at the end of the line.
+// Comments which appear inside a statement are printed immediately before the next token in the statement whose
+// position is known, unless they're followed by a comma, closing parenthesis, or semicolon, in which case they're
+// printed immediately after the token before them.
+type printer struct {
+	buf      bytes.Buffer
+	indent   int
+	comments []token.Token // comments which haven't been printed yet
+
+	// atLineStart is true if a newline has just been written and the indentation of the following line hasn't been
+	// written yet. The indentation is written lazily so that blank lines don't contain any whitespace.
+	atLineStart bool
+	lastLine    int // last line of the source code which has been printed
+}
+
+// write writes text to the output, preceded by the indentation of the current line if nothing has been written to it
+// yet.
+func (p *printer) write(s string) {
+	if p.atLineStart {
+		p.buf.WriteString(strings.Repeat(indentation, p.indent))
+		p.atLineStart = false
+	}
+	p.buf.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+	p.atLineStart = true
+}
+
+func (p *printer) blankLine() {
+	p.buf.WriteByte('\n')
+}
+
+// tok writes a token, preceded by any comments which come before it.
+func (p *printer) tok(tok token.Token) {
+	for len(p.comments) > 0 && p.comments[0].Start.Compare(tok.Start) < 0 {
+		p.inlineComment(p.popComment())
+	}
+	p.write(tok.Lexeme)
+	p.lastLine = tok.End.Line
+	p.attachedComments(tok.End)
+}
+
+// attachedComments prints the block comments which follow the token ending at end on the same line, if they're followed
+// by a comma, closing parenthesis, or semicolon. These aren't separate tokens in the AST, so the comments would
+// otherwise be printed after them, before the next token.
+func (p *printer) attachedComments(end token.Position) {
+	line := end.File.Line(end.Line)
+	n := 0
+	for prevEnd := end; n < len(p.comments); n++ {
+		comment := p.comments[n]
+		if isLineComment(comment) || comment.Start.Line != end.Line || comment.End.Line != end.Line ||
+			len(bytes.TrimSpace(line[prevEnd.Column:comment.Start.Column])) > 0 {
+			break
+		}
+		prevEnd = comment.End
+	}
+	if n == 0 {
+		return
+	}
+	rest := bytes.TrimLeft(line[p.comments[n-1].End.Column:], " \t")
+	if len(rest) == 0 || !bytes.ContainsRune([]byte(",);"), rune(rest[0])) {
+		return
+	}
+	for range n {
+		p.write(" ")
+		p.write(commentText(p.popComment()))
+	}
+}
+
+// inlineComment writes a comment in the middle of a line, followed by a space or a newline depending on whether it's
+// a single-line or multi-line comment.
+func (p *printer) inlineComment(comment token.Token) {
+	if b := p.buf.Bytes(); !p.atLineStart && len(b) > 0 && b[len(b)-1] != ' ' {
+		p.write(" ")
+	}
+	p.write(commentText(comment))
+	if isLineComment(comment) {
+		// The rest of the line is indented to show that it's a continuation of the previous one.
+		p.newline()
+		p.write(indentation)
+	} else {
+		p.write(" ")
+	}
+}
+
+func (p *printer) popComment() token.Token {
+	comment := p.comments[0]
+	p.comments = p.comments[1:]
+	p.lastLine = comment.End.Line
+	return comment
+}
+
+func isLineComment(comment token.Token) bool {
+	return strings.HasPrefix(comment.Lexeme, "//")
+}
+
+func commentText(comment token.Token) string {
+	if isLineComment(comment) {
+		return strings.TrimRightFunc(comment.Lexeme, isSpace)
+	}
+	return comment.Lexeme
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+// stmts prints a list of statements with each one on its own line, followed by any comments which come before end.
+// If end has a negative line number, then all of the remaining comments are printed.
+// A blank line is printed between two statements or comments if there's at least one blank line between them in the
+// source code.
+func (p *printer) stmts(stmts []ast.Stmt, end token.Position) {
+	first := true
+	beginLine := func(line int) {
+		if !first {
+			p.newline()
+			if line > p.lastLine+1 {
+				p.blankLine()
+			}
+		}
+		first = false
+	}
+
+	for i, stmt := range stmts {
+		start := stmtStart(stmt)
+		sameLine := false
+		for len(p.comments) > 0 && p.comments[0].Start.Compare(start) < 0 {
+			comment := p.comments[0]
+			if !sameLine {
+				beginLine(comment.Start.Line)
+			}
+			p.write(commentText(p.popComment()))
+			// A multi-line comment which is followed by the statement on the same line stays on that line.
+			sameLine = !isLineComment(comment) && comment.End.Line == start.Line
+			if sameLine {
+				p.write(" ")
+			}
+		}
+		if !sameLine {
+			beginLine(start.Line)
+		}
+		p.stmt(stmt)
+		p.lastLine = stmt.End().Line
+		if i+1 < len(stmts) {
+			p.trailingComments(stmtStart(stmts[i+1]))
+		} else {
+			p.trailingComments(end)
+		}
+	}
+
+	for p.commentBefore(end) {
+		beginLine(p.comments[0].Start.Line)
+		p.write(commentText(p.popComment()))
+	}
+}
+
+// trailingComments prints the comments which start on the last line that was printed and come before end.
+func (p *printer) trailingComments(end token.Position) {
+	for p.commentBefore(end) && p.comments[0].Start.Line <= p.lastLine {
+		p.write(" ")
+		p.write(commentText(p.popComment()))
+	}
+}
+
+// commentBefore reports whether the next comment comes before end. If end has a negative line number, then it reports
+// whether there are any comments left.
+func (p *printer) commentBefore(end token.Position) bool {
+	return len(p.comments) > 0 && (end.Line < 0 || p.comments[0].Start.Compare(end) < 0)
+}
+
+// stmtStart returns the position of the first token of a statement.
+func stmtStart(stmt ast.Stmt) token.Position {
+	if decl, ok := stmt.(ast.VarDecl); ok {
+		// VarDecl.Start returns the position of the variable name.
+		return decl.Var.Start
+	}
+	return stmt.Start()
+}
+
+// body prints the body of a function, class, or block statement, which starts with a { which has already been printed
+// and ends with rightBrace.
+func (p *printer) body(stmts []ast.Stmt, rightBrace token.Token) {
+	if len(stmts) == 0 && !p.commentBefore(rightBrace.Start) {
+		p.tok(rightBrace)
+		return
+	}
+	// Comments which follow the { on the same line stay there.
+	if len(stmts) > 0 {
+		p.trailingComments(stmtStart(stmts[0]))
+	} else {
+		p.trailingComments(rightBrace.Start)
+	}
+	if len(stmts) == 0 && !p.commentBefore(rightBrace.Start) {
+		p.newline()
+		p.tok(rightBrace)
+		return
+	}
+	p.indent++
+	p.newline()
+	p.stmts(stmts, rightBrace.Start)
+	p.indent--
+	p.newline()
+	p.tok(rightBrace)
+}
+
+// elseComments prints the comments which come between the then branch of an if statement and the start of its else
+// branch, followed by the space or newline which comes before the else. Comments which follow the then branch on the
+// same line stay there and any others are printed on their own line. The else is printed on the same line as a then
+// branch which is a block, unless it's preceded by a line comment or a comment on its own line.
+func (p *printer) elseComments(elseStart token.Position, thenBlock bool) {
+	sameLine := thenBlock
+	for p.commentBefore(elseStart) {
+		comment := p.comments[0]
+		if comment.Start.Line <= p.lastLine {
+			p.write(" ")
+		} else {
+			p.newline()
+			sameLine = false
+		}
+		p.write(commentText(p.popComment()))
+		if isLineComment(comment) {
+			sameLine = false
+		}
+	}
+	if sameLine {
+		p.write(" ")
+	} else {
+		p.newline()
+	}
+}
+
+// nestedStmt prints the body of an if, while, or for statement. Blocks are printed on the same line as the statement
+// and any other statement is printed on the following line.
+func (p *printer) nestedStmt(stmt ast.Stmt) {
+	if block, ok := stmt.(ast.BlockStmt); ok {
+		p.write(" ")
+		p.stmt(block)
+		return
+	}
+	p.indent++
+	p.newline()
+	p.stmts([]ast.Stmt{stmt}, stmt.End())
+	p.indent--
+}
+
+func (p *printer) stmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case ast.VarDecl:
+		p.tok(stmt.Var)
+		p.write(" ")
+		p.tok(stmt.Name)
+		if stmt.Initialiser != nil {
+			p.write(" = ")
+			p.expr(stmt.Initialiser)
+		}
+		p.tok(stmt.Semicolon)
+	case ast.FunDecl:
+		p.tok(stmt.Fun)
+		p.write(" ")
+		p.tok(stmt.Name)
+		p.function(stmt.Params, stmt.Body, stmt.RightBrace)
+	case ast.ClassDecl:
+		p.tok(stmt.Class)
+		p.write(" ")
+		p.tok(stmt.Name)
+		if stmt.Superclass != nil {
+			p.write(" < ")
+			p.expr(stmt.Superclass)
+		}
+		p.write(" {")
+		methods := make([]ast.Stmt, len(stmt.Body))
+		for i, method := range stmt.Body {
+			methods[i] = method
+		}
+		p.body(methods, stmt.RightBrace)
+	case ast.MethodDecl:
+		p.tok(stmt.Name)
+		p.function(stmt.Params, stmt.Body, stmt.RightBrace)
+	case ast.ImportDecl:
+		p.tok(stmt.Import)
+		p.write(" ")
+		p.tok(stmt.Path)
+		p.write(" as ")
+		p.tok(stmt.Alias)
+		p.tok(stmt.Semicolon)
+	case ast.ExprStmt:
+		p.expr(stmt.Expr)
+		p.tok(stmt.Semicolon)
+	case ast.PrintStmt:
+		p.tok(stmt.Print)
+		p.write(" ")
+		p.expr(stmt.Expr)
+		p.tok(stmt.Semicolon)
+	case ast.BlockStmt:
+		p.tok(stmt.LeftBrace)
+		p.body(stmt.Stmts, stmt.RightBrace)
+	case ast.IfStmt:
+		p.tok(stmt.If)
+		p.write(" (")
+		p.expr(stmt.Condition)
+		p.write(")")
+		p.nestedStmt(stmt.Then)
+		if stmt.Else == nil {
+			return
+		}
+		_, thenBlock := stmt.Then.(ast.BlockStmt)
+		p.elseComments(stmtStart(stmt.Else), thenBlock)
+		p.write("else")
+		if elseIf, ok := stmt.Else.(ast.IfStmt); ok {
+			p.write(" ")
+			p.stmt(elseIf)
+		} else {
+			p.nestedStmt(stmt.Else)
+		}
+	case ast.WhileStmt:
+		p.tok(stmt.While)
+		p.write(" (")
+		p.expr(stmt.Condition)
+		p.write(")")
+		p.nestedStmt(stmt.Body)
+	case ast.ForStmt:
+		p.tok(stmt.For)
+		p.write(" (")
+		if stmt.Initialise != nil {
+			p.stmt(stmt.Initialise)
+		} else {
+			p.write(";")
+		}
+		if stmt.Condition != nil {
+			p.write(" ")
+			p.expr(stmt.Condition)
+		}
+		p.write(";")
+		if stmt.Update != nil {
+			p.write(" ")
+			p.expr(stmt.Update)
+		}
+		p.write(")")
+		p.nestedStmt(stmt.Body)
+	case ast.BreakStmt:
+		p.tok(stmt.Break)
+		p.tok(stmt.Semicolon)
+	case ast.ContinueStmt:
+		p.tok(stmt.Continue)
+		p.tok(stmt.Semicolon)
+	case ast.ReturnStmt:
+		p.tok(stmt.Return)
+		if stmt.Value != nil {
+			p.write(" ")
+			p.expr(stmt.Value)
+		}
+		p.tok(stmt.Semicolon)
+	case ast.ThrowStmt:
+		p.tok(stmt.Throw)
+		p.write(" ")
+		p.expr(stmt.Value)
+		p.tok(stmt.Semicolon)
+	case ast.TryStmt:
+		p.tok(stmt.Try)
+		p.write(" ")
+		p.stmt(stmt.Body)
+		if stmt.CatchBody != nil {
+			p.write(" catch (")
+			p.tok(stmt.CatchIdent)
+			p.write(") ")
+			p.stmt(stmt.CatchBody)
+		}
+		if stmt.FinallyBody != nil {
+			p.write(" finally ")
+			p.stmt(stmt.FinallyBody)
+		}
+	default:
+		// IllegalStmt is only present in programs which failed to parse, which can't be formatted.
+		panic(fmt.Sprintf("unexpected statement type: %T", stmt))
+	}
+}
+
+// function prints the parameters and body of a function or method.
+func (p *printer) function(params []token.Token, body []ast.Stmt, rightBrace token.Token) {
+	p.write("(")
+	for i, param := range params {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.tok(param)
+	}
+	p.write(") {")
+	p.body(body, rightBrace)
+}
+
+func (p *printer) expr(expr ast.Expr) {
+	switch expr := expr.(type) {
+	case ast.FunExpr:
+		p.tok(expr.Fun)
+		p.function(expr.Params, expr.Body, expr.RightBrace)
+	case ast.GroupExpr:
+		p.tok(expr.LeftParen)
+		p.expr(expr.Expr)
+		p.tok(expr.RightParen)
+	case ast.LiteralExpr:
+		p.tok(expr.Value)
+	case ast.InterpolationExpr:
+		// The literal parts include the ${ and } which surround the interpolated expressions.
+		for _, part := range expr.Parts {
+			p.expr(part)
+		}
+	case ast.ListExpr:
+		p.tok(expr.LeftBracket)
+		p.exprs(expr.Elements)
+		p.tok(expr.RightBracket)
+	case ast.MapExpr:
+		p.tok(expr.LeftBrace)
+		for i, entry := range expr.Entries {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(entry.Key)
+			p.write(": ")
+			p.expr(entry.Value)
+		}
+		p.tok(expr.RightBrace)
+	case ast.VariableExpr:
+		p.tok(expr.Name)
+	case ast.ThisExpr:
+		p.tok(expr.This)
+	case ast.SuperExpr:
+		p.tok(expr.Super)
+		p.write(".")
+		p.tok(expr.Method)
+	case ast.CallExpr:
+		p.expr(expr.Callee)
+		p.write("(")
+		p.exprs(expr.Args)
+		p.tok(expr.RightParen)
+	case ast.GetExpr:
+		p.expr(expr.Object)
+		p.write(".")
+		p.tok(expr.Name)
+	case ast.IndexExpr:
+		p.expr(expr.Object)
+		p.write("[")
+		p.expr(expr.Index)
+		p.tok(expr.RightBracket)
+	case ast.SliceExpr:
+		p.expr(expr.Object)
+		p.write("[")
+		if expr.Low != nil {
+			p.expr(expr.Low)
+		}
+		p.write(":")
+		if expr.High != nil {
+			p.expr(expr.High)
+		}
+		p.tok(expr.RightBracket)
+	case ast.UnaryExpr:
+		p.tok(expr.Op)
+		p.expr(expr.Right)
+	case ast.BinaryExpr:
+		p.expr(expr.Left)
+		if expr.Op.Type != token.Comma {
+			p.write(" ")
+		}
+		p.tok(expr.Op)
+		p.write(" ")
+		p.expr(expr.Right)
+	case ast.TernaryExpr:
+		p.expr(expr.Condition)
+		p.write(" ? ")
+		p.expr(expr.Then)
+		p.write(" : ")
+		p.expr(expr.Else)
+	case ast.AssignmentExpr:
+		p.tok(expr.Left)
+		p.write(" = ")
+		p.expr(expr.Right)
+	case ast.SetExpr:
+		p.expr(expr.Object)
+		p.write(".")
+		p.tok(expr.Name)
+		p.write(" = ")
+		p.expr(expr.Value)
+	case ast.IndexSetExpr:
+		p.expr(expr.Object)
+		p.write("[")
+		p.expr(expr.Index)
+		p.write("] = ")
+		p.expr(expr.Value)
+	default:
+		panic(fmt.Sprintf("unexpected expression type: %T", expr))
+	}
+}
+
+// exprs prints a comma-separated list of expressions.
+func (p *printer) exprs(exprs []ast.Expr) {
+	for i, expr := range exprs {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expr(expr)
+	}
+}
@@ -1,12 +1,59 @@
 package interpreter
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+)
 
 var builtins = []*loxBuiltinFunction{
-	newLoxBuiltinFunction("clock", nil, func([]loxObject) loxObject {
+	newLoxBuiltinFunction("clock", nil, false, func(*Interpreter, ast.CallExpr, []loxObject) loxObject {
 		return loxNumber(time.Now().UnixNano()) / loxNumber(time.Second)
 	}),
-	newLoxBuiltinFunction("type", []string{"object"}, func(args []loxObject) loxObject {
-		return loxString(args[0].Type())
+	newLoxBuiltinFunction("type", []string{"object"}, false,
+		func(_ *Interpreter, _ ast.CallExpr, args []loxObject) loxObject {
+			return loxString(args[0].Type())
+		},
+	),
+	newLoxBuiltinFunction("readLine", nil, false, func(i *Interpreter, call ast.CallExpr, _ []loxObject) loxObject {
+		// Output is flushed first so that any prompt which has been printed is displayed before waiting for input.
+		_ = i.stdout.Flush()
+		line, err := i.stdin.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			if line == "" {
+				return loxNil{}
+			}
+		} else if err != nil {
+			raiseAt(call, err)
+		}
+		i.allocate(call, stringSize+len(line))
+		return loxString(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+	}),
+	newLoxBuiltinFunction("args", nil, false, func(i *Interpreter, call ast.CallExpr, _ []loxObject) loxObject {
+		i.allocate(call, listSize+elementSize*len(i.args))
+		elements := make([]loxObject, len(i.args))
+		for j, arg := range i.args {
+			elements[j] = loxString(arg)
+		}
+		return newLoxList(elements)
 	}),
+	newLoxBuiltinFunction("exit", []string{"code"}, false,
+		func(_ *Interpreter, call ast.CallExpr, args []loxObject) loxObject {
+			code, ok := args[0].(loxNumber)
+			if !ok {
+				raiseAt(call, fmt.Errorf("exit code must be a %m, got %m", loxTypeNumber, args[0].Type()))
+			}
+			if code < 0 || code > 255 || code != loxNumber(int(code)) {
+				raiseAt(call, fmt.Errorf("exit code must be an integer between 0 and 255, got %s", code))
+			}
+			// execTryStmt runs finally blocks for any panic, so they're run on the way out. The process isn't exited here
+			// because that's for the embedder of the interpreter to decide.
+			panic(&lox.ExitError{Code: int(code)})
+		},
+	),
 }
@@ -0,0 +1,48 @@
+package interpreter
+
+// GlobalIdents returns the identifiers of the global declarations, including the built-in ones, in sorted order.
+func (i *Interpreter) GlobalIdents() []string {
+	return sortedKeys(i.globals.valuesByIdent)
+}
+
+// PropertyNames returns the names of the properties of the value which is referred to by a path of names, in sorted
+// order. The first name is a global variable and each subsequent name is a property of the value of the previous one.
+// For example, the path [a b] refers to the value of a.b. nil is returned if the value can't be found.
+// Only fields of instances and declarations of modules are accessed, so finding the value doesn't execute any code.
+func (i *Interpreter) PropertyNames(path []string) []string {
+	if len(path) == 0 {
+		return nil
+	}
+	value := i.globals.valuesByIdent[path[0]]
+	for _, name := range path[1:] {
+		switch object := value.(type) {
+		case *loxInstance:
+			value = object.fieldValuesByName[name]
+		case *loxModule:
+			if !object.exportedIdents[name] {
+				return nil
+			}
+			value = object.globals.valuesByIdent[name]
+		default:
+			return nil
+		}
+	}
+
+	switch object := value.(type) {
+	case *loxInstance:
+		namesSet := make(map[string]bool, len(object.fieldValuesByName))
+		for name := range object.fieldValuesByName {
+			namesSet[name] = true
+		}
+		for class := object.class; class != nil; class = class.superclass {
+			for name := range class.methodsByName {
+				namesSet[name] = true
+			}
+		}
+		return sortedKeys(namesSet)
+	case *loxModule:
+		return sortedKeys(object.exportedIdents)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,416 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/parser"
+	"github.com/marcuscaisey/lox/golox/resolver"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// Command tells a [Debugger] how to resume the execution of a paused program.
+type Command int
+
+const (
+	// CommandContinue resumes execution until the next breakpoint is reached.
+	CommandContinue Command = iota
+	// CommandStepIn pauses at the next statement, including statements inside any function which is called.
+	CommandStepIn
+	// CommandStepOver pauses at the next statement in the current function, or in its caller if it returns.
+	CommandStepOver
+	// CommandStepOut pauses at the next statement in the caller of the current function.
+	CommandStepOut
+)
+
+// PauseReason is the reason that a [Debugger] paused the execution of a program.
+type PauseReason int
+
+const (
+	PauseReasonBreakpoint PauseReason = iota
+	PauseReasonStep
+	PauseReasonRequest
+)
+
+func (r PauseReason) String() string {
+	switch r {
+	case PauseReasonBreakpoint:
+		return "breakpoint"
+	case PauseReasonStep:
+		return "step"
+	case PauseReasonRequest:
+		return "pause"
+	default:
+		return fmt.Sprintf("PauseReason(%d)", int(r))
+	}
+}
+
+// Debugger pauses the execution of a program so that it can be inspected. Execution pauses before a statement on a
+// line with a breakpoint is executed, after stepping, and when a pause has been requested. A debugger is attached to
+// an interpreter with the [Debug] option.
+//
+// When execution pauses, the debugger calls its pause handler, which can inspect the program and then returns the
+// [Command] which tells the debugger how to resume. Execution remains paused until the handler returns.
+// Breakpoints can be changed and pauses requested at any time, including from other goroutines.
+type Debugger struct {
+	handlePause func(*Pause) Command
+
+	mu             sync.Mutex
+	breakpoints    map[string]map[int]bool // lines with breakpoints by absolute file path
+	pauseRequested bool
+
+	command      Command
+	commandDepth int          // call depth when the last command was given
+	frames       []debugFrame // statement being executed by each call frame, indexed by call depth
+	pathsByFile  map[*token.File]string
+	evaluating   bool // whether an expression is being evaluated in a paused frame
+}
+
+// debugFrame describes the statement which is being executed by a call frame.
+type debugFrame struct {
+	env *environment // nil if the frame is a call to a built-in function
+	pos token.Position
+}
+
+// NewDebugger returns a new debugger which calls handlePause when execution pauses.
+func NewDebugger(handlePause func(*Pause) Command) *Debugger {
+	return &Debugger{
+		handlePause: handlePause,
+		breakpoints: map[string]map[int]bool{},
+		pathsByFile: map[*token.File]string{},
+	}
+}
+
+// Debug attaches a debugger to the interpreter.
+func Debug(debugger *Debugger) Option {
+	return func(i *Interpreter) {
+		i.debugger = debugger
+	}
+}
+
+// SetBreakpoint sets a breakpoint on a line of a file.
+func (d *Debugger) SetBreakpoint(path string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	path = absPath(path)
+	if d.breakpoints[path] == nil {
+		d.breakpoints[path] = map[int]bool{}
+	}
+	d.breakpoints[path][line] = true
+}
+
+// ClearBreakpoint clears the breakpoint on a line of a file. false is returned if there wasn't one.
+func (d *Debugger) ClearBreakpoint(path string, line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	path = absPath(path)
+	if !d.breakpoints[path][line] {
+		return false
+	}
+	delete(d.breakpoints[path], line)
+	return true
+}
+
+// SetBreakpoints replaces the breakpoints in a file with breakpoints on the given lines.
+func (d *Debugger) SetBreakpoints(path string, lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	linesSet := make(map[int]bool, len(lines))
+	for _, line := range lines {
+		linesSet[line] = true
+	}
+	d.breakpoints[absPath(path)] = linesSet
+}
+
+// RequestPause requests that execution pauses before the next statement is executed.
+func (d *Debugger) RequestPause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pauseRequested = true
+}
+
+// absPath returns the absolute form of a path, or the path unchanged if it's empty or can't be made absolute.
+func absPath(path string) string {
+	if path == "" {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// beforeStmt is called by the interpreter before it executes a statement and pauses execution if required.
+func (d *Debugger) beforeStmt(i *Interpreter, env *environment, stmt ast.Stmt) {
+	if _, ok := stmt.(ast.BlockStmt); ok || d.evaluating {
+		// Execution pauses at the statements inside blocks rather than the blocks themselves.
+		return
+	}
+	depth := len(i.callStack)
+	d.frames = d.frames[:min(len(d.frames), depth)]
+	for len(d.frames) < depth {
+		// The caller is a built-in function, which doesn't execute statements.
+		d.frames = append(d.frames, debugFrame{})
+	}
+	pos := stmt.Start()
+	if decl, ok := stmt.(ast.VarDecl); ok {
+		// VarDecl.Start returns the position of the variable name.
+		pos = decl.Var.Start
+	}
+	d.frames = append(d.frames, debugFrame{env: env, pos: pos})
+
+	reason, ok := d.pauseReason(pos, depth)
+	if !ok {
+		return
+	}
+	// Output is flushed so that everything printed before the pause is displayed whilst the program is paused.
+	_ = i.stdout.Flush()
+	d.command = d.handlePause(d.newPause(i, reason))
+	d.commandDepth = depth
+}
+
+func (d *Debugger) pauseReason(pos token.Position, depth int) (PauseReason, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pauseRequested {
+		d.pauseRequested = false
+		return PauseReasonRequest, true
+	}
+	if d.breakpoints[d.path(pos.File)][pos.Line] {
+		return PauseReasonBreakpoint, true
+	}
+	switch d.command {
+	case CommandStepIn:
+		return PauseReasonStep, true
+	case CommandStepOver:
+		return PauseReasonStep, depth <= d.commandDepth
+	case CommandStepOut:
+		return PauseReasonStep, depth < d.commandDepth
+	default:
+		return 0, false
+	}
+}
+
+// path returns the absolute path of a file.
+func (d *Debugger) path(file *token.File) string {
+	path, ok := d.pathsByFile[file]
+	if !ok {
+		path = absPath(file.Name)
+		d.pathsByFile[file] = path
+	}
+	return path
+}
+
+func (d *Debugger) newPause(i *Interpreter, reason PauseReason) *Pause {
+	depth := len(i.callStack)
+	frames := make([]*Frame, 0, depth+1)
+	for j := depth; j >= 0; j-- {
+		frame := &Frame{
+			Name:        "<script>",
+			Pos:         d.frames[j].pos,
+			interpreter: i,
+			debugger:    d,
+			env:         d.frames[j].env,
+		}
+		if j > 0 {
+			frame.Name = i.callStack[j-1].name
+		}
+		if j < depth {
+			// The position of the call is more precise than the position of the statement containing it.
+			frame.Pos = i.callStack[j].pos
+		}
+		frames = append(frames, frame)
+	}
+	return &Pause{Reason: reason, Frames: frames}
+}
+
+// Pause describes a program whose execution has been paused by a [Debugger].
+type Pause struct {
+	Reason PauseReason
+	Frames []*Frame // call frames which are in progress, ordered from the innermost to the outermost
+}
+
+// Frame is a call frame of a paused program.
+type Frame struct {
+	Name string         // name of the function which was called, or <script> for the top level of the program
+	Pos  token.Position // position of the statement or call which is being executed
+
+	interpreter *Interpreter
+	debugger    *Debugger
+	env         *environment
+}
+
+// Locals returns a description of the variables which are in scope in the frame. Each environment in the scope chain
+// is displayed as a level of a tree, starting with the global environment.
+func (f *Frame) Locals() string {
+	if f.env == nil {
+		return "<no variables>"
+	}
+	return f.env.String()
+}
+
+// Scopes returns the environments in the scope chain of the frame, ordered from the innermost to the global
+// environment. The built-in declarations are excluded from the global scope.
+func (f *Frame) Scopes() []Scope {
+	var scopes []Scope
+	for env := f.env; env != nil; env = env.parent {
+		if env.isGlobal() {
+			scopes = append(scopes, Scope{Name: "Globals", Variables: f.globalVariables(env)})
+			break
+		}
+		name := "Enclosing"
+		if len(scopes) == 0 {
+			name = "Locals"
+		}
+		variables := make([]Variable, len(env.idents))
+		for slot, ident := range env.idents {
+			variables[slot] = newVariable(ident, env.values[slot])
+		}
+		scopes = append(scopes, Scope{Name: name, Variables: variables})
+	}
+	return scopes
+}
+
+func (f *Frame) globalVariables(globals *environment) []Variable {
+	var variables []Variable
+	for _, ident := range sortedKeys(globals.valuesByIdent) {
+		value := globals.valuesByIdent[ident]
+		if builtin, ok := f.interpreter.builtins.valuesByIdent[ident]; ok && builtin == value {
+			continue
+		}
+		variables = append(variables, newVariable(ident, value))
+	}
+	return variables
+}
+
+// Scope is an environment in the scope chain of a [Frame].
+type Scope struct {
+	Name      string // Locals for the innermost environment, Globals for the global environment, otherwise Enclosing
+	Variables []Variable
+}
+
+// Variable is a variable in a [Scope], or an element, entry, or field of the value of another variable.
+type Variable struct {
+	Name  string
+	Value string // string representation of the value, which is <undefined> if the variable hasn't been defined yet
+	Type  string // type of the value, which is empty if the variable hasn't been defined yet
+
+	value loxObject
+}
+
+func newVariable(name string, value loxObject) Variable {
+	if value == nil {
+		return Variable{Name: name, Value: "<undefined>"}
+	}
+	return Variable{Name: name, Value: elementString(value), Type: string(value.Type()), value: value}
+}
+
+// HasChildren reports whether the value of the variable contains other values.
+func (v Variable) HasChildren() bool {
+	switch value := v.value.(type) {
+	case *loxList:
+		return len(value.elements) > 0
+	case *loxMap:
+		return len(value.entries) > 0
+	case *loxInstance:
+		return len(value.fieldValuesByName) > 0
+	case *loxModule:
+		return len(value.exportedIdents) > 0
+	default:
+		return false
+	}
+}
+
+// Children returns the values contained by the value of the variable: the elements of a list, the entries of a map, the
+// fields of an instance, or the exported declarations of a module.
+func (v Variable) Children() []Variable {
+	var children []Variable
+	switch value := v.value.(type) {
+	case *loxList:
+		for i, element := range value.elements {
+			children = append(children, newVariable(fmt.Sprintf("[%d]", i), element))
+		}
+	case *loxMap:
+		for _, entry := range value.entries {
+			children = append(children, newVariable(elementString(entry.Key), entry.Value))
+		}
+	case *loxInstance:
+		for _, name := range sortedKeys(value.fieldValuesByName) {
+			children = append(children, newVariable(name, value.fieldValuesByName[name]))
+		}
+	case *loxModule:
+		for _, ident := range sortedKeys(value.exportedIdents) {
+			children = append(children, newVariable(ident, value.globals.valuesByIdent[ident]))
+		}
+	}
+	return children
+}
+
+// Eval evaluates an expression in the frame and returns the string representation of its value. An error is returned
+// if the expression can't be parsed or resolved, or if a runtime error occurs whilst evaluating it.
+func (f *Frame) Eval(src string) (result string, err error) {
+	if f.env == nil {
+		return "", errors.New("expressions can't be evaluated in a built-in function")
+	}
+	src = strings.TrimSuffix(strings.TrimSpace(src), ";") + ";"
+	program, err := parser.Parse(strings.NewReader(src))
+	if err != nil {
+		return "", err
+	}
+	var stmt ast.ExprStmt
+	if len(program.Stmts) == 1 {
+		stmt, _ = program.Stmts[0].(ast.ExprStmt)
+	}
+	if stmt.Expr == nil {
+		return "", errors.New("expected an expression")
+	}
+
+	var scopes [][]string
+	for env := f.env; !env.isGlobal(); env = env.parent {
+		scopes = append(scopes, env.idents)
+	}
+	slices.Reverse(scopes)
+	localsByTok, err := resolver.ResolveInScopes(program, scopes)
+	if err != nil {
+		return "", err
+	}
+	i := f.interpreter
+	maps.Copy(i.localsByTok, localsByTok)
+
+	// The debugger doesn't pause inside any functions which are called by the expression.
+	f.debugger.evaluating = true
+	callDepth := len(i.callStack)
+	defer func() {
+		f.debugger.evaluating = false
+		r := recover()
+		if r == nil {
+			return
+		}
+		i.callStack = i.callStack[:callDepth]
+		switch r := r.(type) {
+		case *lox.Error:
+			err = r
+		case thrownValue:
+			err = lox.NewErrorFromNode(r.node, "%s", i.uncaughtMessage(r.value))
+		default:
+			panic(r)
+		}
+	}()
+	return i.evalExpr(f.env, stmt.Expr).String(), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
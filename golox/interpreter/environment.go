@@ -6,18 +6,33 @@ import (
 	"strings"
 
 	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/resolver"
 	"github.com/marcuscaisey/lox/golox/token"
 )
 
+// environment holds the values of the variables declared in a scope.
+// The global environment of a module stores its values by identifier, since globals are looked up by name. Local
+// environments, which are created with [*environment.Child], store their values in slots which are assigned by the
+// resolver in the order that the variables are declared.
 type environment struct {
 	parent        *environment
-	valuesByIdent map[string]loxObject
+	globals       *environment         // root of the parent chain, which holds the global declarations of a module
+	valuesByIdent map[string]loxObject // only used by the global environment
+	idents        []string             // identifiers of the local variables, indexed by slot
+	values        []loxObject          // values of the local variables, indexed by slot
 }
 
+// newEnvironment creates a new global environment.
 func newEnvironment() *environment {
-	return &environment{
+	env := &environment{
 		valuesByIdent: make(map[string]loxObject),
 	}
+	env.globals = env
+	return env
+}
+
+func (e *environment) isGlobal() bool {
+	return e.parent == nil
 }
 
 func (e *environment) String() string {
@@ -35,13 +50,21 @@ func (e *environment) string() (prefix string, s string) {
 		firstLinePrefix = parentPrefix + "└──"
 	}
 
-	if len(e.valuesByIdent) == 0 {
+	valuesByIdent := e.valuesByIdent
+	if !e.isGlobal() {
+		valuesByIdent = make(map[string]loxObject, len(e.values))
+		for slot, ident := range e.idents {
+			valuesByIdent[ident] = e.values[slot]
+		}
+	}
+
+	if len(valuesByIdent) == 0 {
 		fmt.Fprintf(&b, "%s<empty>", firstLinePrefix)
 		return prefix, b.String()
 	}
 
-	idents := make([]string, 0, len(e.valuesByIdent))
-	for ident := range e.valuesByIdent {
+	idents := make([]string, 0, len(valuesByIdent))
+	for ident := range valuesByIdent {
 		idents = append(idents, ident)
 	}
 	slices.Sort(idents)
@@ -50,16 +73,21 @@ func (e *environment) string() (prefix string, s string) {
 		if i == 0 {
 			prefix = firstLinePrefix
 		}
-		fmt.Fprintf(&b, "%s%s: %s\n", prefix, ident, e.valuesByIdent[ident])
+		value := "<undefined>"
+		if v := valuesByIdent[ident]; v != nil {
+			value = v.String()
+		}
+		fmt.Fprintf(&b, "%s%s: %s\n", prefix, ident, value)
 	}
 	return prefix, strings.TrimSuffix(b.String(), "\n")
 }
 
-// Child creates a new child environment of this environment.
+// Child creates a new local environment which is a child of this environment.
 func (e *environment) Child() *environment {
-	env := newEnvironment()
-	env.parent = e
-	return env
+	return &environment{
+		parent:  e,
+		globals: e.globals,
+	}
 }
 
 // Declare declares an identifier in this environment.
@@ -69,10 +97,22 @@ func (e *environment) Declare(tok token.Token) {
 	if tok.Lexeme == token.BlankIdent {
 		return
 	}
+	e.declare(tok, nil)
+}
+
+// declare declares an identifier in this environment with a value, which is nil if the identifier is not defined yet.
+// In a local environment, the identifier is assigned the next slot. Redeclarations of local identifiers are reported by
+// the resolver, so they're not checked for here.
+func (e *environment) declare(tok token.Token, value loxObject) {
+	if !e.isGlobal() {
+		e.idents = append(e.idents, tok.Lexeme)
+		e.values = append(e.values, value)
+		return
+	}
 	if _, ok := e.valuesByIdent[tok.Lexeme]; ok {
 		panic(lox.NewErrorFromToken(tok, "%s has already been declared", tok.Lexeme))
 	}
-	e.valuesByIdent[tok.Lexeme] = nil
+	e.valuesByIdent[tok.Lexeme] = value
 }
 
 // Define declares an identifier in this environment and defines it with a value.
@@ -87,10 +127,7 @@ func (e *environment) Define(tok token.Token, value loxObject) {
 	if value == nil {
 		panic(fmt.Sprintf("attempt to define %s to nil", tok.Lexeme))
 	}
-	if _, ok := e.valuesByIdent[tok.Lexeme]; ok {
-		panic(lox.NewErrorFromToken(tok, "%s has already been declared", tok.Lexeme))
-	}
-	e.valuesByIdent[tok.Lexeme] = value
+	e.declare(tok, value)
 }
 
 // Set declares an identifier in this environment and defines it with a value.
@@ -106,6 +143,11 @@ func (e *environment) Set(ident string, value loxObject) {
 		// It's a bug if we end up here
 		panic(fmt.Sprintf("attempt to set %s to nil", ident))
 	}
+	if !e.isGlobal() {
+		e.idents = append(e.idents, ident)
+		e.values = append(e.values, value)
+		return
+	}
 	if _, ok := e.valuesByIdent[ident]; ok {
 		// It's a bug if we end up here
 		panic(fmt.Sprintf("%s has already been declared", ident))
@@ -113,8 +155,8 @@ func (e *environment) Set(ident string, value loxObject) {
 	e.valuesByIdent[ident] = value
 }
 
-// Assign assigns a value to an identifier in this environment.
-// If the identifier has not been defined in this environment, then an error is raised.
+// Assign assigns a value to an identifier in this global environment.
+// If the identifier has not been declared in this environment, then an error is raised.
 // If the identifier is [token.BlankIdent], then this method is a no-op.
 func (e *environment) Assign(tok token.Token, value loxObject) {
 	if tok.Lexeme == token.BlankIdent {
@@ -130,12 +172,13 @@ func (e *environment) Assign(tok token.Token, value loxObject) {
 	e.valuesByIdent[tok.Lexeme] = value
 }
 
-// AssignAt assigns a value to a variable in the environment distance levels up the parent chain.
-func (e *environment) AssignAt(distance int, tok token.Token, value loxObject) {
-	e.ancestor(distance).Assign(tok, value)
+// AssignAt assigns a value to the local variable in the given slot of the environment local.Depth levels up the parent
+// chain.
+func (e *environment) AssignAt(local resolver.Local, value loxObject) {
+	e.ancestor(local.Depth).values[local.Slot] = value
 }
 
-// Get returns the value of an identifier in this environment.
+// Get returns the value of an identifier in this global environment.
 // If the identifier has not been declared or defined in this environment, then an error is raised.
 func (e *environment) Get(tok token.Token) loxObject {
 	value, ok := e.valuesByIdent[tok.Lexeme]
@@ -148,12 +191,18 @@ func (e *environment) Get(tok token.Token) loxObject {
 	return value
 }
 
-// Get returns the value of an identifier in this environment.
+// GetByIdent returns the value of an identifier in this environment.
 // If the identifier has not been declared or defined in this environment, then this method panics.
 // This method should be used for accesses which did not originate from an expression in code. Otherwise, use
-// [*environment.Get].
+// [*environment.Get] or [*environment.GetAt].
 func (e *environment) GetByIdent(ident string) loxObject {
-	value, ok := e.valuesByIdent[ident]
+	var value loxObject
+	ok := false
+	if e.isGlobal() {
+		value, ok = e.valuesByIdent[ident]
+	} else if slot := slices.Index(e.idents, ident); slot != -1 {
+		value, ok = e.values[slot], true
+	}
 	if !ok {
 		// It's a bug if we end up here
 		panic(fmt.Sprintf("%s has not been declared", ident))
@@ -165,9 +214,15 @@ func (e *environment) GetByIdent(ident string) loxObject {
 	return value
 }
 
-// GetAt returns the value of an identifier in the environment distance levels up the parent chain.
-func (e *environment) GetAt(distance int, tok token.Token) loxObject {
-	return e.ancestor(distance).Get(tok)
+// GetAt returns the value of the local variable in the given slot of the environment local.Depth levels up the parent
+// chain. tok is the identifier which refers to the variable and is used to report errors.
+// If the variable has not been defined, then an error is raised.
+func (e *environment) GetAt(local resolver.Local, tok token.Token) loxObject {
+	value := e.ancestor(local.Depth).values[local.Slot]
+	if value == nil {
+		panic(lox.NewErrorFromToken(tok, "%s has not been defined", tok.Lexeme))
+	}
+	return value
 }
 
 func (e *environment) ancestor(n int) *environment {
@@ -2,21 +2,52 @@
 package interpreter
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"maps"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/marcuscaisey/lox/golox/ast"
 	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/resolver"
 	"github.com/marcuscaisey/lox/golox/token"
 )
 
 // Interpreter is the interpreter for the language.
 type Interpreter struct {
+	builtins             *environment // declarations which are available in every module
 	globals              *environment
-	declDistancesByTok   map[token.Token]int
+	localsByTok          map[token.Token]resolver.Local
 	printExprStmtResults bool
+	errorClass           *loxClass
+	modulesByPath        map[string]*loxModule
+	nativeModulesByName  map[string]*loxModule
+	importStack          []importingModule
+	callStack            []callFrame
+	maxCallDepth         int
+	debugger             *Debugger
+	stdout               flushWriter // flushed when execution finishes or is paused, or input is read
+	stderr               io.Writer
+	stdin                *bufio.Reader
+	args                 []string
+	ctx                  context.Context // interrupts execution when it's done
+	done                 <-chan struct{} // ctx.Done(), which is cached since it's checked on every loop iteration and call
+	timeout              time.Duration
+	maxStmts             int
+	stmts                int // number of statements executed since execution started
+	maxMemory            int
+	allocated            int // approximate number of bytes allocated since execution started
+}
+
+// callFrame is a call which is in progress.
+type callFrame struct {
+	name string         // name of the callable which was called
+	pos  token.Position // position of the call expression
 }
 
 // Option can be passed to New to configure the interpreter.
@@ -30,16 +61,75 @@ func REPLMode() Option {
 	}
 }
 
+// DefaultMaxCallDepth is the maximum depth of nested calls if one isn't set with [MaxCallDepth].
+const DefaultMaxCallDepth = 10000
+
+// MaxCallDepth sets the maximum depth of nested calls.
+// A call which would exceed it raises a "stack overflow" error instead, which stops unbounded recursion from exhausting
+// the Go stack.
+func MaxCallDepth(depth int) Option {
+	return func(i *Interpreter) {
+		i.maxCallDepth = depth
+	}
+}
+
+// Stdout sets the writer which program output is written to.
+// Output is buffered and flushed when [*Interpreter.Interpret] or [*Interpreter.Call] returns, before input is read,
+// and when the program is paused by a debugger. The default is [os.Stdout], which is also flushed at the end of each
+// line so that output isn't held back from a program which runs for a long time or is killed.
+func Stdout(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.stdout = bufio.NewWriter(w)
+	}
+}
+
+// flushWriter is a buffered writer.
+type flushWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// Stderr sets the writer which diagnostics, such as warnings and the tracebacks of errors, are written to. The default
+// is [os.Stderr].
+func Stderr(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.stderr = w
+	}
+}
+
+// Stdin sets the reader which input is read from. The default is [os.Stdin].
+func Stdin(r io.Reader) Option {
+	return func(i *Interpreter) {
+		i.stdin = bufio.NewReader(r)
+	}
+}
+
+// Args sets the command-line arguments which are returned by the args built-in function.
+func Args(args []string) Option {
+	return func(i *Interpreter) {
+		i.args = args
+	}
+}
+
 // New constructs a new Interpreter with the given options.
 func New(opts ...Option) *Interpreter {
-	globals := newEnvironment()
+	builtinsEnv := newEnvironment()
 	for _, fun := range builtins {
-		globals.Set(fun.Name(), fun)
+		builtinsEnv.Set(fun.Name(), fun)
 	}
 	interpreter := &Interpreter{
-		globals:            globals,
-		declDistancesByTok: map[token.Token]int{},
+		builtins:            builtinsEnv,
+		localsByTok:         map[token.Token]resolver.Local{},
+		modulesByPath:       map[string]*loxModule{},
+		nativeModulesByName: map[string]*loxModule{},
+		maxCallDepth:        DefaultMaxCallDepth,
+		stdout:              lox.NewLineWriter(os.Stdout),
+		stderr:              os.Stderr,
+		stdin:               bufio.NewReader(os.Stdin),
+		ctx:                 context.Background(),
 	}
+	interpreter.interpretPrelude()
+	interpreter.globals = interpreter.newGlobals()
 	for _, opt := range opts {
 		opt(interpreter)
 	}
@@ -47,24 +137,94 @@ func New(opts ...Option) *Interpreter {
 }
 
 // Interpret interprets a program and returns an error if one occurred.
+// If the program calls the exit built-in function, then a [*lox.ExitError] is returned.
 // Interpret can be called multiple times with different ASTs and the state will be maintained between calls.
-func (i *Interpreter) Interpret(program ast.Program) (err error) {
+func (i *Interpreter) Interpret(program ast.Program) error {
+	return i.InterpretContext(context.Background(), program)
+}
+
+// InterpretContext is like [*Interpreter.Interpret] but execution is interrupted with an [*InterruptedError] wrapping
+// ctx.Err() if ctx is done before the program has finished.
+func (i *Interpreter) InterpretContext(ctx context.Context, program ast.Program) (err error) {
+	defer i.startExecution(ctx)()
 	defer func() {
 		if r := recover(); r != nil {
-			if loxErr, ok := r.(*lox.Error); ok {
-				err = loxErr
-			} else {
-				panic(r)
-			}
+			err = i.errorFromPanic(r, 0)
+		}
+		if flushErr := i.stdout.Flush(); err == nil {
+			err = flushErr
 		}
 	}()
-	declDistancesByTok, err := resolve(program)
-	if err != nil {
-		return err
+	return i.interpretProgram(i.globals, program)
+}
+
+// Stdout returns the writer which program output is written to. Native functions should write their output to it, so
+// that it's interleaved correctly with the output of print statements.
+func (i *Interpreter) Stdout() io.Writer {
+	return i.stdout
+}
+
+// Stderr returns the writer which diagnostics are written to. Native functions should write warnings to it, and errors
+// returned by the interpreter can be reported to it. Output is flushed before it's returned, so that diagnostics are
+// displayed after any output which has been printed before them.
+func (i *Interpreter) Stderr() io.Writer {
+	_ = i.stdout.Flush()
+	return i.stderr
+}
+
+// Stdin returns the reader which input is read from. Output is flushed before it's returned, so that any prompt which
+// has been printed is displayed before input is read.
+func (i *Interpreter) Stdin() io.Reader {
+	_ = i.stdout.Flush()
+	return i.stdin
+}
+
+// errorFromPanic returns the error which should be reported for a value which was recovered from a panic during
+// execution and truncates the call stack to the depth that it had when execution started. Values which weren't
+// panicked because of an error in the program are panicked again.
+func (i *Interpreter) errorFromPanic(r any, callDepth int) error {
+	traceback := i.traceback()
+	i.callStack = i.callStack[:callDepth]
+	switch r := r.(type) {
+	case *lox.Error:
+		return r.WithTraceback(traceback)
+	case thrownValue:
+		return lox.NewErrorFromNode(r.node, "%s", i.uncaughtMessage(r.value)).(*lox.Error).WithTraceback(traceback)
+	case moduleError:
+		return r.err
+	case nativeError:
+		return r.err
+	case *InterruptedError:
+		return r
+	case *lox.ExitError:
+		return r
+	default:
+		panic(r)
 	}
-	maps.Copy(i.declDistancesByTok, declDistancesByTok)
-	i.interpretProgram(program)
-	return nil
+}
+
+// DumpGlobals returns a description of the global declarations, including the built-in ones, with one declaration per
+// line.
+func (i *Interpreter) DumpGlobals() string {
+	return i.globals.String()
+}
+
+// traceback returns the calls which are currently in progress, ordered from the outermost call to the innermost.
+func (i *Interpreter) traceback() []lox.StackFrame {
+	traceback := make([]lox.StackFrame, len(i.callStack))
+	for j, frame := range i.callStack {
+		traceback[j] = lox.StackFrame{Name: frame.name, Call: frame.pos}
+	}
+	return traceback
+}
+
+// newGlobals returns a new global environment for a module which contains the built-in declarations.
+func (i *Interpreter) newGlobals() *environment {
+	globals := newEnvironment()
+	for ident, value := range i.builtins.valuesByIdent {
+		globals.Set(ident, value)
+	}
+	return globals
 }
 
 type stmtResult interface {
@@ -89,13 +249,25 @@ type stmtResultReturn struct {
 
 func (stmtResultReturn) stmtResult() {}
 
-func (i *Interpreter) interpretProgram(node ast.Program) {
-	for _, stmt := range node.Stmts {
-		i.execStmt(i.globals, stmt)
+// interpretProgram resolves and then executes a program in the given global environment. An error is returned if
+// the program could not be resolved.
+func (i *Interpreter) interpretProgram(globals *environment, program ast.Program) error {
+	localsByTok, err := resolver.Resolve(program)
+	if err != nil {
+		return err
+	}
+	maps.Copy(i.localsByTok, localsByTok)
+	for _, stmt := range program.Stmts {
+		i.execStmt(globals, stmt)
 	}
+	return nil
 }
 
 func (i *Interpreter) execStmt(env *environment, stmt ast.Stmt) stmtResult {
+	i.stmts++
+	if i.debugger != nil {
+		i.debugger.beforeStmt(i, env, stmt)
+	}
 	switch stmt := stmt.(type) {
 	case ast.VarDecl:
 		i.execVarDecl(env, stmt)
@@ -103,6 +275,8 @@ func (i *Interpreter) execStmt(env *environment, stmt ast.Stmt) stmtResult {
 		i.execFunDecl(env, stmt)
 	case ast.ClassDecl:
 		i.execClassDecl(env, stmt)
+	case ast.ImportDecl:
+		i.execImportDecl(env, stmt)
 	case ast.ExprStmt:
 		i.execExprStmt(env, stmt)
 	case ast.PrintStmt:
@@ -121,6 +295,10 @@ func (i *Interpreter) execStmt(env *environment, stmt ast.Stmt) stmtResult {
 		return i.execContinueStmt()
 	case ast.ReturnStmt:
 		return i.execReturnStmt(env, stmt)
+	case ast.ThrowStmt:
+		i.execThrowStmt(env, stmt)
+	case ast.TryStmt:
+		return i.execTryStmt(env, stmt)
 	default:
 		panic(fmt.Sprintf("unexpected statement type: %T", stmt))
 	}
@@ -128,6 +306,7 @@ func (i *Interpreter) execStmt(env *environment, stmt ast.Stmt) stmtResult {
 }
 
 func (i *Interpreter) execVarDecl(env *environment, stmt ast.VarDecl) {
+	i.allocate(stmt, variableSize)
 	if stmt.Initialiser != nil {
 		env.Define(stmt.Name, i.evalExpr(env, stmt.Initialiser))
 	} else {
@@ -136,10 +315,25 @@ func (i *Interpreter) execVarDecl(env *environment, stmt ast.VarDecl) {
 }
 
 func (i *Interpreter) execFunDecl(env *environment, stmt ast.FunDecl) {
+	i.allocate(stmt, variableSize+closureSize)
 	env.Define(stmt.Name, newLoxFunction(stmt.Name.Lexeme, stmt.Params, stmt.Body, funTypeFunction, env))
 }
 
 func (i *Interpreter) execClassDecl(env *environment, stmt ast.ClassDecl) {
+	var superclass *loxClass
+	methodEnv := env
+	if stmt.Superclass != nil {
+		object := i.evalExpr(env, stmt.Superclass)
+		class, ok := object.(*loxClass)
+		if !ok {
+			panic(lox.NewErrorFromNode(stmt.Superclass, "%m object cannot be used as a superclass", object.Type()))
+		}
+		superclass = class
+		i.allocate(stmt, environmentSize+variableSize)
+		methodEnv = env.Child()
+		methodEnv.Set(token.SuperIdent, superclass)
+	}
+	i.allocate(stmt, variableSize+closureSize*len(stmt.Body))
 	methodsByName := make(map[string]*loxFunction, len(stmt.Body))
 	for _, methodDecl := range stmt.Body {
 		typ := funTypeMethod
@@ -147,24 +341,25 @@ func (i *Interpreter) execClassDecl(env *environment, stmt ast.ClassDecl) {
 			typ = funTypeInit
 		}
 		name := stmt.Name.Lexeme + "." + methodDecl.Name.Lexeme
-		methodsByName[methodDecl.Name.Lexeme] = newLoxFunction(name, methodDecl.Params, methodDecl.Body, typ, env)
+		methodsByName[methodDecl.Name.Lexeme] = newLoxFunction(name, methodDecl.Params, methodDecl.Body, typ, methodEnv)
 	}
-	env.Define(stmt.Name, newLoxClass(stmt.Name.Lexeme, methodsByName))
+	env.Define(stmt.Name, newLoxClass(stmt.Name.Lexeme, superclass, methodsByName))
 }
 
 func (i *Interpreter) execExprStmt(env *environment, stmt ast.ExprStmt) {
 	value := i.evalExpr(env, stmt.Expr)
 	if i.printExprStmtResults {
-		fmt.Println(value.String())
+		fmt.Fprintln(i.stdout, value.String())
 	}
 }
 
 func (i *Interpreter) execPrintStmt(env *environment, stmt ast.PrintStmt) {
 	value := i.evalExpr(env, stmt.Expr)
-	fmt.Println(value.String())
+	fmt.Fprintln(i.stdout, value.String())
 }
 
 func (i *Interpreter) execBlockStmt(env *environment, stmt ast.BlockStmt) stmtResult {
+	i.allocate(stmt, environmentSize)
 	return i.executeBlock(env.Child(), stmt.Stmts)
 }
 
@@ -191,6 +386,7 @@ func (i *Interpreter) execIfStmt(env *environment, stmt ast.IfStmt) stmtResult {
 
 func (i *Interpreter) execWhileStmt(env *environment, stmt ast.WhileStmt) stmtResult {
 	for isTruthy(i.evalExpr(env, stmt.Condition)) {
+		i.checkInterrupted(stmt)
 		switch result := i.execStmt(env, stmt.Body).(type) {
 		case stmtResultBreak:
 			return stmtResultNone{}
@@ -202,11 +398,13 @@ func (i *Interpreter) execWhileStmt(env *environment, stmt ast.WhileStmt) stmtRe
 }
 
 func (i *Interpreter) execForStmt(env *environment, stmt ast.ForStmt) stmtResult {
+	i.allocate(stmt, environmentSize)
 	childEnv := env.Child()
 	if stmt.Initialise != nil {
 		i.execStmt(childEnv, stmt.Initialise)
 	}
 	for stmt.Condition == nil || isTruthy(i.evalExpr(childEnv, stmt.Condition)) {
+		i.checkInterrupted(stmt)
 		switch result := i.execStmt(childEnv, stmt.Body).(type) {
 		case stmtResultBreak:
 			return stmtResultNone{}
@@ -236,6 +434,131 @@ func (i *Interpreter) execReturnStmt(env *environment, stmt ast.ReturnStmt) stmt
 	return stmtResultReturn{Value: value}
 }
 
+// thrownValue is used as a panic value to unwind the stack when a value is thrown by a throw statement.
+type thrownValue struct {
+	value loxObject
+	node  ast.Node // expression that the value was evaluated from
+}
+
+func isStmtResultNone(result stmtResult) bool {
+	_, ok := result.(stmtResultNone)
+	return ok
+}
+
+func (i *Interpreter) execThrowStmt(env *environment, stmt ast.ThrowStmt) {
+	value := i.evalExpr(env, stmt.Value)
+	if instance, ok := value.(*loxInstance); ok && i.isErrorInstance(instance) {
+		if _, ok := instance.fieldValuesByName[errorLineField]; !ok {
+			i.setErrorPosition(instance, stmt.Value.Start())
+		}
+	}
+	panic(thrownValue{value: value, node: stmt.Value})
+}
+
+func (i *Interpreter) execTryStmt(env *environment, stmt ast.TryStmt) (result stmtResult) {
+	if stmt.FinallyBody != nil {
+		callDepth := len(i.callStack)
+		defer func() {
+			r := recover()
+			// The call stack is restored if the exception is re-raised, so the capacity is limited to stop any calls
+			// made by the finally block from overwriting it.
+			callStack := i.callStack
+			i.callStack = i.callStack[:callDepth:callDepth]
+			// A break, continue, or return in the finally block takes precedence over anything that happened in the
+			// try or catch blocks, including an exception being raised. Interrupting or exiting the program can't be
+			// stopped by a finally block though, so they always continue to unwind the stack.
+			finallyResult := i.execStmt(env, stmt.FinallyBody)
+			switch r.(type) {
+			case *InterruptedError, *lox.ExitError:
+			default:
+				if !isStmtResultNone(finallyResult) {
+					result = finallyResult
+					return
+				}
+			}
+			if r != nil {
+				i.callStack = callStack
+				panic(r)
+			}
+		}()
+	}
+	if stmt.CatchBody == nil {
+		return i.execStmt(env, stmt.Body)
+	}
+	result, caught := i.execCatchingErrors(env, stmt.Body)
+	if caught == nil {
+		return result
+	}
+	i.allocate(stmt.CatchBody, environmentSize+variableSize)
+	catchEnv := env.Child()
+	catchEnv.Define(stmt.CatchIdent, caught)
+	return i.execStmt(catchEnv, stmt.CatchBody)
+}
+
+// execCatchingErrors executes a statement and returns its result. If a value is thrown or a runtime error is raised
+// whilst executing the statement, then it's returned as the second result instead. Runtime errors are returned as
+// instances of the Error class.
+func (i *Interpreter) execCatchingErrors(env *environment, stmt ast.Stmt) (result stmtResult, caught loxObject) {
+	callDepth := len(i.callStack)
+	defer func() {
+		r := recover()
+		if r != nil {
+			i.callStack = i.callStack[:callDepth]
+		}
+		switch r := r.(type) {
+		case nil:
+		case thrownValue:
+			caught = r.value
+		case *lox.Error:
+			caught = i.newErrorInstance(r.Message(), r.Start())
+		default:
+			panic(r)
+		}
+	}()
+	return i.execStmt(env, stmt), nil
+}
+
+const (
+	errorMessageField = "message"
+	errorLineField    = "line"
+	errorColumnField  = "column"
+)
+
+// newErrorInstance returns an instance of the Error class with the given message and position. Its fields are set
+// directly, rather than by calling init, so that creating it can't raise another error, such as when the error being
+// caught is that the memory limit has been exceeded.
+func (i *Interpreter) newErrorInstance(msg string, pos token.Position) *loxInstance {
+	instance := newLoxInstance(i.errorClass)
+	instance.Set(token.Token{Lexeme: errorMessageField}, loxString(msg))
+	i.setErrorPosition(instance, pos)
+	return instance
+}
+
+func (i *Interpreter) setErrorPosition(instance *loxInstance, pos token.Position) {
+	instance.Set(token.Token{Lexeme: errorLineField}, loxNumber(pos.Line))
+	instance.Set(token.Token{Lexeme: errorColumnField}, loxNumber(pos.DisplayColumn()))
+}
+
+// isErrorInstance reports whether an instance is an instance of the Error class or one of its subclasses.
+func (i *Interpreter) isErrorInstance(instance *loxInstance) bool {
+	for class := instance.class; class != nil; class = class.superclass {
+		if class == i.errorClass {
+			return true
+		}
+	}
+	return false
+}
+
+// uncaughtMessage returns the message to report when a thrown value is not caught.
+func (i *Interpreter) uncaughtMessage(value loxObject) string {
+	if instance, ok := value.(*loxInstance); ok && i.isErrorInstance(instance) {
+		if msg, ok := instance.fieldValuesByName[errorMessageField]; ok {
+			return fmt.Sprintf("%s: %s", instance.class.Name(), msg)
+		}
+	}
+	return fmt.Sprintf("uncaught exception: %s", value)
+}
+
 func (i *Interpreter) evalExpr(env *environment, expr ast.Expr) loxObject {
 	switch expr := expr.(type) {
 	case ast.FunExpr:
@@ -244,14 +567,26 @@ func (i *Interpreter) evalExpr(env *environment, expr ast.Expr) loxObject {
 		return i.evalGroupExpr(env, expr)
 	case ast.LiteralExpr:
 		return i.evalLiteralExpr(expr)
+	case ast.InterpolationExpr:
+		return i.evalInterpolationExpr(env, expr)
+	case ast.ListExpr:
+		return i.evalListExpr(env, expr)
+	case ast.MapExpr:
+		return i.evalMapExpr(env, expr)
 	case ast.VariableExpr:
 		return i.evalVariableExpr(env, expr)
 	case ast.ThisExpr:
 		return i.evalThisExpr(env, expr)
+	case ast.SuperExpr:
+		return i.evalSuperExpr(env, expr)
 	case ast.CallExpr:
 		return i.evalCallExpr(env, expr)
 	case ast.GetExpr:
 		return i.evalGetExpr(env, expr)
+	case ast.IndexExpr:
+		return i.evalIndexExpr(env, expr)
+	case ast.SliceExpr:
+		return i.evalSliceExpr(env, expr)
 	case ast.UnaryExpr:
 		return i.evalUnaryExpr(env, expr)
 	case ast.BinaryExpr:
@@ -262,12 +597,15 @@ func (i *Interpreter) evalExpr(env *environment, expr ast.Expr) loxObject {
 		return i.evalAssignmentExpr(env, expr)
 	case ast.SetExpr:
 		return i.evalSetExpr(env, expr)
+	case ast.IndexSetExpr:
+		return i.evalIndexSetExpr(env, expr)
 	default:
 		panic(fmt.Sprintf("unexpected expression type: %T", expr))
 	}
 }
 
 func (i *Interpreter) evalFunExpr(env *environment, expr ast.FunExpr) loxObject {
+	i.allocate(expr, closureSize)
 	return newLoxFunction("(anonymous)", expr.Params, expr.Body, funTypeFunction, env)
 }
 
@@ -283,8 +621,8 @@ func (i *Interpreter) evalLiteralExpr(expr ast.LiteralExpr) loxObject {
 			panic(fmt.Sprintf("unexpected error parsing number literal: %s", err))
 		}
 		return loxNumber(value)
-	case token.String:
-		return loxString(tok.Lexeme[1 : len(tok.Lexeme)-1]) // Remove surrounding quotes
+	case token.String, token.StringHead, token.StringMiddle, token.StringTail:
+		return loxString(tok.Literal)
 	case token.True, token.False:
 		return loxBool(tok.Type == token.True)
 	case token.Nil:
@@ -294,6 +632,38 @@ func (i *Interpreter) evalLiteralExpr(expr ast.LiteralExpr) loxObject {
 	}
 }
 
+func (i *Interpreter) evalInterpolationExpr(env *environment, expr ast.InterpolationExpr) loxObject {
+	// Each part is accounted for as soon as it's been converted to a string, so that the limit is exceeded before the
+	// parts are joined.
+	i.allocate(expr, stringSize)
+	parts := make([]string, len(expr.Parts))
+	for j, part := range expr.Parts {
+		parts[j] = i.evalExpr(env, part).String()
+		i.allocate(expr, len(parts[j]))
+	}
+	return loxString(strings.Join(parts, ""))
+}
+
+func (i *Interpreter) evalListExpr(env *environment, expr ast.ListExpr) loxObject {
+	i.allocate(expr, listSize+elementSize*len(expr.Elements))
+	elements := make([]loxObject, len(expr.Elements))
+	for j, element := range expr.Elements {
+		elements[j] = i.evalExpr(env, element)
+	}
+	return newLoxList(elements)
+}
+
+func (i *Interpreter) evalMapExpr(env *environment, expr ast.MapExpr) loxObject {
+	i.allocate(expr, mapSize)
+	m := newLoxMap()
+	for _, entry := range expr.Entries {
+		key := i.evalExpr(env, entry.Key)
+		value := i.evalExpr(env, entry.Value)
+		m.Set(i, entry.Key, key, value)
+	}
+	return m
+}
+
 func (i *Interpreter) evalVariableExpr(env *environment, expr ast.VariableExpr) loxObject {
 	return i.resolveIdent(env, expr.Name)
 }
@@ -302,12 +672,27 @@ func (i *Interpreter) evalThisExpr(env *environment, expr ast.ThisExpr) loxObjec
 	return i.resolveIdent(env, expr.This)
 }
 
+func (i *Interpreter) evalSuperExpr(env *environment, expr ast.SuperExpr) loxObject {
+	local, ok := i.localsByTok[expr.Super]
+	if !ok {
+		panic(fmt.Sprintf("%s has not been resolved", expr.Super))
+	}
+	superclass := env.GetAt(local, expr.Super).(*loxClass)
+	// The environment which this is defined in is always the child of the one which super is defined in
+	instance := env.ancestor(local.Depth - 1).GetByIdent(token.ThisIdent).(*loxInstance)
+	method, ok := superclass.GetMethod(expr.Method.Lexeme)
+	if !ok {
+		panic(lox.NewErrorFromToken(expr.Method, "superclass %s has no method %s", superclass.Name(), expr.Method.Lexeme))
+	}
+	i.allocate(expr, boundMethodSize)
+	return method.Bind(instance)
+}
+
 func (i *Interpreter) resolveIdent(env *environment, tok token.Token) loxObject {
-	distance, ok := i.declDistancesByTok[tok]
-	if ok {
-		return env.GetAt(distance, tok)
+	if local, ok := i.localsByTok[tok]; ok {
+		return env.GetAt(local, tok)
 	}
-	return i.globals.Get(tok)
+	return env.globals.Get(tok)
 }
 
 func (i *Interpreter) evalCallExpr(env *environment, expr ast.CallExpr) loxObject {
@@ -322,15 +707,29 @@ func (i *Interpreter) evalCallExpr(env *environment, expr ast.CallExpr) loxObjec
 		panic(lox.NewErrorFromNode(expr.Callee, "%m object is not callable", callee.Type()))
 	}
 
+	if msg, tooMany := arityError(callable, len(args)); msg != "" {
+		if tooMany {
+			panic(lox.NewErrorFromNodeRange(expr.Args[len(callable.Params())], expr.Args[len(args)-1], "%s", msg))
+		}
+		panic(lox.NewErrorFromNode(expr, "%s", msg))
+	}
+
+	return i.call(expr, callable, args)
+}
+
+// arityError returns the message of the error which is raised when callable is called with argCount arguments, or an
+// empty string if it accepts that many. tooMany reports whether the error is that too many arguments were given rather
+// than too few.
+func arityError(callable loxCallable, argCount int) (msg string, tooMany bool) {
 	params := callable.Params()
 	arity := len(params)
 	switch {
-	case len(args) < arity:
+	case argCount < arity:
 		argumentSuffix := ""
-		if arity-len(args) > 1 {
+		if arity-argCount > 1 {
 			argumentSuffix = "s"
 		}
-		missingArgs := params[len(args):]
+		missingArgs := params[argCount:]
 		var missingArgsStr string
 		switch len(missingArgs) {
 		case 1:
@@ -340,28 +739,83 @@ func (i *Interpreter) evalCallExpr(env *environment, expr ast.CallExpr) loxObjec
 		default:
 			missingArgsStr = strings.Join(missingArgs[:len(missingArgs)-1], ", ") + ", and " + missingArgs[len(missingArgs)-1]
 		}
-		panic(lox.NewErrorFromNode(
-			expr,
-			"%s() missing %d argument%s: %s", callable.Name(), arity-len(args), argumentSuffix, missingArgsStr,
-		))
-	case len(args) > arity:
-		panic(lox.NewErrorFromNodeRange(
-			expr.Args[arity],
-			expr.Args[len(args)-1],
-			"%s() accepts %d arguments but %d were given", callable.Name(), arity, len(args),
-		))
+		return fmt.Sprintf("%s() missing %d argument%s: %s", callable.Name(), arity-argCount, argumentSuffix,
+			missingArgsStr), false
+	case argCount > arity && !isVariadic(callable):
+		return fmt.Sprintf("%s() accepts %d arguments but %d were given", callable.Name(), arity, argCount), true
+	default:
+		return "", false
 	}
+}
 
-	return callable.Call(i, args)
+// call calls a callable with arguments which have already been checked against its parameters. node is the call
+// expression, or the expression which caused the call if it was made implicitly, such as a call to a hash method. The
+// call is recorded in the call stack and counts towards the maximum call depth.
+func (i *Interpreter) call(node ast.Node, callable loxCallable, args []loxObject) loxObject {
+	i.checkInterrupted(node)
+	i.allocate(node, callSize(callable))
+	if len(i.callStack) >= i.maxCallDepth {
+		panic(lox.NewErrorFromNode(node, "stack overflow"))
+	}
+	// The frame isn't popped if the call panics so that the call stack can be included in the traceback of an
+	// uncaught error. Anywhere that recovers from a panic is responsible for truncating the call stack instead.
+	i.callStack = append(i.callStack, callFrame{name: callable.Name(), pos: node.Start()})
+	var result loxObject
+	if builtin, ok := callable.(*loxBuiltinFunction); ok {
+		call, _ := node.(ast.CallExpr)
+		result = builtin.CallFrom(i, call, args)
+	} else {
+		result = callable.Call(i, args)
+	}
+	i.callStack = i.callStack[:len(i.callStack)-1]
+	return result
+}
+
+// isVariadic reports whether a callable accepts any number of arguments after its parameters.
+func isVariadic(callable loxCallable) bool {
+	builtin, ok := callable.(*loxBuiltinFunction)
+	return ok && builtin.variadic
 }
 
 func (i *Interpreter) evalGetExpr(env *environment, expr ast.GetExpr) loxObject {
 	object := i.evalExpr(env, expr.Object)
-	instance, ok := object.(*loxInstance)
+	accessor, ok := object.(loxPropertyAccessor)
 	if !ok {
 		panic(lox.NewError(expr.Object.Start(), expr.Name.End, "property access is not valid for %m object", object.Type()))
 	}
-	return instance.Get(expr.Name)
+	if instance, ok := object.(*loxInstance); ok {
+		if _, ok := instance.fieldValuesByName[expr.Name.Lexeme]; !ok {
+			// Accessing a method binds it to the instance.
+			i.allocate(expr, boundMethodSize)
+		}
+	}
+	return accessor.Get(expr.Name)
+}
+
+func (i *Interpreter) evalIndexExpr(env *environment, expr ast.IndexExpr) loxObject {
+	object := i.evalExpr(env, expr.Object)
+	indexable, ok := object.(loxIndexable)
+	if !ok {
+		panic(lox.NewErrorFromNode(expr, "indexing is not valid for %m object", object.Type()))
+	}
+	index := i.evalExpr(env, expr.Index)
+	return indexable.Index(i, expr, index)
+}
+
+func (i *Interpreter) evalSliceExpr(env *environment, expr ast.SliceExpr) loxObject {
+	object := i.evalExpr(env, expr.Object)
+	sliceable, ok := object.(loxSliceable)
+	if !ok {
+		panic(lox.NewErrorFromNode(expr, "slicing is not valid for %m object", object.Type()))
+	}
+	var low, high loxObject
+	if expr.Low != nil {
+		low = i.evalExpr(env, expr.Low)
+	}
+	if expr.High != nil {
+		high = i.evalExpr(env, expr.High)
+	}
+	return sliceable.Slice(i, expr, low, high)
 }
 
 func (i *Interpreter) evalUnaryExpr(env *environment, expr ast.UnaryExpr) loxObject {
@@ -415,7 +869,7 @@ func (i *Interpreter) evalBinaryExpr(env *environment, expr ast.BinaryExpr) loxO
 	default:
 		binaryOperand, ok := left.(loxBinaryOperand)
 		if ok {
-			if result := binaryOperand.BinaryOp(expr.Op, right); result != nil {
+			if result := binaryOperand.BinaryOp(i, expr, right); result != nil {
 				return result
 			}
 		}
@@ -433,11 +887,10 @@ func (i *Interpreter) evalTernaryExpr(env *environment, expr ast.TernaryExpr) lo
 
 func (i *Interpreter) evalAssignmentExpr(env *environment, expr ast.AssignmentExpr) loxObject {
 	value := i.evalExpr(env, expr.Right)
-	distance, ok := i.declDistancesByTok[expr.Left]
-	if ok {
-		env.AssignAt(distance, expr.Left, value)
+	if local, ok := i.localsByTok[expr.Left]; ok {
+		env.AssignAt(local, value)
 	} else {
-		i.globals.Assign(expr.Left, value)
+		env.globals.Assign(expr.Left, value)
 	}
 	return value
 }
@@ -449,10 +902,25 @@ func (i *Interpreter) evalSetExpr(env *environment, expr ast.SetExpr) loxObject
 		panic(lox.NewErrorFromNodeRange(expr.Object, expr.Value, "property assignment is not valid for %m object", object.Type()))
 	}
 	value := i.evalExpr(env, expr.Value)
+	if _, ok := instance.fieldValuesByName[expr.Name.Lexeme]; !ok {
+		i.allocate(expr, fieldSize)
+	}
 	instance.Set(expr.Name, value)
 	return value
 }
 
+func (i *Interpreter) evalIndexSetExpr(env *environment, expr ast.IndexSetExpr) loxObject {
+	object := i.evalExpr(env, expr.Object)
+	indexable, ok := object.(loxIndexable)
+	if !ok {
+		panic(lox.NewErrorFromNodeRange(expr.Object, expr.Value, "index assignment is not valid for %m object", object.Type()))
+	}
+	index := i.evalExpr(env, expr.Index)
+	value := i.evalExpr(env, expr.Value)
+	indexable.SetIndex(i, expr, index, value)
+	return value
+}
+
 func isTruthy(obj loxObject) loxBool {
 	if truther, ok := obj.(loxTruther); ok {
 		return truther.IsTruthy()
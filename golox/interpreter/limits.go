@@ -0,0 +1,88 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// ErrMaxStatementsExceeded is the cause of an [*InterruptedError] which is returned when a program executes more
+// statements than the limit set with [MaxStatements].
+var ErrMaxStatementsExceeded = errors.New("maximum number of statements exceeded")
+
+// InterruptedError is returned when execution is stopped before a program has finished, because its context was
+// cancelled, its timeout expired, or it executed too many statements. Unlike a runtime error, it can't be caught by a
+// try statement.
+type InterruptedError struct {
+	Err error          // cause of the interruption, such as context.DeadlineExceeded or ErrMaxStatementsExceeded
+	Pos token.Position // position of the loop or call which was about to be executed
+}
+
+func (e *InterruptedError) Error() string {
+	if e.Pos.File == nil {
+		return fmt.Sprintf("execution interrupted: %s", e.Err)
+	}
+	return fmt.Sprintf("%s: execution interrupted: %s", e.Pos, e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// MaxStatements sets the maximum number of statements which can be executed by each call to
+// [*Interpreter.InterpretContext], [*Interpreter.Interpret], or [*Interpreter.Call]. Execution is interrupted with an
+// [*InterruptedError] wrapping [ErrMaxStatementsExceeded] at the next loop iteration or call after the limit is
+// exceeded. A limit of 0, which is the default, means that there's no limit.
+func MaxStatements(n int) Option {
+	return func(i *Interpreter) {
+		i.maxStmts = n
+	}
+}
+
+// Timeout sets the maximum duration of each call to [*Interpreter.InterpretContext], [*Interpreter.Interpret], or
+// [*Interpreter.Call]. Execution is interrupted with an [*InterruptedError] wrapping [context.DeadlineExceeded] at the
+// next loop iteration or call after it expires. A timeout of 0, which is the default, means that there's no timeout.
+func Timeout(d time.Duration) Option {
+	return func(i *Interpreter) {
+		i.timeout = d
+	}
+}
+
+// startExecution sets the context which execution is interrupted by, applying the timeout if there is one, and resets
+// the number of executed statements and allocated bytes. It returns a function which restores the previous state, so
+// that executions can be nested, for example when a native function calls [*Interpreter.Call].
+func (i *Interpreter) startExecution(ctx context.Context) (restore func()) {
+	prevCtx, prevDone, prevStmts, prevAllocated := i.ctx, i.done, i.stmts, i.allocated
+	cancel := context.CancelFunc(func() {})
+	if i.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+	}
+	i.ctx, i.done, i.stmts, i.allocated = ctx, ctx.Done(), 0, 0
+	return func() {
+		cancel()
+		// A nested execution counts towards the limits of the one which it's nested in.
+		i.ctx, i.done, i.stmts, i.allocated = prevCtx, prevDone, prevStmts+i.stmts, prevAllocated+i.allocated
+	}
+}
+
+// checkInterrupted raises an [*InterruptedError] if execution should be interrupted. node is the loop or call which is
+// about to be executed.
+func (i *Interpreter) checkInterrupted(node ast.Node) {
+	if i.maxStmts > 0 && i.stmts > i.maxStmts {
+		panic(&InterruptedError{Err: ErrMaxStatementsExceeded, Pos: node.Start()})
+	}
+	// The context of an execution which can't be interrupted, such as context.Background(), has no Done channel, in
+	// which case the select can be skipped.
+	if i.done == nil {
+		return
+	}
+	select {
+	case <-i.done:
+		panic(&InterruptedError{Err: i.ctx.Err(), Pos: node.Start()})
+	default:
+	}
+}
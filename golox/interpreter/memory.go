@@ -0,0 +1,73 @@
+package interpreter
+
+import (
+	"math"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+)
+
+// Approximate sizes in bytes of the objects whose allocations are accounted for. They include the overhead of the Go
+// values which represent them, so that a program can't allocate lots of small objects for free.
+const (
+	stringSize      = 16 // size of a string, excluding its contents
+	instanceSize    = 64 // size of an instance, excluding its fields
+	fieldSize       = 48 // size of each field of an instance
+	closureSize     = 96 // size of a function and the reference to its enclosing environment
+	environmentSize = 80 // size of an environment, excluding its variables
+	variableSize    = 32 // size of each variable in an environment
+	listSize        = 32 // size of a list, excluding its elements
+	elementSize     = 16 // size of each element of a list
+	mapSize         = 64 // size of a map, excluding its entries
+	mapEntrySize    = 64 // size of each entry of a map, including its index
+
+	boundMethodSize = closureSize + environmentSize + variableSize // size of a method which is bound to this
+)
+
+// maxAllocationSize is the largest size that's accounted for a single allocation, which stops the total from
+// overflowing.
+const maxAllocationSize = math.MaxInt32
+
+// MaxMemory sets the approximate maximum number of bytes which can be allocated for strings, lists, maps, instances,
+// closures, and environments by each call to [*Interpreter.InterpretContext], [*Interpreter.Interpret], or
+// [*Interpreter.Call]. Memory which is no longer used isn't subtracted from the total, so the limit applies to
+// everything that's allocated rather than what's in use at any one time. A limit of 0, which is the default, means that
+// there's no limit.
+//
+// An allocation which would exceed the limit raises a runtime error at the expression or statement which caused it,
+// before any memory is allocated. Like any other runtime error, it can be caught by a try statement. The allocation
+// isn't counted towards the limit, so the program can carry on allocating smaller objects afterwards, and the Error
+// instance which is caught isn't counted either.
+func MaxMemory(bytes int) Option {
+	return func(i *Interpreter) {
+		i.maxMemory = bytes
+	}
+}
+
+// allocate records that size bytes are about to be allocated by the given node and raises an error if this would
+// exceed the memory limit. Allocations aren't recorded if there's no limit.
+func (i *Interpreter) allocate(node ast.Node, size int) {
+	if i.maxMemory == 0 {
+		return
+	}
+	if size > i.maxMemory-i.allocated {
+		panic(lox.NewErrorFromNode(node, "memory limit of %d bytes exceeded", i.maxMemory))
+	}
+	i.allocated += size
+}
+
+// callSize returns the size of the objects which are allocated by calling a callable.
+func callSize(callable loxCallable) int {
+	switch callable := callable.(type) {
+	case *loxFunction:
+		return environmentSize + variableSize*len(callable.params)
+	case *loxClass:
+		size := instanceSize
+		if callable.init != nil {
+			size += boundMethodSize + callSize(callable.init)
+		}
+		return size
+	default:
+		return 0
+	}
+}
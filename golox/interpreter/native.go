@@ -0,0 +1,103 @@
+package interpreter
+
+import (
+	"errors"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+)
+
+// NativeFunction is a function which is implemented in Go and can be called from Lox. It's registered with
+// [NativeFunctions] or [NativeModule].
+type NativeFunction struct {
+	Name     string
+	Params   []string
+	Variadic bool // whether the function accepts any number of arguments after Params
+	Body     NativeFunc
+}
+
+// NativeFunc is the body of a [NativeFunction]. It's passed one argument for each parameter, followed by any extra
+// arguments if the function is variadic.
+//
+// call is the expression which called the function and can be used to report errors, for example with
+// [lox.NewErrorFromNode]. If the function was called with [*Interpreter.Call], then call is the zero value and any
+// error is returned to the caller as it is.
+//
+// If a [*lox.Error] is returned, then it's raised as a runtime error. Any other error is raised as a runtime error at
+// the call expression with the error's message. Either can be caught by a try statement. The exception is an
+// [*InterruptedError] or [*lox.ExitError] returned by [*Interpreter.Call], which stops the program as it would have if
+// it had been raised by Lox code.
+type NativeFunc func(i *Interpreter, call ast.CallExpr, args []Value) (Value, error)
+
+// nativeError is used as a panic value to unwind the stack when a built-in function which was called with
+// [*Interpreter.Call] returns an error. There's no call expression to report the error at, so it's returned to the
+// caller as it is.
+type nativeError struct {
+	err error
+}
+
+// NativeFunctions registers native functions as built-in functions, which are available in every module.
+// It panics if a built-in function with the same name already exists.
+func NativeFunctions(fns ...NativeFunction) Option {
+	return func(i *Interpreter) {
+		for _, fn := range fns {
+			builtin := newNativeFunction(fn)
+			i.builtins.Set(fn.Name, builtin)
+			i.globals.Set(fn.Name, builtin)
+		}
+	}
+}
+
+// NativeModule registers a module of native functions which is imported with the given name instead of a path. For
+// example, a module registered with the name "math" is imported with
+//
+//	import "math" as math;
+//
+// It panics if the module contains two functions with the same name.
+func NativeModule(name string, fns ...NativeFunction) Option {
+	return func(i *Interpreter) {
+		globals := newEnvironment()
+		for _, fn := range fns {
+			globals.Set(fn.Name, newNativeFunction(fn))
+		}
+		// All of the functions are exported, even if they have the same name as a built-in function.
+		i.nativeModulesByName[name] = newLoxModule(name, globals, newEnvironment())
+	}
+}
+
+func newNativeFunction(fn NativeFunction) *loxBuiltinFunction {
+	body := func(i *Interpreter, call ast.CallExpr, args []loxObject) loxObject {
+		values := make([]Value, len(args))
+		for j, arg := range args {
+			values[j] = newValue(arg)
+		}
+		result, err := fn.Body(i, call, values)
+		if err != nil {
+			raiseAt(call, err)
+		}
+		return result.loxObject()
+	}
+	return newLoxBuiltinFunction(fn.Name, fn.Params, fn.Variadic, body)
+}
+
+// raiseAt raises an error which was returned to a built-in function called by the given call expression. A
+// [*lox.Error], [*InterruptedError], or [*lox.ExitError] is raised as it is, so that an interruption or exit of a call
+// made with [*Interpreter.Call] stops the program which called the built-in function. Any other error is raised as a
+// runtime error at the call expression, unless there isn't one.
+func raiseAt(call ast.CallExpr, err error) {
+	var loxErr *lox.Error
+	var interruptedErr *InterruptedError
+	var exitErr *lox.ExitError
+	switch {
+	case errors.As(err, &loxErr):
+		panic(loxErr)
+	case errors.As(err, &interruptedErr):
+		panic(interruptedErr)
+	case errors.As(err, &exitErr):
+		panic(exitErr)
+	case call.Callee == nil:
+		panic(nativeError{err: err})
+	default:
+		panic(lox.NewErrorFromNode(call, "%s", err))
+	}
+}
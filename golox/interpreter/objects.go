@@ -3,6 +3,7 @@ package interpreter
 import (
 	"fmt"
 	"math"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -21,6 +22,9 @@ const (
 	loxTypeNil      loxType = "nil"
 	loxTypeFunction loxType = "function"
 	loxTypeClass    loxType = "class"
+	loxTypeList     loxType = "list"
+	loxTypeMap      loxType = "map"
+	loxTypeModule   loxType = "module"
 )
 
 // Format implements fmt.Formatter. All verbs have the default behaviour, except for 'm' (message) which formats the
@@ -46,15 +50,36 @@ type loxUnaryOperand interface {
 }
 
 type loxBinaryOperand interface {
-	// BinaryOp returns the result of applying the given binary operator to the object. If the operator is not
-	// supported, then the return value is nil.
-	BinaryOp(op token.Token, right loxObject) loxObject
+	// BinaryOp returns the result of applying the operator of the given binary expression to the object. If the
+	// operator is not supported, then the return value is nil.
+	BinaryOp(i *Interpreter, expr ast.BinaryExpr, right loxObject) loxObject
 }
 
 type loxTruther interface {
 	IsTruthy() loxBool
 }
 
+type loxIndexable interface {
+	// Index returns the element at the given index. expr is the expression being evaluated and is used to report
+	// errors.
+	Index(i *Interpreter, expr ast.IndexExpr, index loxObject) loxObject
+	// SetIndex sets the element at the given index to the given value. expr is the expression being evaluated and is
+	// used to report errors.
+	SetIndex(i *Interpreter, expr ast.IndexSetExpr, index loxObject, value loxObject)
+}
+
+type loxSliceable interface {
+	// Slice returns the elements between the low (inclusive) and high (exclusive) indexes. low and high are nil if they
+	// were omitted from the expression. expr is the expression being evaluated and is used to report errors.
+	Slice(i *Interpreter, expr ast.SliceExpr, low loxObject, high loxObject) loxObject
+}
+
+type loxPropertyAccessor interface {
+	// Get returns the value of the property with the given name. If the property doesn't exist, then an error is
+	// raised.
+	Get(name token.Token) loxObject
+}
+
 type loxCallable interface {
 	Name() string
 	Params() []string
@@ -89,7 +114,8 @@ func (n loxNumber) UnaryOp(op token.Token) loxObject {
 	return nil
 }
 
-func (n loxNumber) BinaryOp(op token.Token, right loxObject) loxObject {
+func (n loxNumber) BinaryOp(i *Interpreter, expr ast.BinaryExpr, right loxObject) loxObject {
+	op := expr.Op
 	switch right := right.(type) {
 	case loxNumber:
 		switch op.Type {
@@ -121,19 +147,29 @@ func (n loxNumber) BinaryOp(op token.Token, right loxObject) loxObject {
 	case loxString:
 		switch op.Type {
 		case token.Asterisk:
-			return numberTimesString(n, op, right)
+			return numberTimesString(i, expr, n, right)
 		}
 	}
 	return nil
 }
 
-func numberTimesString(n loxNumber, op token.Token, s loxString) loxString {
+func numberTimesString(i *Interpreter, expr ast.BinaryExpr, n loxNumber, s loxString) loxString {
+	op := expr.Op
 	if math.Floor(float64(n)) != float64(n) {
 		panic(lox.NewErrorFromToken(op, "cannot multiply %m by non-integer %m", loxTypeString, loxTypeNumber))
 	}
 	if n < 0 {
 		panic(lox.NewErrorFromToken(op, "cannot multiply %m by negative %m", loxTypeString, loxTypeNumber))
 	}
+	if len(s) == 0 {
+		return ""
+	}
+	// The length is calculated as a float so that it can't overflow.
+	length := float64(len(s)) * float64(n)
+	if length >= math.MaxInt {
+		panic(lox.NewErrorFromToken(op, "cannot multiply %m by %s: result is too long", loxTypeString, n))
+	}
+	i.allocate(expr, stringSize+int(min(length, maxAllocationSize)))
 	return loxString(strings.Repeat(string(s), int(n)))
 }
 
@@ -157,11 +193,13 @@ func (s loxString) IsTruthy() loxBool {
 	return s != ""
 }
 
-func (s loxString) BinaryOp(op token.Token, right loxObject) loxObject {
+func (s loxString) BinaryOp(i *Interpreter, expr ast.BinaryExpr, right loxObject) loxObject {
+	op := expr.Op
 	switch right := right.(type) {
 	case loxString:
 		switch op.Type {
 		case token.Plus:
+			i.allocate(expr, stringSize+len(s)+len(right))
 			return s + right
 		case token.Less:
 			return loxBool(s < right)
@@ -175,12 +213,283 @@ func (s loxString) BinaryOp(op token.Token, right loxObject) loxObject {
 	case loxNumber:
 		switch op.Type {
 		case token.Asterisk:
-			return numberTimesString(right, op, s)
+			return numberTimesString(i, expr, right, s)
+		}
+	}
+	return nil
+}
+
+type loxList struct {
+	elements []loxObject
+}
+
+func newLoxList(elements []loxObject) *loxList {
+	return &loxList{elements: elements}
+}
+
+var (
+	_ loxObject        = &loxList{}
+	_ loxTruther       = &loxList{}
+	_ loxBinaryOperand = &loxList{}
+	_ loxIndexable     = &loxList{}
+	_ loxSliceable     = &loxList{}
+)
+
+func (l *loxList) String() string {
+	return l.string(nil)
+}
+
+// string formats the list. enclosing are the containers which the list is being formatted as an element of. If the
+// list is one of them, then it contains itself and is formatted as [...] instead.
+func (l *loxList) string(enclosing []loxObject) string {
+	if slices.Contains(enclosing, loxObject(l)) {
+		return "[...]"
+	}
+	enclosing = append(enclosing, l)
+	var b strings.Builder
+	b.WriteString("[")
+	for i, element := range l.elements {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(containedElementString(element, enclosing))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// elementString formats an object for display as an element of a container, such as a list or map.
+// Strings are quoted so that they can be distinguished from other types.
+func elementString(obj loxObject) string {
+	return containedElementString(obj, nil)
+}
+
+// containedElementString is like elementString but enclosing are the containers which obj is being formatted as an
+// element of.
+func containedElementString(obj loxObject, enclosing []loxObject) string {
+	switch obj := obj.(type) {
+	case loxString:
+		return strconv.Quote(string(obj))
+	case *loxList:
+		return obj.string(enclosing)
+	case *loxMap:
+		return obj.string(enclosing)
+	default:
+		return obj.String()
+	}
+}
+
+func (l *loxList) Type() loxType {
+	return loxTypeList
+}
+
+func (l *loxList) IsTruthy() loxBool {
+	return len(l.elements) > 0
+}
+
+func (l *loxList) BinaryOp(i *Interpreter, expr ast.BinaryExpr, right loxObject) loxObject {
+	switch right := right.(type) {
+	case *loxList:
+		switch expr.Op.Type {
+		case token.Plus:
+			i.allocate(expr, listSize+elementSize*(len(l.elements)+len(right.elements)))
+			elements := make([]loxObject, 0, len(l.elements)+len(right.elements))
+			elements = append(elements, l.elements...)
+			elements = append(elements, right.elements...)
+			return newLoxList(elements)
 		}
 	}
 	return nil
 }
 
+func (l *loxList) Index(_ *Interpreter, expr ast.IndexExpr, index loxObject) loxObject {
+	return l.elements[l.elementIndex(expr.Index, index)]
+}
+
+func (l *loxList) SetIndex(_ *Interpreter, expr ast.IndexSetExpr, index loxObject, value loxObject) {
+	l.elements[l.elementIndex(expr.Index, index)] = value
+}
+
+// elementIndex returns the index into l.elements that the given index object refers to. Negative indexes count
+// backwards from the end of the list.
+func (l *loxList) elementIndex(indexExpr ast.Expr, index loxObject) int {
+	n := listIndexInt(indexExpr, index, "list index")
+	if n < 0 {
+		n += len(l.elements)
+	}
+	if n < 0 || n >= len(l.elements) {
+		panic(lox.NewErrorFromNode(indexExpr, "list index %s out of range for list of length %d", index, len(l.elements)))
+	}
+	return n
+}
+
+func (l *loxList) Slice(i *Interpreter, expr ast.SliceExpr, low loxObject, high loxObject) loxObject {
+	lowIndex := 0
+	if low != nil {
+		lowIndex = l.sliceIndex(expr.Low, low)
+	}
+	highIndex := len(l.elements)
+	if high != nil {
+		highIndex = l.sliceIndex(expr.High, high)
+	}
+	if lowIndex >= highIndex {
+		i.allocate(expr, listSize)
+		return newLoxList(nil)
+	}
+	i.allocate(expr, listSize+elementSize*(highIndex-lowIndex))
+	return newLoxList(slices.Clone(l.elements[lowIndex:highIndex]))
+}
+
+// sliceIndex returns the index into l.elements that the given slice index object refers to. Negative indexes count
+// backwards from the end of the list and indexes which are out of range are clamped to the bounds of the list.
+func (l *loxList) sliceIndex(indexExpr ast.Expr, index loxObject) int {
+	n := listIndexInt(indexExpr, index, "list slice index")
+	if n < 0 {
+		n += len(l.elements)
+	}
+	return max(0, min(n, len(l.elements)))
+}
+
+// listIndexInt converts an index object to an int, raising an error if it's not an integer. name is used to describe
+// the index in error messages.
+func listIndexInt(indexExpr ast.Expr, index loxObject, name string) int {
+	n, ok := index.(loxNumber)
+	if !ok {
+		panic(lox.NewErrorFromNode(indexExpr, "%s must be a %m, got %m", name, loxTypeNumber, index.Type()))
+	}
+	if math.Floor(float64(n)) != float64(n) {
+		panic(lox.NewErrorFromNode(indexExpr, "%s must be an integer, got %s", name, n))
+	}
+	return int(n)
+}
+
+type loxMap struct {
+	entries      []loxMapEntry
+	indexesByKey map[any]int
+}
+
+type loxMapEntry struct {
+	Key   loxObject
+	Value loxObject
+}
+
+func newLoxMap() *loxMap {
+	return &loxMap{indexesByKey: map[any]int{}}
+}
+
+var (
+	_ loxObject    = &loxMap{}
+	_ loxTruther   = &loxMap{}
+	_ loxIndexable = &loxMap{}
+)
+
+// String formats the map with its entries in the order that their keys were first inserted.
+func (m *loxMap) String() string {
+	return m.string(nil)
+}
+
+// string formats the map. enclosing are the containers which the map is being formatted as an element of. If the map
+// is one of them, then it contains itself and is formatted as {...} instead.
+func (m *loxMap) string(enclosing []loxObject) string {
+	if slices.Contains(enclosing, loxObject(m)) {
+		return "{...}"
+	}
+	enclosing = append(enclosing, m)
+	var b strings.Builder
+	b.WriteString("{")
+	for i, entry := range m.entries {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		key := containedElementString(entry.Key, enclosing)
+		value := containedElementString(entry.Value, enclosing)
+		fmt.Fprintf(&b, "%s: %s", key, value)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (m *loxMap) Type() loxType {
+	return loxTypeMap
+}
+
+func (m *loxMap) IsTruthy() loxBool {
+	return len(m.entries) > 0
+}
+
+func (m *loxMap) Index(i *Interpreter, expr ast.IndexExpr, key loxObject) loxObject {
+	index, ok := m.indexesByKey[hashKey(i, expr.Index, key)]
+	if !ok {
+		panic(lox.NewErrorFromNode(expr.Index, "map has no key %s", elementString(key)))
+	}
+	return m.entries[index].Value
+}
+
+func (m *loxMap) SetIndex(i *Interpreter, expr ast.IndexSetExpr, key loxObject, value loxObject) {
+	m.Set(i, expr.Index, key, value)
+}
+
+// Set sets the value of a key in the map. If the key is not already present, then it's added after all existing keys.
+// keyExpr is the expression which the key was evaluated from and is used to report errors.
+func (m *loxMap) Set(i *Interpreter, keyExpr ast.Expr, key loxObject, value loxObject) {
+	hash := hashKey(i, keyExpr, key)
+	if _, ok := m.indexesByKey[hash]; !ok {
+		i.allocate(keyExpr, mapEntrySize)
+	}
+	m.set(hash, key, value)
+}
+
+// set sets the value of the key with the given hash key, as returned by hashKey.
+func (m *loxMap) set(hash any, key loxObject, value loxObject) {
+	if index, ok := m.indexesByKey[hash]; ok {
+		m.entries[index].Value = value
+		return
+	}
+	m.indexesByKey[hash] = len(m.entries)
+	m.entries = append(m.entries, loxMapEntry{Key: key, Value: value})
+}
+
+// hashMethodName is the name of the method which makes an instance hashable when defined on its class.
+const hashMethodName = "hash"
+
+// instanceHashKey is the hash key of an instance whose class defines a hash method.
+type instanceHashKey struct {
+	class *loxClass
+	hash  loxObject
+}
+
+// hashKey returns a comparable value which identifies the given map key. Objects with equal hash keys refer to the same
+// map entry.
+// Numbers, strings, bools, and nil are hashable, as are instances whose class defines a hash method which returns one
+// of these types. Any other object is unhashable and an error is raised. keyExpr is the expression which the key was
+// evaluated from and is used to report errors.
+func hashKey(i *Interpreter, keyExpr ast.Expr, key loxObject) any {
+	switch key := key.(type) {
+	case loxNumber, loxString, loxBool, loxNil:
+		return key
+	case *loxInstance:
+		method, ok := key.class.GetMethod(hashMethodName)
+		if !ok {
+			break
+		}
+		if len(method.Params()) > 0 {
+			panic(lox.NewErrorFromNode(keyExpr, "%s() must not accept any arguments to be used as a hash method", method.Name()))
+		}
+		i.allocate(keyExpr, boundMethodSize)
+		switch hash := i.call(keyExpr, method.Bind(key), nil).(type) {
+		case loxNumber, loxString, loxBool, loxNil:
+			return instanceHashKey{class: key.class, hash: hash}
+		default:
+			panic(lox.NewErrorFromNode(
+				keyExpr,
+				"%s() must return a %m, %m, %m, or %m to be used as a hash method, got %m",
+				method.Name(), loxTypeNumber, loxTypeString, loxTypeBool, loxTypeNil, hash.Type(),
+			))
+		}
+	}
+	panic(lox.NewErrorFromNode(keyExpr, "%m object is not hashable", key.Type()))
+}
+
 type loxBool bool
 
 var (
@@ -304,16 +613,23 @@ func (f *loxFunction) Bind(instance *loxInstance) *loxFunction {
 }
 
 type loxBuiltinFunction struct {
-	name   string
-	params []string
-	body   func(args []loxObject) loxObject
-}
-
-func newLoxBuiltinFunction(name string, params []string, body func(args []loxObject) loxObject) *loxBuiltinFunction {
+	name     string
+	params   []string
+	variadic bool // whether the function accepts any number of arguments after params
+	body     func(i *Interpreter, call ast.CallExpr, args []loxObject) loxObject
+}
+
+func newLoxBuiltinFunction(
+	name string,
+	params []string,
+	variadic bool,
+	body func(i *Interpreter, call ast.CallExpr, args []loxObject) loxObject,
+) *loxBuiltinFunction {
 	return &loxBuiltinFunction{
-		name:   name,
-		params: params,
-		body:   body,
+		name:     name,
+		params:   params,
+		variadic: variadic,
+		body:     body,
 	}
 }
 
@@ -338,19 +654,27 @@ func (f *loxBuiltinFunction) Params() []string {
 	return f.params
 }
 
-func (f *loxBuiltinFunction) Call(_ *Interpreter, args []loxObject) loxObject {
-	return f.body(args)
+// Call calls the function without a call expression, which happens when it's called by [*Interpreter.Call].
+func (f *loxBuiltinFunction) Call(i *Interpreter, args []loxObject) loxObject {
+	return f.body(i, ast.CallExpr{}, args)
+}
+
+// CallFrom calls the function from a call expression, which is used to report errors.
+func (f *loxBuiltinFunction) CallFrom(i *Interpreter, call ast.CallExpr, args []loxObject) loxObject {
+	return f.body(i, call, args)
 }
 
 type loxClass struct {
 	name          string
+	superclass    *loxClass
 	init          *loxFunction
 	methodsByName map[string]*loxFunction
 }
 
-func newLoxClass(name string, methodsByName map[string]*loxFunction) *loxClass {
+func newLoxClass(name string, superclass *loxClass, methodsByName map[string]*loxFunction) *loxClass {
 	class := &loxClass{
 		name:          name,
+		superclass:    superclass,
 		methodsByName: methodsByName,
 	}
 	if init, ok := class.GetMethod(token.InitIdent); ok {
@@ -391,9 +715,15 @@ func (c *loxClass) Call(i *Interpreter, args []loxObject) loxObject {
 	return instance
 }
 
+// GetMethod returns the method with the given name, searching up the superclass chain if it's not defined on this
+// class.
 func (c *loxClass) GetMethod(name string) (*loxFunction, bool) {
-	method, ok := c.methodsByName[name]
-	return method, ok
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.methodsByName[name]; ok {
+			return method, true
+		}
+	}
+	return nil, false
 }
 
 type loxInstance struct {
@@ -408,7 +738,10 @@ func newLoxInstance(class *loxClass) *loxInstance {
 	}
 }
 
-var _ loxObject = &loxInstance{}
+var (
+	_ loxObject           = &loxInstance{}
+	_ loxPropertyAccessor = &loxInstance{}
+)
 
 func (i *loxInstance) String() string {
 	return fmt.Sprintf("[%s object]", i.class.Name())
@@ -433,3 +766,46 @@ func (i *loxInstance) Get(name token.Token) loxObject {
 func (i *loxInstance) Set(name token.Token, value loxObject) {
 	i.fieldValuesByName[name.Lexeme] = value
 }
+
+type loxModule struct {
+	name           string
+	globals        *environment
+	exportedIdents map[string]bool
+}
+
+// newLoxModule returns a module whose properties are the declarations in its global environment, excluding the
+// built-in declarations which still have their built-in values. A built-in which the module has redeclared or assigned
+// to is one of its properties.
+func newLoxModule(name string, globals *environment, builtins *environment) *loxModule {
+	exportedIdents := make(map[string]bool)
+	for ident, value := range globals.valuesByIdent {
+		if builtin, ok := builtins.valuesByIdent[ident]; !ok || value != builtin {
+			exportedIdents[ident] = true
+		}
+	}
+	return &loxModule{
+		name:           name,
+		globals:        globals,
+		exportedIdents: exportedIdents,
+	}
+}
+
+var (
+	_ loxObject           = &loxModule{}
+	_ loxPropertyAccessor = &loxModule{}
+)
+
+func (m *loxModule) String() string {
+	return fmt.Sprintf("[module %s]", m.name)
+}
+
+func (m *loxModule) Type() loxType {
+	return loxTypeModule
+}
+
+func (m *loxModule) Get(name token.Token) loxObject {
+	if !m.exportedIdents[name.Lexeme] {
+		panic(lox.NewErrorFromToken(name, "%m object has no property %s", m.Type(), name.Lexeme))
+	}
+	return m.globals.Get(name)
+}
@@ -0,0 +1,29 @@
+package interpreter
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+
+	"github.com/marcuscaisey/lox/golox/parser"
+)
+
+// prelude is Lox source code which is interpreted by every new Interpreter before any user code. Its declarations are
+// available in every module.
+//
+//go:embed prelude.lox
+var prelude []byte
+
+// errorClassName is the name of the class defined in the prelude which runtime errors are instances of.
+const errorClassName = "Error"
+
+func (i *Interpreter) interpretPrelude() {
+	program, err := parser.Parse(bytes.NewReader(prelude))
+	if err != nil {
+		panic(fmt.Sprintf("parsing prelude: %s", err))
+	}
+	if err := i.interpretProgram(i.builtins, program); err != nil {
+		panic(fmt.Sprintf("resolving prelude: %s", err))
+	}
+	i.errorClass = i.builtins.GetByIdent(errorClassName).(*loxClass)
+}
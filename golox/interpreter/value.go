@@ -0,0 +1,255 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// Value is a Lox value which can be passed between the interpreter and the program which is embedding it.
+// The zero Value is nil.
+type Value struct {
+	object loxObject
+}
+
+func newValue(object loxObject) Value {
+	if _, ok := object.(loxNil); ok {
+		return Value{}
+	}
+	return Value{object: object}
+}
+
+// loxObject returns the Lox object which the value holds.
+func (v Value) loxObject() loxObject {
+	if v.object == nil {
+		return loxNil{}
+	}
+	return v.object
+}
+
+// String returns the value formatted as it would be by a print statement.
+func (v Value) String() string {
+	return v.loxObject().String()
+}
+
+// Type returns the name of the type of the value, as returned by the type built-in function.
+func (v Value) Type() string {
+	return string(v.loxObject().Type())
+}
+
+// IsNil reports whether the value is nil.
+func (v Value) IsNil() bool {
+	return v.object == nil
+}
+
+// IsTruthy reports whether the value is considered true when used as a condition.
+func (v Value) IsTruthy() bool {
+	return bool(isTruthy(v.loxObject()))
+}
+
+// IsCallable reports whether the value can be called with [*Interpreter.Call].
+func (v Value) IsCallable() bool {
+	_, ok := v.object.(loxCallable)
+	return ok
+}
+
+// Interface returns the value as a Go value. nil, numbers, strings, and bools are returned as nil, float64, string, and
+// bool. Lists and maps are returned as []any and map[any]any with their elements converted recursively. Any other
+// value, such as a function, class, or instance, is returned as the Value itself.
+//
+// Each list or map is converted once, so a list or map which is contained in itself is converted to a slice or map
+// which is contained in itself, rather than being converted forever. Note that such a value can't be printed with the
+// fmt package.
+func (v Value) Interface() any {
+	return v.goValue(map[loxObject]any{})
+}
+
+// goValue implements Interface. converted holds the Go values which the lists and maps that have been converted so far
+// were converted to.
+func (v Value) goValue(converted map[loxObject]any) any {
+	switch object := v.loxObject().(type) {
+	case loxNil:
+		return nil
+	case loxNumber:
+		return float64(object)
+	case loxString:
+		return string(object)
+	case loxBool:
+		return bool(object)
+	case *loxList:
+		if elements, ok := converted[object]; ok {
+			return elements
+		}
+		elements := make([]any, len(object.elements))
+		converted[object] = elements
+		for i, element := range object.elements {
+			elements[i] = newValue(element).goValue(converted)
+		}
+		return elements
+	case *loxMap:
+		if entries, ok := converted[object]; ok {
+			return entries
+		}
+		entries := make(map[any]any, len(object.entries))
+		converted[object] = entries
+		for _, entry := range object.entries {
+			entries[newValue(entry.Key).goValue(converted)] = newValue(entry.Value).goValue(converted)
+		}
+		return entries
+	default:
+		return v
+	}
+}
+
+// ValueOf converts a Go value to a Lox value. nil, bools, strings, and all integer and floating point types are
+// converted to the corresponding Lox type. Slices and arrays are converted to lists, and maps to maps, with their
+// elements converted recursively. Map keys must convert to a nil, number, string, or bool. A Value is returned as it
+// is. An error is returned if the value or any of its elements can't be converted.
+func ValueOf(x any) (Value, error) {
+	if v, ok := x.(Value); ok {
+		return v, nil
+	}
+	if x == nil {
+		return Value{}, nil
+	}
+	object, err := loxObjectOf(reflect.ValueOf(x))
+	if err != nil {
+		return Value{}, err
+	}
+	return newValue(object), nil
+}
+
+var valueType = reflect.TypeFor[Value]()
+
+func loxObjectOf(x reflect.Value) (loxObject, error) {
+	if x.Type() == valueType {
+		return x.Interface().(Value).loxObject(), nil
+	}
+	switch x.Kind() {
+	case reflect.Bool:
+		return loxBool(x.Bool()), nil
+	case reflect.String:
+		return loxString(x.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return loxNumber(x.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return loxNumber(x.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return loxNumber(x.Float()), nil
+	case reflect.Interface, reflect.Pointer:
+		if x.IsNil() {
+			return loxNil{}, nil
+		}
+		return loxObjectOf(x.Elem())
+	case reflect.Slice, reflect.Array:
+		if x.Kind() == reflect.Slice && x.IsNil() {
+			return loxNil{}, nil
+		}
+		elements := make([]loxObject, x.Len())
+		for i := range x.Len() {
+			element, err := loxObjectOf(x.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return newLoxList(elements), nil
+	case reflect.Map:
+		if x.IsNil() {
+			return loxNil{}, nil
+		}
+		m := newLoxMap()
+		iter := x.MapRange()
+		for iter.Next() {
+			key, err := loxObjectOf(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case loxNumber, loxString, loxBool, loxNil:
+			default:
+				return nil, fmt.Errorf("cannot convert %s to a Lox value: %m object is not hashable", x.Type(), key.Type())
+			}
+			value, err := loxObjectOf(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			// The hash key of a primitive is the primitive itself, so there's no need for an interpreter to hash it.
+			m.set(key, key, value)
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Lox value", x.Type())
+}
+
+// Global returns the value of a global variable. false is returned if the variable hasn't been declared or defined.
+func (i *Interpreter) Global(name string) (Value, bool) {
+	object := i.globals.valuesByIdent[name]
+	if object == nil {
+		return Value{}, false
+	}
+	return newValue(object), true
+}
+
+// SetGlobal sets the value of a global variable, which is converted to a Lox value by [ValueOf]. The variable is
+// declared if it hasn't been already.
+func (i *Interpreter) SetGlobal(name string, value any) error {
+	v, err := ValueOf(value)
+	if err != nil {
+		return err
+	}
+	i.globals.valuesByIdent[name] = v.loxObject()
+	return nil
+}
+
+// Call calls a function, class, or bound method with arguments which are converted to Lox values by [ValueOf] and
+// returns its result. An error is returned if callee isn't callable, if the wrong number of arguments is given, or if a
+// runtime error occurs during the call. If Call is called by a native function, then the call is interrupted along
+// with the program which called the native function.
+func (i *Interpreter) Call(callee Value, args ...any) (result Value, err error) {
+	callable, ok := callee.object.(loxCallable)
+	if !ok {
+		return Value{}, fmt.Errorf("%s object is not callable", callee.Type())
+	}
+	if msg, _ := arityError(callable, len(args)); msg != "" {
+		return Value{}, errors.New(msg)
+	}
+	objects := make([]loxObject, len(args))
+	for j, arg := range args {
+		v, err := ValueOf(arg)
+		if err != nil {
+			return Value{}, fmt.Errorf("argument %d of %s(): %w", j+1, callable.Name(), err)
+		}
+		objects[j] = v.loxObject()
+	}
+	callDepth := len(i.callStack)
+	defer i.startExecution(i.ctx)()
+	defer func() {
+		if r := recover(); r != nil {
+			err = i.errorFromPanic(r, callDepth)
+		}
+		if flushErr := i.stdout.Flush(); err == nil {
+			err = flushErr
+		}
+	}()
+	return newValue(i.call(i.callSite(), callable, objects)), nil
+}
+
+// callSite is the node which a call made with [*Interpreter.Call] is made from. A call made by a native function is
+// made from the call expression of the native function. Any other call is made by the embedding program and has no
+// position in the source code.
+type callSite struct {
+	pos token.Position
+}
+
+func (i *Interpreter) callSite() callSite {
+	if len(i.callStack) == 0 {
+		return callSite{}
+	}
+	return callSite{pos: i.callStack[len(i.callStack)-1].pos}
+}
+
+func (c callSite) Start() token.Position { return c.pos }
+func (c callSite) End() token.Position   { return c.pos }
@@ -4,6 +4,7 @@ package lox
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"slices"
 	"strings"
 	"unicode/utf8"
@@ -18,9 +19,16 @@ import (
 // Error describes an error that occurred during the execution of a Lox program.
 // It can describe any error which can be attributed to a range of characters in the source code.
 type Error struct {
-	msg   string
-	start token.Position
-	end   token.Position
+	msg       string
+	start     token.Position
+	end       token.Position
+	traceback []StackFrame
+}
+
+// StackFrame describes a call which was in progress when an error occurred.
+type StackFrame struct {
+	Name string         // name of the function which was called
+	Call token.Position // position of the call expression
 }
 
 // NewError creates a [*Error].
@@ -50,14 +58,54 @@ func NewErrorFromNodeRange(start, end ast.Node, format string, args ...interface
 	return NewError(start.Start(), end.End(), format, args...)
 }
 
+// Message returns the error message without any position information.
+func (e *Error) Message() string {
+	return e.msg
+}
+
+// Start returns the position of the first character that the error applies to.
+func (e *Error) Start() token.Position {
+	return e.start
+}
+
+// End returns the position of the character immediately after the range of characters that the error applies to.
+func (e *Error) End() token.Position {
+	return e.end
+}
+
+// Traceback returns the calls which were in progress when the error occurred, ordered from the outermost call to the
+// innermost.
+func (e *Error) Traceback() []StackFrame {
+	return e.traceback
+}
+
+// WithTraceback returns a copy of the error with the given traceback attached. The frames should be ordered from the
+// outermost call to the innermost.
+func (e *Error) WithTraceback(traceback []StackFrame) *Error {
+	errCopy := *e
+	errCopy.traceback = traceback
+	return &errCopy
+}
+
 // Error formats the error by displaying the error message and highlighting the range of characters in the source code
-// that the error applies to.
+// that the error applies to. If the error has a traceback, then it's displayed before the error message.
 //
 // For example:
 //
 //	test.lox:2:7: error: unterminated string literal
 //	print "bar;
 //	      ~~~~~
+//
+// Or with a traceback:
+//
+//	traceback (most recent call last):
+//	  test.lox:9:1: in <script>
+//	    outer();
+//	  test.lox:5:3: in outer
+//	    inner(nil);
+//	test.lox:2:11: error: '+' operator cannot be used with types 'nil' and 'number'
+//	  print x + 1;
+//	          ~
 func (e *Error) Error() string {
 	bold := color.New(color.Bold)
 	red := color.New(color.FgRed)
@@ -67,6 +115,22 @@ func (e *Error) Error() string {
 		return strings.TrimSuffix(b.String(), "\n")
 	}
 
+	traceback, caller := e.traceback, "<script>"
+	if len(traceback) > 0 && traceback[0].Call.File == nil {
+		// The outermost call was made by a program which embeds the interpreter rather than from the source code, so
+		// there's no position to display for it. It's still the caller of the next frame though.
+		traceback, caller = traceback[1:], traceback[0].Name
+	}
+	if len(traceback) > 0 {
+		writeTraceback(&b, traceback, caller)
+	}
+
+	if e.start.File == nil {
+		// The error was raised by a call which wasn't made from the source code, so there's nothing to display but the
+		// message.
+		bold.Fprint(&b, red.Sprint("error: "), e.msg)
+		return b.String()
+	}
 	bold.Fprint(&b, e.start, ": ", red.Sprint("error: "), e.msg, "\n")
 
 	lines := make([]string, e.end.Line-e.start.Line+1)
@@ -104,6 +168,79 @@ func (e *Error) Error() string {
 	return buildString()
 }
 
+// ExitError is returned by an interpreter when a program calls the exit built-in function. It isn't a runtime error,
+// so it can't be caught by a try statement, although any finally blocks are still executed.
+type ExitError struct {
+	Code int // exit code that the program passed to exit
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Exit codes which describe why a program failed, following the conventions of sysexits.h.
+const (
+	exitCompileError = 65 // EX_DATAERR: the program couldn't be parsed or resolved
+	exitNoInput      = 66 // EX_NOINPUT: the program couldn't be opened
+	exitRuntimeError = 70 // EX_SOFTWARE: an error occurred whilst the program was running
+)
+
+// ExitCode returns the exit code of a program which finished with err. This is the code passed to exit if err is an
+// [*ExitError], otherwise it's the code which describes the error, following the conventions of sysexits.h.
+// 0 is returned if err is nil.
+func ExitCode(err error) int {
+	var exitErr *ExitError
+	var pathErr *fs.PathError
+	var compileErrs Errors
+	var runtimeErr *Error
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.Code
+	case errors.As(err, &pathErr):
+		return exitNoInput
+	case errors.As(err, &compileErrs):
+		// The errors which are found when a program or a module that it imports is parsed or resolved.
+		return exitCompileError
+	case errors.As(err, &runtimeErr):
+		return exitRuntimeError
+	default:
+		return 1
+	}
+}
+
+// maxRepeatedFrames is the number of times that a frame is displayed when it's repeated consecutively in a traceback,
+// as happens with recursion.
+const maxRepeatedFrames = 3
+
+// writeTraceback writes a traceback to b. Each frame is displayed as the position of its call, the name of the function
+// that the call was made from, and the line of source code containing the call. caller is the name of the function
+// that the first call was made from.
+func writeTraceback(b *strings.Builder, traceback []StackFrame, caller string) {
+	bold := color.New(color.Bold)
+	fmt.Fprintln(b, "traceback (most recent call last):")
+	repeats := 0
+	for i, frame := range traceback {
+		if i > 0 && frame == traceback[i-1] {
+			repeats++
+		} else {
+			repeats = 0
+		}
+		if repeats < maxRepeatedFrames {
+			bold.Fprint(b, "  ", frame.Call, ":")
+			fmt.Fprintln(b, " in", caller)
+			if line := frame.Call.File.Line(frame.Call.Line); utf8.Valid(line) {
+				fmt.Fprintln(b, "   ", strings.TrimSpace(string(line)))
+			}
+		}
+		if repeats >= maxRepeatedFrames && (i == len(traceback)-1 || frame != traceback[i+1]) {
+			fmt.Fprintf(b, "  [previous frame repeated %d more times]\n", repeats-maxRepeatedFrames+1)
+		}
+		caller = frame.Name
+	}
+}
+
 // Errors is a list of [*Error]s.
 type Errors []*Error
 
@@ -135,7 +272,8 @@ func (e *Errors) AddFromNodeRange(start, end ast.Node, format string, args ...in
 	e.Add(start.Start(), end.End(), format, args...)
 }
 
-// Err orders the errors in the list by their position in the source code and returns them as a single error.
+// Err orders the errors in the list by their position in the source code and returns them as a single error, which is
+// the list itself.
 func (e Errors) Err() error {
 	if len(e) == 0 {
 		return nil
@@ -143,9 +281,23 @@ func (e Errors) Err() error {
 	slices.SortFunc([]*Error(e), func(e1, e2 *Error) int {
 		return e1.start.Compare(e2.start)
 	})
-	var errs []error
-	for _, err := range e {
-		errs = append(errs, err)
+	return e
+}
+
+// Error returns the messages of the errors in the list, separated by newlines.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors in the list.
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
 	}
-	return errors.Join(errs...)
+	return errs
 }
@@ -0,0 +1,32 @@
+package lox
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// LineWriter is a buffered writer which is flushed whenever a newline is written to it. Output is written one line at
+// a time rather than one write at a time, but each line is still displayed as soon as it's complete, even if the
+// program never finishes.
+type LineWriter struct {
+	w *bufio.Writer
+}
+
+// NewLineWriter returns a new [LineWriter] which writes to w.
+func NewLineWriter(w io.Writer) LineWriter {
+	return LineWriter{w: bufio.NewWriter(w)}
+}
+
+func (w LineWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err == nil && bytes.IndexByte(p, '\n') != -1 {
+		err = w.w.Flush()
+	}
+	return n, err
+}
+
+// Flush writes any buffered output to the underlying writer.
+func (w LineWriter) Flush() error {
+	return w.w.Flush()
+}
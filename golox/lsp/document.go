@@ -0,0 +1,285 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/parser"
+	"github.com/marcuscaisey/lox/golox/resolver"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// document is a text document which is open in the client, along with the results of analysing it.
+type document struct {
+	URI         string
+	Lines       []string
+	Program     ast.Program
+	Idents      *resolver.Idents
+	Diagnostics []diagnostic
+}
+
+// newDocument parses and resolves the text of a document.
+// Programs which fail to parse are still resolved so that identifiers can be navigated whilst the document is being
+// edited. Errors from the resolver are only reported if the program parsed successfully though, as an incomplete
+// program can produce misleading errors.
+func newDocument(uri string, text string) *document {
+	program, parseErr := parser.Parse(namedReader{Reader: strings.NewReader(text), name: uriToPath(uri)})
+	idents, resolveErr := resolver.ResolveIdents(program)
+	err := parseErr
+	if err == nil {
+		err = resolveErr
+	}
+	var diagnostics []diagnostic
+	for _, loxErr := range loxErrors(err) {
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    newRange(loxErr.Start(), loxErr.End()),
+			Severity: diagnosticSeverityError,
+			Source:   "golox",
+			Message:  loxErr.Message(),
+		})
+	}
+	return &document{
+		URI:         uri,
+		Lines:       strings.Split(text, "\n"),
+		Program:     program,
+		Idents:      idents,
+		Diagnostics: diagnostics,
+	}
+}
+
+// namedReader is a reader with a name, which the parser uses as the name of the file that it's parsing.
+type namedReader struct {
+	*strings.Reader
+	name string
+}
+
+func (r namedReader) Name() string {
+	return r.name
+}
+
+// uriToPath returns the path of a file URI. Other URIs are returned unchanged.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+// loxErrors returns the [*lox.Error]s which make up an error returned by the parser or resolver.
+func loxErrors(err error) []*lox.Error {
+	if err == nil {
+		return nil
+	}
+	var errs []error
+	if joinedErr, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joinedErr.Unwrap()
+	} else {
+		errs = []error{err}
+	}
+	var loxErrs []*lox.Error
+	for _, err := range errs {
+		var loxErr *lox.Error
+		if errors.As(err, &loxErr) {
+			loxErrs = append(loxErrs, loxErr)
+		}
+	}
+	return loxErrs
+}
+
+// IdentAt returns the declaration that the identifier at the given position refers to and the identifier token. If
+// the identifier declares the declaration itself, then its name is returned. false is returned if there isn't an
+// identifier at the position which refers to a declaration in the document.
+func (d *document) IdentAt(pos position) (*resolver.Decl, token.Token, bool) {
+	line, column, ok := d.byteColumn(pos)
+	if !ok {
+		return nil, token.Token{}, false
+	}
+	contains := func(tok token.Token) bool {
+		return tok.Start.Line == line && tok.Start.Column <= column && column <= tok.End.Column
+	}
+	for _, decl := range d.Idents.Decls {
+		if contains(decl.Name) {
+			return decl, decl.Name, true
+		}
+	}
+	for tok, decl := range d.Idents.DeclsByTok {
+		if contains(tok) {
+			return decl, tok, true
+		}
+	}
+	return nil, token.Token{}, false
+}
+
+// References returns the identifier tokens which refer to a declaration, ordered by their position in the document.
+func (d *document) References(decl *resolver.Decl) []token.Token {
+	var refs []token.Token
+	for tok, tokDecl := range d.Idents.DeclsByTok {
+		if tokDecl == decl {
+			refs = append(refs, tok)
+		}
+	}
+	slices.SortFunc(refs, func(x, y token.Token) int {
+		return x.Start.Compare(y.Start)
+	})
+	return refs
+}
+
+// byteColumn converts a position to a 1-based line number and a byte offset from the start of the line, which is how
+// positions are represented by [token.Position].
+func (d *document) byteColumn(pos position) (line int, column int, ok bool) {
+	if pos.Line < 0 || pos.Line >= len(d.Lines) {
+		return 0, 0, false
+	}
+	text := d.Lines[pos.Line]
+	units := 0
+	for i, r := range text {
+		if units >= pos.Character {
+			return pos.Line + 1, i, true
+		}
+		units += utf16Len(r)
+	}
+	return pos.Line + 1, len(text), true
+}
+
+// newPosition converts a [token.Position] to a position.
+func newPosition(pos token.Position) position {
+	units := 0
+	for _, r := range string(pos.File.Line(pos.Line)[:pos.Column]) {
+		units += utf16Len(r)
+	}
+	return position{Line: pos.Line - 1, Character: units}
+}
+
+// utf16Len returns the number of UTF-16 code units needed to encode a rune.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func newRange(start, end token.Position) rangeType {
+	return rangeType{Start: newPosition(start), End: newPosition(end)}
+}
+
+func newTokenRange(tok token.Token) rangeType {
+	return newRange(tok.Start, tok.End)
+}
+
+func newNodeRange(node ast.Node) rangeType {
+	return newRange(node.Start(), node.End())
+}
+
+// Hover returns the text to display when hovering over an identifier which refers to a declaration. It describes the
+// kind of the declaration, for example:
+//
+//	(function) add(x, y)
+func (d *document) Hover(decl *resolver.Decl) string {
+	signature := decl.Name.Lexeme
+	switch node := decl.Node.(type) {
+	case ast.FunDecl:
+		if decl.Kind == resolver.DeclKindFunction {
+			signature += formatParams(node.Params)
+		}
+	case ast.ClassDecl:
+		if node.Superclass != nil {
+			signature += " < " + d.text(node.Superclass)
+		}
+	case ast.ImportDecl:
+		signature = fmt.Sprintf("%s from %s", decl.Name.Lexeme, node.Path.Lexeme)
+	}
+	return fmt.Sprintf("```lox\n(%s) %s\n```", decl.Kind, signature)
+}
+
+func formatParams(params []token.Token) string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Lexeme
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+// text returns the source code of a node. Only the first line is returned if the node spans multiple lines.
+func (d *document) text(node ast.Node) string {
+	start, end := node.Start(), node.End()
+	line := d.Lines[start.Line-1]
+	if start.Line != end.Line {
+		return strings.TrimSpace(line[start.Column:]) + " ..."
+	}
+	return line[start.Column:end.Column]
+}
+
+// Symbols returns the functions, classes, and methods which are declared in the document. Declarations which are
+// nested inside a function or method are returned as its children.
+func (d *document) Symbols() []documentSymbol {
+	return stmtSymbols(d.Program.Stmts)
+}
+
+func stmtSymbols(stmts []ast.Stmt) []documentSymbol {
+	var symbols []documentSymbol
+	for _, stmt := range stmts {
+		symbols = append(symbols, stmtSymbol(stmt)...)
+	}
+	return symbols
+}
+
+func stmtSymbol(stmt ast.Stmt) []documentSymbol {
+	switch stmt := stmt.(type) {
+	case ast.FunDecl:
+		return []documentSymbol{{
+			Name:           stmt.Name.Lexeme,
+			Detail:         formatParams(stmt.Params),
+			Kind:           symbolKindFunction,
+			Range:          newNodeRange(stmt),
+			SelectionRange: newTokenRange(stmt.Name),
+			Children:       stmtSymbols(stmt.Body),
+		}}
+	case ast.ClassDecl:
+		methods := make([]documentSymbol, len(stmt.Body))
+		for i, method := range stmt.Body {
+			methods[i] = documentSymbol{
+				Name:           method.Name.Lexeme,
+				Detail:         formatParams(method.Params),
+				Kind:           symbolKindMethod,
+				Range:          newNodeRange(method),
+				SelectionRange: newTokenRange(method.Name),
+				Children:       stmtSymbols(method.Body),
+			}
+		}
+		return []documentSymbol{{
+			Name:           stmt.Name.Lexeme,
+			Kind:           symbolKindClass,
+			Range:          newNodeRange(stmt),
+			SelectionRange: newTokenRange(stmt.Name),
+			Children:       methods,
+		}}
+	case ast.BlockStmt:
+		return stmtSymbols(stmt.Stmts)
+	case ast.IfStmt:
+		symbols := stmtSymbol(stmt.Then)
+		if stmt.Else != nil {
+			symbols = append(symbols, stmtSymbol(stmt.Else)...)
+		}
+		return symbols
+	case ast.WhileStmt:
+		return stmtSymbol(stmt.Body)
+	case ast.ForStmt:
+		return stmtSymbol(stmt.Body)
+	case ast.TryStmt:
+		symbols := stmtSymbol(stmt.Body)
+		for _, body := range []ast.Stmt{stmt.CatchBody, stmt.FinallyBody} {
+			if body != nil {
+				symbols = append(symbols, stmtSymbol(body)...)
+			}
+		}
+		return symbols
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,116 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// JSON-RPC error codes which are used by the server.
+// See https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/#errorCodes.
+const (
+	codeParseError           = -32700
+	codeInvalidParams        = -32602
+	codeMethodNotFound       = -32601
+	codeInvalidRequest       = -32600
+	codeServerNotInitialized = -32002
+)
+
+// message is a JSON-RPC request, response, or notification. Requests have an ID and a method, notifications have a
+// method but no ID, and responses have an ID but no method.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+// response is a successful JSON-RPC response. Result is always included, even if it's null.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+}
+
+// errorResponse is an unsuccessful JSON-RPC response.
+type errorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   *responseError  `json:"error"`
+}
+
+// notification is a JSON-RPC notification which is sent by the server.
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// responseError is the error which is returned in an unsuccessful response.
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+func newResponseError(code int, format string, args ...any) *responseError {
+	return &responseError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// conn reads and writes JSON-RPC messages which are framed by a header containing their length, as described in
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/#headerPart.
+type conn struct {
+	r *textproto.Reader
+	w io.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+// Read reads the next message. io.EOF is returned if there are no more messages.
+func (c *conn) Read() (*message, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading message header: %s", err)
+	}
+	lengthStr := header.Get("Content-Length")
+	if lengthStr == "" {
+		return nil, errors.New("reading message header: Content-Length is missing")
+	}
+	length, err := strconv.Atoi(lengthStr)
+	if err != nil {
+		return nil, fmt.Errorf("reading message header: invalid Content-Length: %s", err)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, content); err != nil {
+		return nil, fmt.Errorf("reading message content: %s", err)
+	}
+	msg := &message{}
+	if err := json.Unmarshal(content, msg); err != nil {
+		return nil, newResponseError(codeParseError, "parsing message: %s", err)
+	}
+	return msg, nil
+}
+
+// Write writes a message, which should be one of [response], [errorResponse], or [notification].
+func (c *conn) Write(msg any) error {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("writing message: %s", err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		return fmt.Errorf("writing message: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+// Package lsp implements a Language Server Protocol server for Lox.
+// The server publishes diagnostics from the parser and resolver and supports go to definition, find references, hover,
+// and document symbols. See https://microsoft.github.io/language-server-protocol/ for details of the protocol.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Serve runs a language server which reads messages from r and writes messages to w until the client sends the exit
+// notification or closes r. An error is returned if the client exits without first asking the server to shut down, as
+// required by the protocol.
+func Serve(r io.Reader, w io.Writer) error {
+	s := &server{
+		conn:           newConn(r, w),
+		documentsByURI: map[string]*document{},
+	}
+	return s.serve()
+}
+
+type server struct {
+	conn           *conn
+	documentsByURI map[string]*document
+	initialized    bool
+	shutdown       bool
+}
+
+// errExit is returned by a handler when the client sends the exit notification.
+var errExit = errors.New("exit")
+
+func (s *server) serve() error {
+	for {
+		msg, err := s.conn.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var respErr *responseError
+		if errors.As(err, &respErr) {
+			if err := s.conn.Write(errorResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: respErr}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.ID == nil {
+			if err := s.handleNotification(msg); errors.Is(err, errExit) {
+				if !s.shutdown {
+					return errors.New("exit notification received before shutdown request")
+				}
+				return nil
+			} else if err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "" {
+			// The server doesn't send any requests, so there shouldn't be any responses.
+			continue
+		}
+
+		result, err := s.handleRequest(msg)
+		if errors.As(err, &respErr) {
+			err = s.conn.Write(errorResponse{JSONRPC: "2.0", ID: *msg.ID, Error: respErr})
+		} else if err == nil {
+			err = s.conn.Write(response{JSONRPC: "2.0", ID: *msg.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleRequest handles a request and returns its result. If the request failed, then a [*responseError] is returned.
+// Any other error is fatal.
+func (s *server) handleRequest(msg *message) (any, error) {
+	if msg.Method == "initialize" {
+		s.initialized = true
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync: textDocumentSyncOptions{
+					OpenClose: true,
+					Change:    textDocumentSyncKindFull,
+				},
+				DefinitionProvider:     true,
+				ReferencesProvider:     true,
+				HoverProvider:          true,
+				DocumentSymbolProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "golox"},
+		}, nil
+	}
+	if !s.initialized {
+		return nil, newResponseError(codeServerNotInitialized, "server has not been initialized")
+	}
+	if s.shutdown {
+		return nil, newResponseError(codeInvalidRequest, "server has been shut down")
+	}
+
+	switch msg.Method {
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/definition":
+		return handle(msg, s.definition)
+	case "textDocument/references":
+		return handle(msg, s.references)
+	case "textDocument/hover":
+		return handle(msg, s.hover)
+	case "textDocument/documentSymbol":
+		return handle(msg, s.documentSymbol)
+	default:
+		return nil, newResponseError(codeMethodNotFound, "method not found: %s", msg.Method)
+	}
+}
+
+// handle unmarshals the parameters of a request and calls a handler with them.
+func handle[P any, R any](msg *message, handler func(*P) (R, error)) (any, error) {
+	params := new(P)
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return nil, newResponseError(codeInvalidParams, "invalid %s params: %s", msg.Method, err)
+	}
+	return handler(params)
+}
+
+// handleNotification handles a notification. [errExit] is returned if the client sent the exit notification. Any
+// other error is fatal.
+func (s *server) handleNotification(msg *message) error {
+	if msg.Method == "exit" {
+		return errExit
+	}
+	if !s.initialized {
+		return nil
+	}
+
+	var err error
+	switch msg.Method {
+	case "textDocument/didOpen":
+		_, err = handle(msg, s.didOpen)
+	case "textDocument/didChange":
+		_, err = handle(msg, s.didChange)
+	case "textDocument/didClose":
+		_, err = handle(msg, s.didClose)
+	}
+	var respErr *responseError
+	if errors.As(err, &respErr) {
+		// Notifications don't have responses, so there's nowhere to report invalid parameters.
+		return nil
+	}
+	return err
+}
+
+func (s *server) didOpen(params *didOpenTextDocumentParams) (any, error) {
+	return nil, s.updateDocument(params.TextDocument.URI, params.TextDocument.Text)
+}
+
+func (s *server) didChange(params *didChangeTextDocumentParams) (any, error) {
+	if len(params.ContentChanges) == 0 {
+		return nil, nil
+	}
+	// The server only supports full document synchronisation, so the last change contains the entire document.
+	text := params.ContentChanges[len(params.ContentChanges)-1].Text
+	return nil, s.updateDocument(params.TextDocument.URI, text)
+}
+
+func (s *server) didClose(params *didCloseTextDocumentParams) (any, error) {
+	delete(s.documentsByURI, params.TextDocument.URI)
+	return nil, s.publishDiagnostics(params.TextDocument.URI, nil)
+}
+
+// updateDocument analyses the new text of a document and publishes its diagnostics.
+func (s *server) updateDocument(uri string, text string) error {
+	doc := newDocument(uri, text)
+	s.documentsByURI[uri] = doc
+	return s.publishDiagnostics(uri, doc.Diagnostics)
+}
+
+func (s *server) publishDiagnostics(uri string, diagnostics []diagnostic) error {
+	if diagnostics == nil {
+		// The diagnostics must be sent as an empty array to clear them, rather than null.
+		diagnostics = []diagnostic{}
+	}
+	return s.conn.Write(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics},
+	})
+}
+
+func (s *server) document(uri string) (*document, error) {
+	doc, ok := s.documentsByURI[uri]
+	if !ok {
+		return nil, newResponseError(codeInvalidParams, "document has not been opened: %s", uri)
+	}
+	return doc, nil
+}
+
+func (s *server) definition(params *textDocumentPositionParams) (*location, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	decl, _, ok := doc.IdentAt(params.Position)
+	if !ok {
+		return nil, nil
+	}
+	return &location{URI: doc.URI, Range: newTokenRange(decl.Name)}, nil
+}
+
+func (s *server) references(params *referenceParams) ([]location, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	decl, _, ok := doc.IdentAt(params.Position)
+	if !ok {
+		return nil, nil
+	}
+	var locations []location
+	if params.Context.IncludeDeclaration {
+		locations = append(locations, location{URI: doc.URI, Range: newTokenRange(decl.Name)})
+	}
+	for _, ref := range doc.References(decl) {
+		locations = append(locations, location{URI: doc.URI, Range: newTokenRange(ref)})
+	}
+	return locations, nil
+}
+
+func (s *server) hover(params *textDocumentPositionParams) (*hover, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	decl, tok, ok := doc.IdentAt(params.Position)
+	if !ok {
+		return nil, nil
+	}
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: doc.Hover(decl)},
+		Range:    newTokenRange(tok),
+	}, nil
+}
+
+func (s *server) documentSymbol(params *documentSymbolParams) ([]documentSymbol, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	symbols := doc.Symbols()
+	if symbols == nil {
+		symbols = []documentSymbol{}
+	}
+	return symbols, nil
+}
@@ -2,28 +2,43 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"net"
 	"os"
-	"path"
+	"os/exec"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
 	"strings"
 
-	"github.com/chzyer/readline"
-
 	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/dap"
+	"github.com/marcuscaisey/lox/golox/format"
 	"github.com/marcuscaisey/lox/golox/interpreter"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/lsp"
 	"github.com/marcuscaisey/lox/golox/parser"
+	"github.com/marcuscaisey/lox/golox/vm"
 )
 
 var (
-	cmd      = flag.String("c", "", "Program passed in as string")
-	printAST = flag.Bool("p", false, "Print the AST only")
+	cmd          = flag.String("c", "", "Program passed in as string")
+	printAST     = flag.Bool("p", false, "Print the AST only")
+	useVM        = flag.Bool("vm", false, "Execute the program with the bytecode VM instead of the tree-walking interpreter")
+	debug        = flag.Bool("debug", false, "Debug the program with an interactive debugger which reads commands from stdin")
+	watch        = flag.Bool("watch", false, "Run the script again whenever it or any of the modules that it imports change")
+	maxCallDepth = flag.Int(
+		"max-call-depth",
+		interpreter.DefaultMaxCallDepth,
+		"Maximum depth of nested calls before a stack overflow error is raised",
+	)
 
 	cpuProfile = flag.String("cpuprofile", "", "Write a CPU profile to the specified file before exiting.")
 	memProfile = flag.String("memprofile", "", "Write an allocation profile to the file before exiting.")
@@ -32,7 +47,21 @@ var (
 
 // nolint:revive
 func Usage() {
-	fmt.Fprintf(flag.CommandLine.Output(), "Usage: golox [options] [script]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: golox [options] [script [arg ...]]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "       golox fmt [-w] [-d] [path ...]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "       golox lsp\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "       golox dap [-port port]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "Run a Lox script, or start a REPL if no script is given. The script is read from stdin if\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "it's -. Any arguments after the script are returned by the args built-in function.\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  fmt\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    \tFormat Lox source code in a canonical style\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  lsp\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    \tRun a language server which communicates over stdin and stdout\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  dap\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    \tRun a debug adapter which communicates over stdin and stdout or a TCP port\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "Options:\n")
 	flag.PrintDefaults()
@@ -41,9 +70,54 @@ func Usage() {
 func main() {
 	log.SetFlags(0)
 
+	if len(os.Args) > 1 {
+		var runCommand func(args []string) error
+		switch os.Args[1] {
+		case "fmt":
+			runCommand = runFmt
+		case "lsp":
+			runCommand = runLSP
+		case "dap":
+			runCommand = runDAP
+		}
+		if runCommand != nil {
+			if err := runCommand(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	flag.Usage = Usage
 	flag.Parse()
 
+	if *maxCallDepth < 1 {
+		log.Fatal("-max-call-depth must be at least 1")
+	}
+	if *debug && *useVM {
+		log.Fatal("-debug cannot be used with -vm")
+	}
+	if *debug && *cmd == "" && len(flag.Args()) == 0 {
+		log.Fatal("-debug requires a program to be passed with -c or as a script")
+	}
+	if *debug && *cmd == "" && flag.Arg(0) == "-" {
+		log.Fatal("-debug cannot be used with a script read from stdin, since the debugger reads commands from it")
+	}
+	if *watch && (*cmd != "" || len(flag.Args()) == 0 || flag.Arg(0) == "-") {
+		log.Fatal("-watch requires a script to be passed as a file")
+	}
+	if *watch && *debug {
+		log.Fatal("-watch cannot be used with -debug")
+	}
+
+	// The process exits after the other deferred functions have run, so that any profiles are written first.
+	var err error
+	defer func() {
+		if err != nil {
+			exit(err)
+		}
+	}()
+
 	if *cpuProfile != "" {
 		f, err := os.Create(*cpuProfile)
 		if err != nil {
@@ -93,29 +167,57 @@ func main() {
 		defer trace.Stop()
 	}
 
-	if *cmd != "" {
-		if err := run(strings.NewReader(*cmd), interpreter.New()); err != nil {
-			log.Fatal(err)
-		}
-		return
+	switch {
+	case *cmd != "":
+		err = run(strings.NewReader(*cmd), newRunner(false, flag.Args()))
+	case len(flag.Args()) == 0:
+		err = runREPL()
+	case *watch:
+		err = runWatch(flag.Arg(0), flag.Args()[1:])
+	default:
+		err = runFile(flag.Arg(0), flag.Args()[1:])
 	}
+}
 
-	switch len(flag.Args()) {
-	case 0:
-		if err := runREPL(); err != nil {
-			log.Fatal(err)
-		}
-	case 1:
-		if err := runFile(flag.Arg(0)); err != nil {
-			log.Fatal(err)
+// exit reports err and exits with the code which describes it.
+func exit(err error) {
+	// There's nothing to report if the program chose to exit.
+	var exitErr *lox.ExitError
+	if !errors.As(err, &exitErr) {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(lox.ExitCode(err))
+}
+
+// runner executes programs.
+type runner interface {
+	Interpret(program ast.Program) error
+	DumpGlobals() string
+	GlobalIdents() []string
+	PropertyNames(path []string) []string
+}
+
+// newRunner returns the runner selected by the command line flags. In REPL mode, the runner prints the result of
+// expression statements. args are returned by the args built-in function.
+func newRunner(replMode bool, args []string) runner {
+	if *useVM {
+		opts := []vm.Option{vm.MaxCallDepth(*maxCallDepth), vm.Args(args)}
+		if replMode {
+			opts = append(opts, vm.REPLMode())
 		}
-	default:
-		flag.Usage()
-		os.Exit(2)
+		return vm.New(opts...)
+	}
+	opts := []interpreter.Option{interpreter.MaxCallDepth(*maxCallDepth), interpreter.Args(args)}
+	if replMode {
+		opts = append(opts, interpreter.REPLMode())
 	}
+	if *debug {
+		opts = append(opts, interpreter.Debug(newDebugger().Debugger))
+	}
+	return interpreter.New(opts...)
 }
 
-func run(r io.Reader, interpreter *interpreter.Interpreter) error {
+func run(r io.Reader, runner runner) error {
 	root, err := parser.Parse(r)
 	if *printAST {
 		ast.Print(root)
@@ -124,54 +226,206 @@ func run(r io.Reader, interpreter *interpreter.Interpreter) error {
 	if err != nil {
 		return err
 	}
-	return interpreter.Interpret(root)
+	return runner.Interpret(root)
 }
 
-func runREPL() error {
-	cfg := &readline.Config{
-		Prompt: ">>> ",
+// runFmt runs the fmt command with the given arguments.
+func runFmt(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "Write the result to the source file instead of stdout")
+	diff := flags.Bool("d", false, "Display diffs instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: golox fmt [-w] [-d] [path ...]\n")
+		fmt.Fprintf(flags.Output(), "\n")
+		fmt.Fprintf(flags.Output(), "Format Lox source code. Directories are formatted recursively. If no paths are given, then\n")
+		fmt.Fprintf(flags.Output(), "standard input is formatted.\n")
+		fmt.Fprintf(flags.Output(), "\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
 	}
-
-	homeDir, err := os.UserHomeDir()
-	if err == nil {
-		cfg.HistoryFile = path.Join(homeDir, ".lox_history")
-	} else {
-		fmt.Fprintf(os.Stderr, "Can't get current user's home directory (%s). Command history will not be saved.\n", err)
+	if err := flags.Parse(args); err != nil {
+		return err
 	}
 
-	rl, err := readline.NewEx(cfg)
-	if err != nil {
-		return fmt.Errorf("running Lox REPL: %s", err)
+	if flags.NArg() == 0 {
+		if *write {
+			return errors.New("cannot use -w with standard input")
+		}
+		return formatFile(os.Stdin, "<stdin>", false, *diff)
 	}
-	defer rl.Close()
-
-	fmt.Fprintln(os.Stderr, "Welcome to the Lox REPL. Press Ctrl-D to exit.")
 
-	interpreter := interpreter.New(interpreter.REPLMode())
-	for {
-		line, err := rl.Readline()
-		if err != nil {
-			if errors.Is(err, readline.ErrInterrupt) {
-				continue
+	var errs []error
+	for _, root := range flags.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || (path != root && filepath.Ext(path) != ".lox") {
+				return nil
 			}
-			if errors.Is(err, io.EOF) {
-				break
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := formatFile(f, path, *write, *diff); err != nil {
+				// Keep going so that all of the files which can't be formatted are reported.
+				errs = append(errs, err)
 			}
-			panic(fmt.Sprintf("unexpected error from readline: %s", err))
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
 		}
-		if err := run(strings.NewReader(line), interpreter); err != nil {
-			fmt.Fprintln(os.Stderr, err)
+	}
+	return errors.Join(errs...)
+}
+
+// formatFile formats the file f with the given name. By default, the formatted source code is written to stdout. If
+// write is true, then the file is overwritten with the formatted source code instead. If diff is true, then the
+// difference between the original and formatted source code is written to stdout instead.
+func formatFile(f *os.File, name string, write bool, diff bool) error {
+	src, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("formatting %s: %s", name, err)
+	}
+	formatted, err := format.Format(namedReader{Reader: bytes.NewReader(src), name: name})
+	if err != nil {
+		return err
+	}
+	changed := !bytes.Equal(src, formatted)
+	if write && changed {
+		info, err := f.Stat()
+		if err != nil {
+			return fmt.Errorf("formatting %s: %s", name, err)
+		}
+		if err := os.WriteFile(name, formatted, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("formatting %s: %s", name, err)
+		}
+	}
+	switch {
+	case diff && changed:
+		d, err := diffSource(name, src, formatted)
+		if err != nil {
+			return fmt.Errorf("formatting %s: %s", name, err)
 		}
+		_, err = os.Stdout.Write(d)
+		return err
+	case !diff && !write:
+		_, err := os.Stdout.Write(formatted)
+		return err
+	default:
+		return nil
+	}
+}
+
+// namedReader is a reader with a name, which the parser uses as the name of the file that it's parsing.
+type namedReader struct {
+	*bytes.Reader
+	name string
+}
+
+func (r namedReader) Name() string {
+	return r.name
+}
+
+// diffSource returns the unified diff between the original and formatted source code of a file, as produced by the
+// diff command.
+func diffSource(name string, src []byte, formatted []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "golox-fmt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	srcPath := filepath.Join(dir, "src.lox")
+	formattedPath := filepath.Join(dir, "formatted.lox")
+	if err := os.WriteFile(srcPath, src, 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(formattedPath, formatted, 0o600); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("diff", "-u", "--label", name+".orig", "--label", name, srcPath, formattedPath)
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// diff exits with status 1 if the files are different.
+		return out, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("running diff: %s", err)
 	}
+	return out, nil
+}
 
-	return nil
+// runLSP runs the lsp command with the given arguments.
+func runLSP(args []string) error {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: golox lsp\n")
+		fmt.Fprintf(flags.Output(), "\n")
+		fmt.Fprintf(flags.Output(), "Run a language server which communicates over stdin and stdout.\n")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	return lsp.Serve(os.Stdin, os.Stdout)
 }
 
-func runFile(name string) error {
+// runDAP runs the dap command with the given arguments.
+func runDAP(args []string) error {
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	port := flags.Int("port", 0, "Listen for a connection on this TCP port instead of communicating over stdin and stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: golox dap [-port port]\n")
+		fmt.Fprintf(flags.Output(), "\n")
+		fmt.Fprintf(flags.Output(), "Run a debug adapter which communicates over stdin and stdout. If a port is given, then the\n")
+		fmt.Fprintf(flags.Output(), "debug adapter listens on it for a single connection from localhost instead.\n")
+		fmt.Fprintf(flags.Output(), "\n")
+		fmt.Fprintf(flags.Output(), "Options:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *port == 0 {
+		return dap.Serve(os.Stdin, os.Stdout)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", *port))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", listener.Addr())
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return dap.Serve(conn, conn)
+}
+
+// runFile runs the script with the given name, or the one read from stdin if the name is -. args are returned by the
+// args built-in function.
+func runFile(name string, args []string) error {
+	if name == "-" {
+		// os.Stdin is wrapped so that its name isn't used as the name of the script, which would make imports relative
+		// to /dev.
+		return run(struct{ io.Reader }{os.Stdin}, newRunner(false, args))
+	}
 	f, err := os.Open(name)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	return run(f, interpreter.New())
+	return run(f, newRunner(false, args))
 }
@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"slices"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
@@ -28,6 +31,18 @@ type lexer struct {
 	offset       int            // offset of character currently being considered
 	readOffset   int            // offset of next character to be read
 	lastReadSize int            // size of last rune read
+
+	// interpolations is the stack of string literals whose interpolated expressions are currently being lexed
+	interpolations []*interpolation
+
+	comments []token.Token // comments which have been skipped, in the order that they appear in the source code
+}
+
+// interpolation describes a string literal containing an interpolated expression which is currently being lexed.
+type interpolation struct {
+	delim      string // delimiter of the string literal
+	multiLine  bool   // whether the string literal can span multiple lines
+	braceDepth int    // number of unclosed left braces in the interpolated expression
 }
 
 // newLexer constructs a lexer which will lex the source code read from an io.Reader.
@@ -50,6 +65,15 @@ func newLexer(r io.Reader) (*lexer, error) {
 	}
 
 	l.next()
+	if l.hasPrefix("#!") {
+		// A shebang line at the start of a script is skipped like a comment, so that the script can be executed
+		// directly.
+		tok := token.Token{Type: token.Comment, Start: l.pos}
+		l.skipSingleLineComment()
+		tok.End = l.pos
+		tok.Lexeme = string(l.src[:l.offset])
+		l.comments = append(l.comments, tok)
+	}
 
 	return l, nil
 }
@@ -61,12 +85,32 @@ func name(v any) string {
 	return ""
 }
 
+// Lex returns the tokens in the source code read from r, including its comments, in the order that they appear. The
+// EOF token is not included. Syntax errors are ignored, so tokens which couldn't be lexed have the type
+// [token.Illegal].
+func Lex(r io.Reader) ([]token.Token, error) {
+	l, err := newLexer(r)
+	if err != nil {
+		return nil, err
+	}
+	var toks []token.Token
+	for tok := l.Next(); tok.Type != token.EOF; tok = l.Next() {
+		toks = append(toks, tok)
+	}
+	toks = append(toks, l.Comments()...)
+	slices.SortStableFunc(toks, func(x, y token.Token) int {
+		return x.Start.Compare(y.Start)
+	})
+	return toks, nil
+}
+
 // SetErrorHandler sets the error handler function which will be called when a syntax error is encountered.
 func (l *lexer) SetErrorHandler(errHandler errorHandler) {
 	l.errHandler = errHandler
 }
 
 // Next returns the next token. An EOF token is returned if the end of the source code has been reached.
+// Comments are skipped and can be retrieved afterwards using the Comments method.
 func (l *lexer) Next() token.Token {
 	l.skipWhitespace()
 
@@ -100,13 +144,22 @@ func (l *lexer) Next() token.Token {
 			l.next()
 			l.next()
 			l.skipSingleLineComment()
+			tok.End = l.pos
+			tok.Type = token.Comment
+			tok.Lexeme = string(l.src[startOffset:l.offset])
+			l.comments = append(l.comments, tok)
 			return l.Next()
 		}
 		if l.peek() == '*' {
 			l.next()
 			l.next()
-			if comment, terminated := l.consumeMultiLineComment(); !terminated {
-				tok.End = l.pos
+			comment, terminated := l.consumeMultiLineComment()
+			tok.End = l.pos
+			if terminated {
+				tok.Type = token.Comment
+				tok.Lexeme = string(l.src[startOffset:l.offset])
+				l.comments = append(l.comments, tok)
+			} else {
 				tok.Type = token.Illegal
 				tok.Lexeme = comment
 				l.errHandler(tok, "unterminated multi-line comment")
@@ -143,17 +196,41 @@ func (l *lexer) Next() token.Token {
 		tok.Type = token.RightParen
 	case l.ch == '{':
 		tok.Type = token.LeftBrace
+		if len(l.interpolations) > 0 {
+			l.interpolations[len(l.interpolations)-1].braceDepth++
+		}
+	case l.ch == '}' && len(l.interpolations) > 0 && l.interpolations[len(l.interpolations)-1].braceDepth == 0:
+		// This is the end of an interpolated expression, so we resume lexing the string literal that it's embedded in.
+		interp := l.interpolations[len(l.interpolations)-1]
+		l.interpolations = l.interpolations[:len(l.interpolations)-1]
+		l.next()
+		return l.consumeString(tok, startOffset, interp.delim, interp.multiLine, token.StringTail, token.StringMiddle)
 	case l.ch == '}':
 		tok.Type = token.RightBrace
+		if len(l.interpolations) > 0 {
+			l.interpolations[len(l.interpolations)-1].braceDepth--
+		}
+	case l.ch == '[':
+		tok.Type = token.LeftBracket
+	case l.ch == ']':
+		tok.Type = token.RightBracket
 	case l.ch == '"':
-		lit, terminated := l.consumeString()
+		delim, multiLine := `"`, false
+		if l.hasPrefix(`"""`) {
+			delim, multiLine = `"""`, true
+		}
+		l.skip(len(delim))
+		return l.consumeString(tok, startOffset, delim, multiLine, token.String, token.StringHead)
+	case l.ch == '`':
+		lit, terminated := l.consumeRawString()
 		tok.End = l.pos
 		tok.Lexeme = lit
 		if terminated {
 			tok.Type = token.String
+			tok.Literal = lit[1 : len(lit)-1]
 		} else {
 			tok.Type = token.Illegal
-			l.errHandler(tok, "unterminated string literal")
+			l.errHandler(tok, "unterminated raw string literal")
 		}
 		return tok
 	case isDigit(l.ch):
@@ -184,6 +261,11 @@ func (l *lexer) Next() token.Token {
 	return tok
 }
 
+// Comments returns the comments which have been skipped so far.
+func (l *lexer) Comments() []token.Token {
+	return l.comments
+}
+
 func (l *lexer) skipWhitespace() {
 	for isWhitespace(l.ch) {
 		l.next()
@@ -234,21 +316,139 @@ func (l *lexer) consumeNumber() string {
 	return b.String()
 }
 
-func (l *lexer) consumeString() (s string, terminated bool) {
-	l.next()
-	var b strings.Builder
-	b.WriteRune('"')
+// consumeString consumes the rest of a string literal which is delimited by delim, starting after either the opening
+// delimiter or the closing brace of an interpolated expression. tok is the token being lexed, which starts at
+// startOffset. If multiLine is false, then the literal must be terminated before the end of the line.
+// If the closing delimiter is reached, then the token is given the type endType. If the start of an interpolated
+// expression is reached, then the token is given the type interpType and the string literal is pushed onto the stack of
+// interpolations so that lexing of the literal can be resumed once the end of the expression is reached.
+func (l *lexer) consumeString(
+	tok token.Token, startOffset int, delim string, multiLine bool, endType token.Type, interpType token.Type,
+) token.Token {
+	var value strings.Builder
 	for {
-		if l.ch == eof || l.ch == '\n' || l.ch == '\r' {
-			return b.String(), false
+		switch {
+		case l.ch == eof || (!multiLine && (l.ch == '\n' || l.ch == '\r')):
+			tok.End = l.pos
+			tok.Type = token.Illegal
+			tok.Lexeme = string(l.src[startOffset:l.offset])
+			l.errHandler(tok, "unterminated string literal")
+			return tok
+		case l.hasPrefix(delim):
+			l.skip(len(delim))
+			tok.Type = endType
+		case l.hasPrefix("${"):
+			l.skip(len("${"))
+			tok.Type = interpType
+			l.interpolations = append(l.interpolations, &interpolation{delim: delim, multiLine: multiLine})
+		case l.ch == '\\':
+			value.WriteString(l.consumeEscapeSequence(multiLine))
+			continue
+		default:
+			value.WriteRune(l.ch)
+			l.next()
+			continue
 		}
+		tok.End = l.pos
+		tok.Lexeme = string(l.src[startOffset:l.offset])
+		tok.Literal = value.String()
+		return tok
+	}
+}
+
+// consumeEscapeSequence consumes an escape sequence in a string literal and returns the value that it represents. If
+// the escape sequence is invalid, then an error is reported and the returned value is empty. In a multi-line string
+// literal, a backslash at the end of a line is a line continuation and represents the empty string.
+func (l *lexer) consumeEscapeSequence(multiLine bool) string {
+	start := l.pos
+	var b strings.Builder
+	consume := func() {
+		b.WriteRune(l.ch)
+		l.next()
+	}
+	invalid := func(format string) string {
+		tok := token.Token{Start: start, End: l.pos, Type: token.Illegal, Lexeme: b.String()}
+		l.errHandler(tok, fmt.Sprintf(format, b.String()))
+		return ""
+	}
+
+	consume() // Backslash
+	ch := l.ch
+	switch ch {
+	case eof:
+		// The string literal is unterminated, which will be reported by the caller.
+		return ""
+	case '\r', '\n':
+		if !multiLine {
+			// The string literal is unterminated, which will be reported by the caller.
+			return ""
+		}
+		if l.ch == '\r' && l.peek() == '\n' {
+			consume()
+		}
+		consume()
+		return ""
+	case 'u':
+		consume()
+	default:
+		consume()
+		if value, ok := simpleEscapeValues[ch]; ok {
+			return value
+		}
+		return invalid("invalid escape sequence %s")
+	}
+
+	const invalidUnicodeFormat = `invalid unicode escape sequence %s, expected \u{X} where X is 1-6 hexadecimal digits`
+	if l.ch != '{' {
+		return invalid(invalidUnicodeFormat)
+	}
+	consume()
+	var digits strings.Builder
+	for isHexDigit(l.ch) {
+		digits.WriteRune(l.ch)
+		consume()
+	}
+	if l.ch != '}' {
+		return invalid(invalidUnicodeFormat)
+	}
+	consume()
+	if digits.Len() == 0 || digits.Len() > 6 {
+		return invalid(invalidUnicodeFormat)
+	}
+	codePoint, err := strconv.ParseUint(digits.String(), 16, 32)
+	if err != nil {
+		panic(fmt.Sprintf("unexpected error parsing unicode escape sequence: %s", err))
+	}
+	if r := rune(codePoint); utf8.ValidRune(r) {
+		return string(r)
+	}
+	return invalid("unicode escape sequence %s is not a valid code point")
+}
+
+var simpleEscapeValues = map[rune]string{
+	'"':  "\"",
+	'$':  "$",
+	'\\': "\\",
+	'n':  "\n",
+	'r':  "\r",
+	't':  "\t",
+}
+
+// consumeRawString consumes a raw string literal and returns it as it appears in the source code. Raw string literals
+// can span multiple lines and do not contain escape sequences.
+func (l *lexer) consumeRawString() (lit string, terminated bool) {
+	var b strings.Builder
+	b.WriteRune(l.ch)
+	l.next()
+	for l.ch != eof {
 		ch := l.ch
 		b.WriteRune(ch)
 		l.next()
-		if ch == '"' {
+		if ch == '`' {
 			return b.String(), true
 		}
 	}
+	return b.String(), false
 }
 
 func (l *lexer) consumeIdent() string {
@@ -273,6 +473,10 @@ func isDigit(r rune) bool {
 	return '0' <= r && r <= '9'
 }
 
+func isHexDigit(r rune) bool {
+	return isDigit(r) || ('a' <= r && r <= 'f') || ('A' <= r && r <= 'F')
+}
+
 func isAlpha(r rune) bool {
 	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || r == '_'
 }
@@ -323,6 +527,18 @@ func (l *lexer) next() {
 	l.ch = r
 }
 
+// skip advances the lexer by n characters.
+func (l *lexer) skip(n int) {
+	for range n {
+		l.next()
+	}
+}
+
+// hasPrefix reports whether the source code starting from the current character begins with prefix.
+func (l *lexer) hasPrefix(prefix string) bool {
+	return l.ch != eof && bytes.HasPrefix(l.src[l.offset:], []byte(prefix))
+}
+
 // peek returns the next character without advancing the lexer.
 // If the end of the source code has been reached, eof is returned.
 func (l *lexer) peek() rune {
@@ -54,6 +54,7 @@ func (p *parser) Parse() (ast.Program, error) {
 	for p.tok.Type != token.EOF {
 		program.Stmts = append(program.Stmts, p.safelyParseDecl())
 	}
+	program.Comments = p.l.Comments()
 	return program, p.errs.Err()
 }
 
@@ -82,7 +83,8 @@ func (p *parser) sync() token.Token {
 			finalTok := p.tok
 			p.next()
 			return finalTok
-		case token.Print, token.Var, token.If, token.LeftBrace, token.While, token.For, token.Break, token.Continue, token.EOF:
+		case token.Print, token.Var, token.Import, token.If, token.LeftBrace, token.While, token.For, token.Break,
+			token.Continue, token.Throw, token.Try, token.EOF:
 			return finalTok
 		}
 		finalTok = p.tok
@@ -99,6 +101,8 @@ func (p *parser) parseDecl() ast.Stmt {
 		return p.parseFunDecl(tok)
 	case p.match(token.Class):
 		return p.parseClassDecl(tok)
+	case p.match(token.Import):
+		return p.parseImportDecl(tok)
 	default:
 		return p.parseStmt()
 	}
@@ -128,6 +132,10 @@ func (p *parser) parseFunDecl(funTok token.Token) ast.FunDecl {
 
 func (p *parser) parseClassDecl(classTok token.Token) ast.ClassDecl {
 	name := p.expectf(token.Ident, "expected class name")
+	var superclass ast.Expr
+	if p.match(token.Less) {
+		superclass = p.parseCallExpr()
+	}
 	p.expect(token.LeftBrace)
 	var methods []ast.MethodDecl
 	for {
@@ -151,6 +159,7 @@ func (p *parser) parseClassDecl(classTok token.Token) ast.ClassDecl {
 	return ast.ClassDecl{
 		Class:      classTok,
 		Name:       name,
+		Superclass: superclass,
 		Body:       methods,
 		RightBrace: rightBrace,
 	}
@@ -165,6 +174,14 @@ const (
 	funTypeInit
 )
 
+func (p *parser) parseImportDecl(importTok token.Token) ast.ImportDecl {
+	path := p.expectf(token.String, "expected module path")
+	p.expect(token.As)
+	alias := p.expectf(token.Ident, "expected module name")
+	semicolon := p.expect(token.Semicolon)
+	return ast.ImportDecl{Import: importTok, Path: path, Alias: alias, Semicolon: semicolon}
+}
+
 func (p *parser) parseFunParamsAndBody(funType funType) ([]token.Token, ast.BlockStmt) {
 	// Break and continue are not allowed to jump out of a function so reset the loop depth to catch any invalid uses.
 	prevLoopDepth := p.loopDepth
@@ -225,6 +242,10 @@ func (p *parser) parseStmt() ast.Stmt {
 		return p.parseContinueStmt(tok)
 	case p.match(token.Return):
 		return p.parseReturnStmt(tok)
+	case p.match(token.Throw):
+		return p.parseThrowStmt(tok)
+	case p.match(token.Try):
+		return p.parseTryStmt(tok)
 	default:
 		return p.parseExprStmt()
 	}
@@ -334,6 +355,31 @@ func (p *parser) parseReturnStmt(returnTok token.Token) ast.ReturnStmt {
 	return stmt
 }
 
+func (p *parser) parseThrowStmt(throwTok token.Token) ast.ThrowStmt {
+	value := p.parseExpr()
+	semicolon := p.expect(token.Semicolon)
+	return ast.ThrowStmt{Throw: throwTok, Value: value, Semicolon: semicolon}
+}
+
+func (p *parser) parseTryStmt(tryTok token.Token) ast.TryStmt {
+	body := p.parseBlock(p.expect(token.LeftBrace))
+	stmt := ast.TryStmt{Try: tryTok, Body: body}
+	if p.match(token.Catch) {
+		p.expect(token.LeftParen)
+		stmt.CatchIdent = p.expectf(token.Ident, "expected catch variable name")
+		p.expect(token.RightParen)
+		stmt.CatchBody = p.parseBlock(p.expect(token.LeftBrace))
+	}
+	if p.match(token.Finally) {
+		stmt.FinallyBody = p.parseBlock(p.expect(token.LeftBrace))
+	}
+	if stmt.CatchBody == nil && stmt.FinallyBody == nil {
+		p.addTokenError(p.tok, "expected %m or %m", token.Catch, token.Finally)
+		panic(unwind{})
+	}
+	return stmt
+}
+
 func (p *parser) parseExpr() ast.Expr {
 	return p.parseCommaExpr()
 }
@@ -359,6 +405,13 @@ func (p *parser) parseAssignmentExpr() ast.Expr {
 				Name:   left.Name,
 				Value:  right,
 			}
+		case ast.IndexExpr:
+			right := p.parseAssignmentExpr()
+			expr = ast.IndexSetExpr{
+				Object: left.Object,
+				Index:  left.Index,
+				Value:  right,
+			}
 		default:
 			p.addNodeError(expr, "invalid assignment target")
 		}
@@ -457,12 +510,41 @@ func (p *parser) parseCallExpr() ast.Expr {
 				Object: expr,
 				Name:   name,
 			}
+		case p.match(token.LeftBracket):
+			expr = p.parseIndexOrSliceExpr(expr)
 		default:
 			return expr
 		}
 	}
 }
 
+func (p *parser) parseIndexOrSliceExpr(object ast.Expr) ast.Expr {
+	var index ast.Expr
+	if p.tok.Type != token.Colon {
+		index = p.parseAssignmentExpr()
+	}
+	if !p.match(token.Colon) {
+		rightBracket := p.expect(token.RightBracket)
+		return ast.IndexExpr{
+			Object:       object,
+			Index:        index,
+			RightBracket: rightBracket,
+		}
+	}
+	var high ast.Expr
+	rightBracket, ok := p.match2(token.RightBracket)
+	if !ok {
+		high = p.parseAssignmentExpr()
+		rightBracket = p.expect(token.RightBracket)
+	}
+	return ast.SliceExpr{
+		Object:       object,
+		Low:          index,
+		High:         high,
+		RightBracket: rightBracket,
+	}
+}
+
 func (p *parser) parseArgs() []ast.Expr {
 	var args []ast.Expr
 	args = append(args, p.parseAssignmentExpr())
@@ -479,6 +561,8 @@ func (p *parser) parsePrimaryExpr() ast.Expr {
 	switch tok := p.tok; {
 	case p.match(token.Number, token.String, token.True, token.False, token.Nil):
 		return ast.LiteralExpr{Value: tok}
+	case p.match(token.StringHead):
+		return p.parseInterpolationExpr(tok)
 	case p.match(token.Ident):
 		return ast.VariableExpr{Name: tok}
 	case p.match(token.This):
@@ -486,12 +570,24 @@ func (p *parser) parsePrimaryExpr() ast.Expr {
 			p.addTokenError(tok, "%m can only be used inside a method definition", token.This)
 		}
 		return ast.ThisExpr{This: tok}
+	case p.match(token.Super):
+		if p.curFunType != funTypeMethod && p.curFunType != funTypeInit {
+			p.addTokenError(tok, "%m can only be used inside a method definition", token.Super)
+		}
+		p.expect(token.Dot)
+		method := p.expectf(token.Ident, "expected superclass method name")
+		return ast.SuperExpr{Super: tok, Method: method}
 	case p.match(token.Fun):
 		return p.parseFunExpr(tok)
 	case p.match(token.LeftParen):
 		expr := p.parseExpr()
 		rightParen := p.expect(token.RightParen)
 		return ast.GroupExpr{LeftParen: tok, Expr: expr, RightParen: rightParen}
+	case p.match(token.LeftBracket):
+		return p.parseListExpr(tok)
+	case p.match(token.LeftBrace):
+		// Block statements are parsed by parseStmt, so a left brace at the start of an expression must be a map.
+		return p.parseMapExpr(tok)
 	// Error productions
 	case p.match(token.EqualEqual, token.BangEqual, token.Less, token.LessEqual, token.Greater, token.GreaterEqual, token.Asterisk, token.Slash, token.Plus):
 		p.addTokenError(tok, "binary operator %m must have left and right operands", tok.Type)
@@ -526,6 +622,61 @@ func (p *parser) parseFunExpr(funTok token.Token) ast.FunExpr {
 	}
 }
 
+func (p *parser) parseInterpolationExpr(head token.Token) ast.InterpolationExpr {
+	parts := []ast.Expr{ast.LiteralExpr{Value: head}}
+	for {
+		parts = append(parts, p.parseExpr())
+		if middle, ok := p.match2(token.StringMiddle); ok {
+			parts = append(parts, ast.LiteralExpr{Value: middle})
+			continue
+		}
+		tail := p.expectf(token.StringTail, "expected %m", token.RightBrace)
+		parts = append(parts, ast.LiteralExpr{Value: tail})
+		return ast.InterpolationExpr{Parts: parts}
+	}
+}
+
+func (p *parser) parseListExpr(leftBracket token.Token) ast.ListExpr {
+	var elements []ast.Expr
+	rightBracket, ok := p.match2(token.RightBracket)
+	if !ok {
+		elements = append(elements, p.parseAssignmentExpr())
+		for p.match(token.Comma) {
+			elements = append(elements, p.parseAssignmentExpr())
+		}
+		rightBracket = p.expect(token.RightBracket)
+	}
+	return ast.ListExpr{
+		LeftBracket:  leftBracket,
+		Elements:     elements,
+		RightBracket: rightBracket,
+	}
+}
+
+func (p *parser) parseMapExpr(leftBrace token.Token) ast.MapExpr {
+	var entries []ast.MapEntry
+	rightBrace, ok := p.match2(token.RightBrace)
+	if !ok {
+		entries = append(entries, p.parseMapEntry())
+		for p.match(token.Comma) {
+			entries = append(entries, p.parseMapEntry())
+		}
+		rightBrace = p.expect(token.RightBrace)
+	}
+	return ast.MapExpr{
+		LeftBrace:  leftBrace,
+		Entries:    entries,
+		RightBrace: rightBrace,
+	}
+}
+
+func (p *parser) parseMapEntry() ast.MapEntry {
+	key := p.parseAssignmentExpr()
+	p.expect(token.Colon)
+	value := p.parseAssignmentExpr()
+	return ast.MapEntry{Key: key, Value: value}
+}
+
 // match returns whether the current token is one of the given types and advances the parser if so.
 func (p *parser) match(types ...token.Type) bool {
 	for _, t := range types {
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/parser"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+const (
+	replPrompt             = ">>> "
+	replContinuationPrompt = "... "
+)
+
+const replHelp = `Commands:
+  :help           Display this help
+  :env            Display the global declarations
+  :ast code       Display the AST of some code without running it
+  :type expr      Evaluate an expression and display the type of its value
+  :load path      Run a file in the current session
+  :reset          Discard all declarations and start a new session
+Incomplete input, such as a function whose body hasn't been closed, is continued on the next line after a ... prompt.
+Enter a blank line to run incomplete input anyway, or press Ctrl-C to discard it.`
+
+// replCommands are the commands which are supported by the REPL.
+var replCommands = []string{":help", ":env", ":ast", ":type", ":load", ":reset"}
+
+func runREPL() error {
+	runner := newRunner(true, nil)
+	cfg := &readline.Config{
+		Prompt:       replPrompt,
+		AutoComplete: completer{runner: &runner},
+		Painter:      highlighter{},
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err == nil {
+		cfg.HistoryFile = path.Join(homeDir, ".lox_history")
+	} else {
+		fmt.Fprintf(os.Stderr, "Can't get current user's home directory (%s). Command history will not be saved.\n", err)
+	}
+
+	rl, err := readline.NewEx(cfg)
+	if err != nil {
+		return fmt.Errorf("running Lox REPL: %s", err)
+	}
+	defer rl.Close()
+
+	fmt.Fprintln(os.Stderr, "Welcome to the Lox REPL. Type :help for a list of commands or press Ctrl-D to exit.")
+
+	var lines []string
+	for {
+		if len(lines) == 0 {
+			rl.SetPrompt(replPrompt)
+		} else {
+			rl.SetPrompt(replContinuationPrompt)
+		}
+		line, err := rl.Readline()
+		if err != nil {
+			if errors.Is(err, readline.ErrInterrupt) {
+				lines = nil
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			panic(fmt.Sprintf("unexpected error from readline: %s", err))
+		}
+
+		if len(lines) == 0 {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, ":") {
+				cmd, arg, _ := strings.Cut(trimmed, " ")
+				runner = runREPLCommand(runner, cmd, strings.TrimSpace(arg))
+				continue
+			}
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+		}
+		src := strings.Join(lines, "\n")
+		if _, err := parser.Parse(strings.NewReader(src)); err != nil && line != "" && incomplete(src, err) {
+			continue
+		}
+		lines = nil
+		if err := run(strings.NewReader(src), runner); err != nil {
+			var exitErr *lox.ExitError
+			if errors.As(err, &exitErr) {
+				// The REPL exits with the code that the program passed to exit.
+				return exitErr
+			}
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	return nil
+}
+
+// runREPLCommand runs a REPL command with the given argument and returns the runner which should be used from now on.
+func runREPLCommand(runner runner, cmd string, arg string) runner {
+	var err error
+	switch cmd {
+	case ":help":
+		fmt.Fprintln(os.Stderr, replHelp)
+	case ":env":
+		fmt.Println(runner.DumpGlobals())
+	case ":ast":
+		var program ast.Program
+		program, err = parser.Parse(strings.NewReader(arg))
+		if err == nil {
+			ast.Print(program)
+		}
+	case ":type":
+		err = runType(runner, arg)
+	case ":load":
+		err = runLoad(runner, arg)
+	case ":reset":
+		runner = newRunner(true, nil)
+	default:
+		err = fmt.Errorf("unknown command %s, type :help for a list of commands", cmd)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return runner
+}
+
+// runType evaluates an expression and prints the type of its value.
+func runType(runner runner, src string) error {
+	program, err := parser.Parse(strings.NewReader(src + ";"))
+	if err != nil {
+		return err
+	}
+	var stmt ast.ExprStmt
+	if len(program.Stmts) == 1 {
+		stmt, _ = program.Stmts[0].(ast.ExprStmt)
+	}
+	if stmt.Expr == nil {
+		return errors.New("usage: :type expr")
+	}
+	// The type built-in function can't be redeclared, so wrapping the expression in a call to it is safe. The runner
+	// then prints the result of the call, since it's in REPL mode.
+	typeIdent := token.Token{Type: token.Ident, Lexeme: "type", Start: stmt.Expr.Start(), End: stmt.Expr.Start()}
+	stmt.Expr = ast.CallExpr{
+		Callee:     ast.VariableExpr{Name: typeIdent},
+		Args:       []ast.Expr{stmt.Expr},
+		RightParen: token.Token{Type: token.RightParen, Lexeme: ")", Start: stmt.Expr.End(), End: stmt.Expr.End()},
+	}
+	program.Stmts[0] = stmt
+	return runner.Interpret(program)
+}
+
+// runLoad runs a file in the REPL's session, so that its declarations can be used afterwards.
+func runLoad(runner runner, name string) error {
+	if name == "" {
+		return errors.New("usage: :load path")
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return run(f, runner)
+}
+
+// incomplete reports whether a parse error was caused by the source code ending before a complete program was
+// entered. For example, if a block hasn't been closed or the semicolon at the end of a statement is missing.
+func incomplete(src string, err error) bool {
+	endLine := strings.Count(src, "\n") + 1
+	endColumn := len(src) - (strings.LastIndex(src, "\n") + 1)
+	var errs []error
+	if joinedErr, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joinedErr.Unwrap()
+	} else {
+		errs = []error{err}
+	}
+	for _, err := range errs {
+		var loxErr *lox.Error
+		if errors.As(err, &loxErr) && loxErr.Start().Line == endLine && loxErr.Start().Column == endColumn {
+			return true
+		}
+	}
+	return false
+}
+
+// completer completes REPL commands at the start of the line, the properties of a value after a ., and otherwise
+// keywords and global identifiers.
+type completer struct {
+	runner *runner // runner which is currently being used by the REPL
+}
+
+func (c completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	text := line[:pos]
+	start := identStart(text)
+	prefix := string(text[start:])
+	var candidates []string
+	switch {
+	case len(text) > 0 && text[0] == ':' && !slices.Contains(text, ' '):
+		prefix = string(text)
+		candidates = replCommands
+	case start > 0 && text[start-1] == '.':
+		candidates = (*c.runner).PropertyNames(propertyPath(text[:start-1]))
+	default:
+		candidates = append(token.Keywords(), (*c.runner).GlobalIdents()...)
+		slices.Sort(candidates)
+	}
+	for _, candidate := range candidates {
+		if suffix, ok := strings.CutPrefix(candidate, prefix); ok {
+			newLine = append(newLine, []rune(suffix))
+		}
+	}
+	return newLine, len([]rune(prefix))
+}
+
+// identStart returns the index of the start of the identifier at the end of text. len(text) is returned if text
+// doesn't end with an identifier.
+func identStart(text []rune) int {
+	start := len(text)
+	for start > 0 && (text[start-1] == '_' || unicode.IsLetter(text[start-1]) || unicode.IsDigit(text[start-1])) {
+		start--
+	}
+	return start
+}
+
+// propertyPath returns the names in the property access expression of the form a.b.c at the end of text. nil is
+// returned if text doesn't end with such an expression.
+func propertyPath(text []rune) []string {
+	var path []string
+	for {
+		start := identStart(text)
+		if start == len(text) {
+			return nil
+		}
+		path = append([]string{string(text[start:])}, path...)
+		if start == 0 || text[start-1] != '.' {
+			return path
+		}
+		text = text[:start-1]
+	}
+}
+
+var (
+	keywordColour = color.New(color.FgMagenta)
+	stringColour  = color.New(color.FgGreen)
+	numberColour  = color.New(color.FgCyan)
+	commentColour = color.New(color.FgHiBlack)
+	illegalColour = color.New(color.FgRed)
+)
+
+// highlighter colours the tokens in the line which is being edited.
+type highlighter struct{}
+
+func (highlighter) Paint(line []rune, _ int) []rune {
+	src := string(line)
+	toks, err := parser.Lex(strings.NewReader(src))
+	if err != nil {
+		return line
+	}
+	var b strings.Builder
+	offset := 0
+	for _, tok := range toks {
+		var colour *color.Color
+		switch {
+		case tok.Type.IsKeyword():
+			colour = keywordColour
+		case tok.Type == token.String || tok.Type == token.StringHead || tok.Type == token.StringMiddle ||
+			tok.Type == token.StringTail:
+			colour = stringColour
+		case tok.Type == token.Number:
+			colour = numberColour
+		case tok.Type == token.Comment:
+			colour = commentColour
+		case tok.Type == token.Illegal:
+			colour = illegalColour
+		default:
+			continue
+		}
+		// The line doesn't contain any newlines, so the column of a position is its offset.
+		b.WriteString(src[offset:tok.Start.Column])
+		b.WriteString(colour.Sprint(src[tok.Start.Column:tok.End.Column]))
+		offset = tok.End.Column
+	}
+	b.WriteString(src[offset:])
+	return []rune(b.String())
+}
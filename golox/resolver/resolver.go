@@ -0,0 +1,640 @@
+// Package resolver implements static analysis of Lox programs which resolves identifiers to their declarations.
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// Local identifies the declaration of the local variable that an identifier refers to.
+type Local struct {
+	// Depth is the number of scopes between the identifier and the declaration. A depth of 0 means that the identifier
+	// was declared in the current scope, 1 means it was declared in the parent scope, and so on.
+	Depth int
+	// Slot is the index of the declaration in its scope. Declarations are assigned slots in the order that they appear,
+	// excluding declarations of [token.BlankIdent].
+	Slot int
+}
+
+// DeclKind is the kind of a declaration.
+type DeclKind int
+
+const (
+	DeclKindVariable DeclKind = iota
+	DeclKindFunction
+	DeclKindClass
+	DeclKindParameter
+	DeclKindImport
+)
+
+func (k DeclKind) String() string {
+	switch k {
+	case DeclKindVariable:
+		return "variable"
+	case DeclKindFunction:
+		return "function"
+	case DeclKindClass:
+		return "class"
+	case DeclKindParameter:
+		return "parameter"
+	case DeclKindImport:
+		return "import"
+	default:
+		return fmt.Sprintf("DeclKind(%d)", int(k))
+	}
+}
+
+// Decl is a declaration of an identifier.
+type Decl struct {
+	Kind DeclKind
+	Name token.Token
+	// Node is the node which contains the declaration. This is the declaration statement for variables, functions,
+	// classes, and imports, the function for parameters, and the try statement for catch variables.
+	Node ast.Node
+}
+
+// Idents describes the identifiers in a program and the declarations that they refer to.
+type Idents struct {
+	// Decls contains the declarations in the program in the order that they appear, excluding declarations of
+	// [token.BlankIdent].
+	Decls []*Decl
+	// DeclsByTok maps identifier tokens to the declarations that they refer to. The tokens which name the declarations
+	// themselves are not included. If a token is not present in the map, then the identifier that it refers to was
+	// either declared outside of the program, such as a built-in function, or not at all.
+	DeclsByTok map[token.Token]*Decl
+}
+
+// Resolve resolves the identifier tokens in a program to the declarations that they refer to.
+// It returns a map from identifier tokens to the local variable declarations that they refer to.
+// If a token is not present in the map, then the identifier that it refers to was either declared globally or not at
+// all.
+func Resolve(program ast.Program) (map[token.Token]Local, error) {
+	r := newResolver()
+	r.resolveProgram(program)
+	if err := r.errs.Err(); err != nil {
+		return nil, err
+	}
+	return r.localsByTok, nil
+}
+
+// ResolveInScopes is like [Resolve] but resolves a program as if it appeared inside nested local scopes which have
+// already been declared, such as an expression which a debugger evaluates in a paused function. scopes contains the
+// identifiers declared in each scope, indexed by slot, ordered from the outermost scope to the innermost.
+func ResolveInScopes(program ast.Program, scopes [][]string) (map[token.Token]Local, error) {
+	r := newResolver()
+	for _, idents := range scopes {
+		s := scope{}
+		for slot, name := range idents {
+			s[name] = &ident{Token: token.Token{Lexeme: name}, Slot: slot, Status: identStatusDefined | identStatusUsed}
+		}
+		r.scopes.Push(s)
+	}
+	r.resolveProgram(program)
+	if err := r.errs.Err(); err != nil {
+		return nil, err
+	}
+	return r.localsByTok, nil
+}
+
+// ResolveIdents resolves the identifier tokens in a program to the declarations that they refer to, including global
+// declarations. It's intended for tools such as language servers, so unlike [Resolve], the result is returned even if
+// the program contains errors.
+func ResolveIdents(program ast.Program) (*Idents, error) {
+	r := newResolver()
+	r.resolveProgram(program)
+	for _, tok := range r.globalIdentToks {
+		if decl, ok := r.globalDeclsByName[tok.Lexeme]; ok {
+			r.idents.DeclsByTok[tok] = decl
+		}
+	}
+	return r.idents, r.errs.Err()
+}
+
+type resolver struct {
+	scopes       *stack[scope]
+	curClassType classType
+
+	// map of identifier tokens to the local variable declarations that they refer to
+	localsByTok map[token.Token]Local
+
+	idents            *Idents
+	globalDeclsByName map[string]*Decl
+	globalIdentToks   []token.Token // identifier tokens which don't refer to a local declaration
+
+	errs lox.Errors
+}
+
+func newResolver() *resolver {
+	return &resolver{
+		scopes:            newStack[scope](),
+		localsByTok:       map[token.Token]Local{},
+		idents:            &Idents{DeclsByTok: map[token.Token]*Decl{}},
+		globalDeclsByName: map[string]*Decl{},
+	}
+}
+
+type classType int
+
+const (
+	classTypeNone classType = iota
+	classTypeClass
+	classTypeSubclass
+)
+
+type identStatus int
+
+const (
+	identStatusDeclared identStatus = iota
+	identStatusDefined              = 1 << iota
+	identStatusUsed
+)
+
+type ident struct {
+	Status identStatus
+	Token  token.Token
+	Slot   int
+	Decl   *Decl // nil if the identifier was declared implicitly, such as this and super
+}
+
+// scope represents a lexical scope and keeps track of the identifiers declared in that scope
+type scope map[string]*ident
+
+// Declare marks an identifier as declared in the scope, unless it's [token.BlankIdent].
+func (s scope) Declare(name string) {
+	s[name] = &ident{Token: token.Token{Lexeme: name}, Slot: len(s)}
+}
+
+// DeclareFromDecl marks the identifier named by a declaration as declared in the scope.
+func (s scope) DeclareFromDecl(decl *Decl) {
+	s[decl.Name.Lexeme] = &ident{Token: decl.Name, Slot: len(s), Decl: decl}
+}
+
+// Define marks an identifier as defined in the scope.
+func (s scope) Define(name string) {
+	s[name].Status |= identStatusDefined
+}
+
+// Use marks an identifier as used in the scope.
+func (s scope) Use(name string) {
+	s[name].Status |= identStatusUsed
+}
+
+// IsDeclared reports whether the identifier has been declared in the scope.
+func (s scope) IsDeclared(name string) bool {
+	_, ok := s[name]
+	return ok
+}
+
+// IsDefined reports whether the identifier has been defined in the scope.
+func (s scope) IsDefined(name string) bool {
+	return s[name].Status&identStatusDefined != 0
+}
+
+// UnusedIdents returns the identifier tokens in the scope that have been declared but not used.
+func (s scope) UnusedIdents() []token.Token {
+	var unused []token.Token
+	for _, info := range s {
+		if info.Status&identStatusUsed == 0 {
+			unused = append(unused, info.Token)
+		}
+	}
+	return unused
+}
+
+// beginScope creates a new scope and returns a function that ends the scope
+func (r *resolver) beginScope() func() {
+	r.scopes.Push(scope{})
+	return func() {
+		scope := r.scopes.Pop()
+		for _, tok := range scope.UnusedIdents() {
+			r.errs.AddFromToken(tok, "%s has been declared but is never used", tok.Lexeme)
+		}
+	}
+}
+
+// declareIdent declares an identifier in the current scope, unless it's [token.BlankIdent]. node is the node which
+// contains the declaration, as described by [Decl].
+func (r *resolver) declareIdent(tok token.Token, kind DeclKind, node ast.Node) {
+	if tok.Lexeme == token.BlankIdent {
+		return
+	}
+	decl := &Decl{Kind: kind, Name: tok, Node: node}
+	if r.scopes.Len() == 0 {
+		// Redeclaring a global is a runtime error, so only the first declaration can be referred to.
+		if _, ok := r.globalDeclsByName[tok.Lexeme]; !ok {
+			r.globalDeclsByName[tok.Lexeme] = decl
+		}
+		r.idents.Decls = append(r.idents.Decls, decl)
+		return
+	}
+	if scope := r.scopes.Peek(); scope.IsDeclared(tok.Lexeme) {
+		r.errs.AddFromToken(tok, "%s has already been declared", tok.Lexeme)
+	} else {
+		scope.DeclareFromDecl(decl)
+		r.idents.Decls = append(r.idents.Decls, decl)
+	}
+}
+
+func (r *resolver) defineIdent(tok token.Token) {
+	for i := r.scopes.Len() - 1; i >= 0; i-- {
+		if scope := r.scopes.Index(i); scope.IsDeclared(tok.Lexeme) {
+			scope.Define(tok.Lexeme)
+			return
+		}
+	}
+	// The identifier will either be declared globally later in the program or not at all
+}
+
+type identOp int
+
+const (
+	identOpRead identOp = iota
+	identOpWrite
+)
+
+func (r *resolver) resolveIdent(tok token.Token, op identOp) {
+	for i := r.scopes.Len() - 1; i >= 0; i-- {
+		if scope := r.scopes.Index(i); scope.IsDeclared(tok.Lexeme) {
+			scope.Use(tok.Lexeme)
+			if decl := scope[tok.Lexeme].Decl; decl != nil {
+				r.idents.DeclsByTok[tok] = decl
+			}
+			if !scope.IsDefined(tok.Lexeme) && op == identOpRead {
+				r.errs.AddFromToken(tok, "%s has not been defined", tok.Lexeme)
+			} else {
+				r.localsByTok[tok] = Local{Depth: r.scopes.Len() - 1 - i, Slot: scope[tok.Lexeme].Slot}
+			}
+			return
+		}
+	}
+	// The identifier will either be declared globally later in the program or not at all
+	r.globalIdentToks = append(r.globalIdentToks, tok)
+}
+
+func (r *resolver) resolveProgram(program ast.Program) {
+	for _, stmt := range program.Stmts {
+		r.resolveStmt(stmt)
+	}
+}
+
+func (r *resolver) resolveStmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case ast.VarDecl:
+		r.resolveVarDecl(stmt)
+	case ast.FunDecl:
+		r.resolveFunDecl(stmt)
+	case ast.ClassDecl:
+		r.resolveClassDecl(stmt)
+	case ast.ImportDecl:
+		r.resolveImportDecl(stmt)
+	case ast.ExprStmt:
+		r.resolveExprStmt(stmt)
+	case ast.PrintStmt:
+		r.resolvePrintStmt(stmt)
+	case ast.BlockStmt:
+		r.resolveBlockStmt(stmt)
+	case ast.IfStmt:
+		r.resolveIfStmt(stmt)
+	case ast.WhileStmt:
+		r.resolveWhileStmt(stmt)
+	case ast.ForStmt:
+		r.resolveForStmt(stmt)
+	case ast.BreakStmt:
+	case ast.ContinueStmt:
+		// Nothing to resolve
+	case ast.ReturnStmt:
+		r.resolveReturnStmt(stmt)
+	case ast.ThrowStmt:
+		r.resolveThrowStmt(stmt)
+	case ast.TryStmt:
+		r.resolveTryStmt(stmt)
+	case ast.IllegalStmt:
+		// Nothing to resolve. These are only present in programs which failed to parse, which are only resolved by
+		// tools.
+	default:
+		panic(fmt.Sprintf("unexpected statement type: %T", stmt))
+	}
+}
+
+func (r *resolver) resolveVarDecl(stmt ast.VarDecl) {
+	if stmt.Initialiser != nil {
+		r.resolveExpr(stmt.Initialiser)
+		r.declareIdent(stmt.Name, DeclKindVariable, stmt)
+		r.defineIdent(stmt.Name)
+	} else {
+		r.declareIdent(stmt.Name, DeclKindVariable, stmt)
+	}
+}
+
+func (r *resolver) resolveFunDecl(stmt ast.FunDecl) {
+	r.declareIdent(stmt.Name, DeclKindFunction, stmt)
+	r.defineIdent(stmt.Name)
+	r.resolveFun(stmt, stmt.Params, stmt.Body)
+}
+
+func (r *resolver) resolveImportDecl(stmt ast.ImportDecl) {
+	r.declareIdent(stmt.Alias, DeclKindImport, stmt)
+	r.defineIdent(stmt.Alias)
+}
+
+// resolveFun resolves the parameters and body of fun, which is a function or method declaration or function expression.
+func (r *resolver) resolveFun(fun ast.Node, params []token.Token, body []ast.Stmt) {
+	endScope := r.beginScope()
+	defer endScope()
+	for _, param := range params {
+		r.declareIdent(param, DeclKindParameter, fun)
+		r.defineIdent(param)
+	}
+	for _, stmt := range body {
+		r.resolveStmt(stmt)
+	}
+}
+
+func (r *resolver) resolveClassDecl(stmt ast.ClassDecl) {
+	r.declareIdent(stmt.Name, DeclKindClass, stmt)
+	r.defineIdent(stmt.Name)
+
+	prevClassType := r.curClassType
+	r.curClassType = classTypeClass
+	defer func() { r.curClassType = prevClassType }()
+
+	if stmt.Superclass != nil {
+		r.curClassType = classTypeSubclass
+		if superclass, ok := stmt.Superclass.(ast.VariableExpr); ok && superclass.Name.Lexeme == stmt.Name.Lexeme {
+			r.errs.AddFromNode(superclass, "class cannot inherit from itself")
+		}
+		r.resolveExpr(stmt.Superclass)
+		endSuperScope := r.beginScope()
+		defer endSuperScope()
+		scope := r.scopes.Peek()
+		scope.Declare(token.SuperIdent)
+		scope.Define(token.SuperIdent)
+		scope.Use(token.SuperIdent)
+	}
+
+	endScope := r.beginScope()
+	defer endScope()
+	scope := r.scopes.Peek()
+	scope.Declare(token.ThisIdent)
+	scope.Define(token.ThisIdent)
+	scope.Use(token.ThisIdent)
+	for _, method := range stmt.Body {
+		r.resolveFun(method, method.Params, method.Body)
+	}
+}
+
+func (r *resolver) resolveExprStmt(stmt ast.ExprStmt) {
+	r.resolveExpr(stmt.Expr)
+}
+
+func (r *resolver) resolvePrintStmt(stmt ast.PrintStmt) {
+	r.resolveExpr(stmt.Expr)
+}
+
+func (r *resolver) resolveBlockStmt(stmt ast.BlockStmt) {
+	exitScope := r.beginScope()
+	defer exitScope()
+	for _, stmt := range stmt.Stmts {
+		r.resolveStmt(stmt)
+	}
+}
+
+func (r *resolver) resolveIfStmt(stmt ast.IfStmt) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.Then)
+	if stmt.Else != nil {
+		r.resolveStmt(stmt.Else)
+	}
+}
+
+func (r *resolver) resolveWhileStmt(stmt ast.WhileStmt) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.Body)
+}
+
+func (r *resolver) resolveForStmt(stmt ast.ForStmt) {
+	endScope := r.beginScope()
+	defer endScope()
+	if stmt.Initialise != nil {
+		r.resolveStmt(stmt.Initialise)
+	}
+	if stmt.Condition != nil {
+		r.resolveExpr(stmt.Condition)
+	}
+	if stmt.Update != nil {
+		r.resolveExpr(stmt.Update)
+	}
+	r.resolveStmt(stmt.Body)
+}
+
+func (r *resolver) resolveReturnStmt(stmt ast.ReturnStmt) {
+	if stmt.Value != nil {
+		r.resolveExpr(stmt.Value)
+	}
+}
+
+func (r *resolver) resolveThrowStmt(stmt ast.ThrowStmt) {
+	r.resolveExpr(stmt.Value)
+}
+
+func (r *resolver) resolveTryStmt(stmt ast.TryStmt) {
+	r.resolveBlockStmt(stmt.Body)
+	if stmt.CatchBody != nil {
+		endScope := r.beginScope()
+		r.declareIdent(stmt.CatchIdent, DeclKindVariable, stmt)
+		r.defineIdent(stmt.CatchIdent)
+		r.resolveStmt(stmt.CatchBody)
+		endScope()
+	}
+	if stmt.FinallyBody != nil {
+		r.resolveStmt(stmt.FinallyBody)
+	}
+}
+
+func (r *resolver) resolveExpr(expr ast.Expr) {
+	switch expr := expr.(type) {
+	case ast.FunExpr:
+		r.resolveFunExpr(expr)
+	case ast.GroupExpr:
+		r.resolveGroupExpr(expr)
+	case ast.LiteralExpr:
+		// Nothing to resolve
+	case ast.InterpolationExpr:
+		r.resolveInterpolationExpr(expr)
+	case ast.ListExpr:
+		r.resolveListExpr(expr)
+	case ast.MapExpr:
+		r.resolveMapExpr(expr)
+	case ast.VariableExpr:
+		r.resolveVariableExpr(expr)
+	case ast.ThisExpr:
+		r.resolveThisExpr(expr)
+	case ast.SuperExpr:
+		r.resolveSuperExpr(expr)
+	case ast.CallExpr:
+		r.resolveCallExpr(expr)
+	case ast.GetExpr:
+		r.resolveGetExpr(expr)
+	case ast.IndexExpr:
+		r.resolveIndexExpr(expr)
+	case ast.SliceExpr:
+		r.resolveSliceExpr(expr)
+	case ast.UnaryExpr:
+		r.resolveUnaryExpr(expr)
+	case ast.BinaryExpr:
+		r.resolveBinaryExpr(expr)
+	case ast.TernaryExpr:
+		r.resolveTernaryExpr(expr)
+	case ast.AssignmentExpr:
+		r.resolveAssignmentExpr(expr)
+	case ast.SetExpr:
+		r.resolveSetExpr(expr)
+	case ast.IndexSetExpr:
+		r.resolveIndexSetExpr(expr)
+	default:
+		panic(fmt.Sprintf("unexpected expression type: %T", expr))
+	}
+}
+
+func (r *resolver) resolveFunExpr(expr ast.FunExpr) {
+	r.resolveFun(expr, expr.Params, expr.Body)
+}
+
+func (r *resolver) resolveGroupExpr(expr ast.GroupExpr) {
+	r.resolveExpr(expr.Expr)
+}
+
+func (r *resolver) resolveInterpolationExpr(expr ast.InterpolationExpr) {
+	for _, part := range expr.Parts {
+		r.resolveExpr(part)
+	}
+}
+
+func (r *resolver) resolveListExpr(expr ast.ListExpr) {
+	for _, element := range expr.Elements {
+		r.resolveExpr(element)
+	}
+}
+
+func (r *resolver) resolveMapExpr(expr ast.MapExpr) {
+	for _, entry := range expr.Entries {
+		r.resolveExpr(entry.Key)
+		r.resolveExpr(entry.Value)
+	}
+}
+
+func (r *resolver) resolveVariableExpr(expr ast.VariableExpr) {
+	if expr.Name.Lexeme == token.BlankIdent {
+		r.errs.AddFromToken(expr.Name, "blank identifier _ cannot be used in a non-assignment expression")
+	} else {
+		r.resolveIdent(expr.Name, identOpRead)
+	}
+}
+
+func (r *resolver) resolveThisExpr(expr ast.ThisExpr) {
+	r.resolveIdent(expr.This, identOpRead)
+}
+
+func (r *resolver) resolveSuperExpr(expr ast.SuperExpr) {
+	if r.curClassType != classTypeSubclass {
+		r.errs.AddFromToken(expr.Super, "%m can only be used inside a subclass", token.Super)
+		return
+	}
+	r.resolveIdent(expr.Super, identOpRead)
+}
+
+func (r *resolver) resolveBinaryExpr(expr ast.BinaryExpr) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+}
+
+func (r *resolver) resolveTernaryExpr(expr ast.TernaryExpr) {
+	r.resolveExpr(expr.Condition)
+	r.resolveExpr(expr.Then)
+	r.resolveExpr(expr.Else)
+}
+
+func (r *resolver) resolveCallExpr(expr ast.CallExpr) {
+	r.resolveExpr(expr.Callee)
+	for _, arg := range expr.Args {
+		r.resolveExpr(arg)
+	}
+}
+
+func (r *resolver) resolveGetExpr(expr ast.GetExpr) {
+	r.resolveExpr(expr.Object)
+}
+
+func (r *resolver) resolveIndexExpr(expr ast.IndexExpr) {
+	r.resolveExpr(expr.Object)
+	r.resolveExpr(expr.Index)
+}
+
+func (r *resolver) resolveSliceExpr(expr ast.SliceExpr) {
+	r.resolveExpr(expr.Object)
+	if expr.Low != nil {
+		r.resolveExpr(expr.Low)
+	}
+	if expr.High != nil {
+		r.resolveExpr(expr.High)
+	}
+}
+
+func (r *resolver) resolveUnaryExpr(expr ast.UnaryExpr) {
+	r.resolveExpr(expr.Right)
+}
+
+func (r *resolver) resolveAssignmentExpr(expr ast.AssignmentExpr) {
+	r.resolveExpr(expr.Right)
+	r.resolveIdent(expr.Left, identOpWrite)
+	r.defineIdent(expr.Left)
+}
+
+func (r *resolver) resolveSetExpr(expr ast.SetExpr) {
+	r.resolveExpr(expr.Value)
+	r.resolveExpr(expr.Object)
+}
+
+func (r *resolver) resolveIndexSetExpr(expr ast.IndexSetExpr) {
+	r.resolveExpr(expr.Value)
+	r.resolveExpr(expr.Object)
+	r.resolveExpr(expr.Index)
+}
+
+type stack[T any] []T
+
+func newStack[T any]() *stack[T] {
+	return &stack[T]{}
+}
+
+func (s *stack[T]) Push(v T) {
+	*s = append(*s, v)
+}
+
+func (s *stack[T]) Pop() T {
+	if len(*s) == 0 {
+		panic("pop from empty stack")
+	}
+	v := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return v
+}
+
+func (s *stack[T]) Peek() T {
+	if len(*s) == 0 {
+		panic("peek of empty stack")
+	}
+	return (*s)[len(*s)-1]
+}
+
+func (s *stack[T]) Len() int {
+	return len(*s)
+}
+
+// TODO: delete this when we can replace its use with an interator in Go 1.23
+func (s *stack[T]) Index(i int) T {
+	return (*s)[i]
+}
@@ -23,6 +23,8 @@ const (
 	BlankIdent = "_"
 	// ThisIdent is the identifier used for 'this' expressions.
 	ThisIdent = "this"
+	// SuperIdent is the identifier used for 'super' expressions.
+	SuperIdent = "super"
 	// InitIdent is the identifier used for the 'init' constructor method for classes.
 	InitIdent = "init"
 )
@@ -36,6 +38,7 @@ type Type uint8
 const (
 	Illegal Type = iota
 	EOF
+	Comment
 
 	// Keywords
 	keywordsStart
@@ -57,11 +60,20 @@ const (
 	Class
 	This
 	Super
+	Throw
+	Try
+	Catch
+	Finally
+	Import
+	As
 	keywordsEnd
 
 	// Literals
 	Ident
 	String
+	StringHead   // Start of an interpolated string up to and including the first ${
+	StringMiddle // Part of an interpolated string between a } and the next ${, inclusive
+	StringTail   // End of an interpolated string from the last } onwards
 	Number
 
 	// Symbols
@@ -87,6 +99,8 @@ const (
 	RightParen
 	LeftBrace
 	RightBrace
+	LeftBracket
+	RightBracket
 
 	typesEnd
 )
@@ -94,6 +108,7 @@ const (
 var typeStrings = map[Type]string{
 	Illegal:      "illegal",
 	EOF:          "EOF",
+	Comment:      "comment",
 	Print:        "print",
 	Var:          "var",
 	True:         "true",
@@ -111,9 +126,18 @@ var typeStrings = map[Type]string{
 	Return:       "return",
 	Class:        "class",
 	This:         ThisIdent,
-	Super:        "super",
+	Super:        SuperIdent,
+	Throw:        "throw",
+	Try:          "try",
+	Catch:        "catch",
+	Finally:      "finally",
+	Import:       "import",
+	As:           "as",
 	Ident:        "identifier",
 	String:       "string",
+	StringHead:   "string head",
+	StringMiddle: "string middle",
+	StringTail:   "string tail",
 	Number:       "number",
 	Semicolon:    ";",
 	Comma:        ",",
@@ -137,6 +161,8 @@ var typeStrings = map[Type]string{
 	RightParen:   ")",
 	LeftBrace:    "{",
 	RightBrace:   "}",
+	LeftBracket:  "[",
+	RightBracket: "]",
 }
 
 var keywordTypesByIdent = func() map[string]Type {
@@ -156,6 +182,20 @@ func IdentType(ident string) Type {
 	return Ident
 }
 
+// IsKeyword reports whether the type is the type of a keyword.
+func (t Type) IsKeyword() bool {
+	return keywordsStart < t && t < keywordsEnd
+}
+
+// Keywords returns the keywords in the order that their types are declared.
+func Keywords() []string {
+	keywords := make([]string, 0, keywordsEnd-keywordsStart-1)
+	for t := keywordsStart + 1; t < keywordsEnd; t++ {
+		keywords = append(keywords, typeStrings[t])
+	}
+	return keywords
+}
+
 // Format implements fmt.Formatter. All verbs have the default behaviour, except for 'm' (message) which formats the
 // type for use in an error message.
 func (t Type) Format(f fmt.State, verb rune) {
@@ -173,6 +213,9 @@ type Token struct {
 	End    Position // Position of the character immediately after the token
 	Type   Type
 	Lexeme string
+	// Literal is the value of a String, StringHead, StringMiddle, or StringTail token. This is the text of the token
+	// with any delimiters removed and escape sequences processed.
+	Literal string
 }
 
 func (t Token) String() string {
@@ -203,9 +246,14 @@ func (p Position) String() string {
 	if p.File != nil && p.File.Name != "" {
 		prefix = p.File.Name + ":"
 	}
+	return fmt.Sprintf("%s%d:%d", prefix, p.Line, p.DisplayColumn())
+}
+
+// DisplayColumn returns the 1-based column number of the position as it's displayed to the user. This takes into
+// account the width of the characters which come before it on the line.
+func (p Position) DisplayColumn() int {
 	line := p.File.Line(p.Line)
-	col := runewidth.StringWidth(string(line[:p.Column])) + 1
-	return fmt.Sprintf("%s%d:%d", prefix, p.Line, col)
+	return runewidth.StringWidth(string(line[:p.Column])) + 1
 }
 
 // File is a simple representation of a file.
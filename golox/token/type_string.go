@@ -10,57 +10,69 @@ func _() {
 	var x [1]struct{}
 	_ = x[Illegal-0]
 	_ = x[EOF-1]
-	_ = x[keywordsStart-2]
-	_ = x[Print-3]
-	_ = x[Var-4]
-	_ = x[True-5]
-	_ = x[False-6]
-	_ = x[Nil-7]
-	_ = x[If-8]
-	_ = x[Else-9]
-	_ = x[And-10]
-	_ = x[Or-11]
-	_ = x[While-12]
-	_ = x[For-13]
-	_ = x[Break-14]
-	_ = x[Continue-15]
-	_ = x[Fun-16]
-	_ = x[Return-17]
-	_ = x[Class-18]
-	_ = x[This-19]
-	_ = x[Super-20]
-	_ = x[keywordsEnd-21]
-	_ = x[Ident-22]
-	_ = x[String-23]
-	_ = x[Number-24]
-	_ = x[Semicolon-25]
-	_ = x[Comma-26]
-	_ = x[Dot-27]
-	_ = x[Equal-28]
-	_ = x[Plus-29]
-	_ = x[Minus-30]
-	_ = x[Asterisk-31]
-	_ = x[Slash-32]
-	_ = x[Percent-33]
-	_ = x[Less-34]
-	_ = x[LessEqual-35]
-	_ = x[Greater-36]
-	_ = x[GreaterEqual-37]
-	_ = x[EqualEqual-38]
-	_ = x[BangEqual-39]
-	_ = x[Bang-40]
-	_ = x[Question-41]
-	_ = x[Colon-42]
-	_ = x[LeftParen-43]
-	_ = x[RightParen-44]
-	_ = x[LeftBrace-45]
-	_ = x[RightBrace-46]
-	_ = x[typesEnd-47]
+	_ = x[Comment-2]
+	_ = x[keywordsStart-3]
+	_ = x[Print-4]
+	_ = x[Var-5]
+	_ = x[True-6]
+	_ = x[False-7]
+	_ = x[Nil-8]
+	_ = x[If-9]
+	_ = x[Else-10]
+	_ = x[And-11]
+	_ = x[Or-12]
+	_ = x[While-13]
+	_ = x[For-14]
+	_ = x[Break-15]
+	_ = x[Continue-16]
+	_ = x[Fun-17]
+	_ = x[Return-18]
+	_ = x[Class-19]
+	_ = x[This-20]
+	_ = x[Super-21]
+	_ = x[Throw-22]
+	_ = x[Try-23]
+	_ = x[Catch-24]
+	_ = x[Finally-25]
+	_ = x[Import-26]
+	_ = x[As-27]
+	_ = x[keywordsEnd-28]
+	_ = x[Ident-29]
+	_ = x[String-30]
+	_ = x[StringHead-31]
+	_ = x[StringMiddle-32]
+	_ = x[StringTail-33]
+	_ = x[Number-34]
+	_ = x[Semicolon-35]
+	_ = x[Comma-36]
+	_ = x[Dot-37]
+	_ = x[Equal-38]
+	_ = x[Plus-39]
+	_ = x[Minus-40]
+	_ = x[Asterisk-41]
+	_ = x[Slash-42]
+	_ = x[Percent-43]
+	_ = x[Less-44]
+	_ = x[LessEqual-45]
+	_ = x[Greater-46]
+	_ = x[GreaterEqual-47]
+	_ = x[EqualEqual-48]
+	_ = x[BangEqual-49]
+	_ = x[Bang-50]
+	_ = x[Question-51]
+	_ = x[Colon-52]
+	_ = x[LeftParen-53]
+	_ = x[RightParen-54]
+	_ = x[LeftBrace-55]
+	_ = x[RightBrace-56]
+	_ = x[LeftBracket-57]
+	_ = x[RightBracket-58]
+	_ = x[typesEnd-59]
 }
 
-const _Type_name = "IllegalEOFkeywordsStartPrintVarTrueFalseNilIfElseAndOrWhileForBreakContinueFunReturnClassThisSuperkeywordsEndIdentStringNumberSemicolonCommaDotEqualPlusMinusAsteriskSlashPercentLessLessEqualGreaterGreaterEqualEqualEqualBangEqualBangQuestionColonLeftParenRightParenLeftBraceRightBracetypesEnd"
+const _Type_name = "IllegalEOFCommentkeywordsStartPrintVarTrueFalseNilIfElseAndOrWhileForBreakContinueFunReturnClassThisSuperThrowTryCatchFinallyImportAskeywordsEndIdentStringStringHeadStringMiddleStringTailNumberSemicolonCommaDotEqualPlusMinusAsteriskSlashPercentLessLessEqualGreaterGreaterEqualEqualEqualBangEqualBangQuestionColonLeftParenRightParenLeftBraceRightBraceLeftBracketRightBrackettypesEnd"
 
-var _Type_index = [...]uint16{0, 7, 10, 23, 28, 31, 35, 40, 43, 45, 49, 52, 54, 59, 62, 67, 75, 78, 84, 89, 93, 98, 109, 114, 120, 126, 135, 140, 143, 148, 152, 157, 165, 170, 177, 181, 190, 197, 209, 219, 228, 232, 240, 245, 254, 264, 273, 283, 291}
+var _Type_index = [...]uint16{0, 7, 10, 17, 30, 35, 38, 42, 47, 50, 52, 56, 59, 61, 66, 69, 74, 82, 85, 91, 96, 100, 105, 110, 113, 118, 125, 131, 133, 144, 149, 155, 165, 177, 187, 193, 202, 207, 210, 215, 219, 224, 232, 237, 244, 248, 257, 264, 276, 286, 295, 299, 307, 312, 321, 331, 340, 350, 361, 373, 381}
 
 func (i Type) String() string {
 	if i >= Type(len(_Type_index)-1) {
@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+)
+
+var builtins = []*loxBuiltinFunction{
+	newLoxBuiltinFunction("clock", nil, func(*VM, ast.CallExpr, []loxObject) loxObject {
+		return loxNumber(time.Now().UnixNano()) / loxNumber(time.Second)
+	}),
+	newLoxBuiltinFunction("type", []string{"object"}, func(_ *VM, _ ast.CallExpr, args []loxObject) loxObject {
+		return loxString(args[0].Type())
+	}),
+	newLoxBuiltinFunction("readLine", nil, func(vm *VM, call ast.CallExpr, _ []loxObject) loxObject {
+		// Output is flushed first so that any prompt which has been printed is displayed before waiting for input.
+		_ = vm.stdout.Flush()
+		line, err := vm.stdin.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			if line == "" {
+				return loxNil{}
+			}
+		} else if err != nil {
+			panic(lox.NewErrorFromNode(call, "%s", err))
+		}
+		return loxString(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+	}),
+	newLoxBuiltinFunction("args", nil, func(vm *VM, _ ast.CallExpr, _ []loxObject) loxObject {
+		elements := make([]loxObject, len(vm.args))
+		for i, arg := range vm.args {
+			elements[i] = loxString(arg)
+		}
+		return newLoxList(elements)
+	}),
+	newLoxBuiltinFunction("exit", []string{"code"}, func(_ *VM, call ast.CallExpr, args []loxObject) loxObject {
+		code, ok := args[0].(loxNumber)
+		if !ok {
+			panic(lox.NewErrorFromNode(call, "exit code must be a %m, got %m", loxTypeNumber, args[0].Type()))
+		}
+		if code < 0 || code > 255 || code != loxNumber(int(code)) {
+			panic(lox.NewErrorFromNode(call, "exit code must be an integer between 0 and 255, got %s", code))
+		}
+		// handleException passes this over catch handlers to the enclosing finally handlers, and then Interpret returns
+		// it once its deferred flush of stdout has run.
+		panic(&lox.ExitError{Code: int(code)})
+	}),
+}
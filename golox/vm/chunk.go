@@ -0,0 +1,136 @@
+package vm
+
+import (
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// opCode is the first byte of an instruction, which determines what it does.
+// Instruction operands follow the opcode and are either one byte (u8) or two bytes in big-endian order (u16).
+type opCode uint8
+
+// The list of all opcodes. The operands of each instruction, if it has any, are listed after it.
+const (
+	opConstant opCode = iota // u16 constant index
+	opNil
+	opTrue
+	opFalse
+	opUndefined // pushes the value of a declared but undefined local
+	opPop
+	opPopExprStmt   // pops the result of an expression statement, printing it in REPL mode
+	opDefineGlobal  // u16 name constant index
+	opDeclareGlobal // u16 name constant index
+	opGetGlobal     // u16 name constant index
+	opSetGlobal     // u16 name constant index
+	opGetLocal      // u16 slot
+	opSetLocal      // u16 slot
+	opGetUpvalue    // u16 upvalue index
+	opSetUpvalue    // u16 upvalue index
+	opCloseUpvalue
+	opNegate
+	opNot
+	opBinary // u8 token.Type of the operator
+	opEqual
+	opNotEqual
+	opPrint
+	opJump        // u16 forward offset
+	opJumpIfFalse // u16 forward offset
+	opJumpIfTrue  // u16 forward offset
+	opLoop        // u16 backward offset
+	opCall        // u8 argument count
+	opClosure     // u16 function constant index, then u8 is local and u16 index for each upvalue
+	opReturn
+	opStoreReturn // pops the return value into the call frame whilst finally blocks are executed
+	opLoadReturn  // pushes the return value stored by opStoreReturn
+	opClass       // u16 name constant index, u8 1 if the superclass is on the stack, otherwise 0
+	opMethod      // u16 name constant index
+	opGetProperty // u16 name constant index
+	opSetProperty // u16 name constant index
+	opGetSuper    // u16 name constant index
+	opList        // u16 element count
+	opMap         // u16 entry count
+	opCheckType   // u8 typeCheck of the object on top of the stack, which is left in place
+	opIndex
+	opSetIndex
+	opSlice       // u8 bit set of sliceHasLow and sliceHasHigh
+	opInterpolate // u16 part count
+	opThrow
+	opPushHandler // u8 handlerKind, u16 forward offset to the handler
+	opPopHandler
+	opRethrow
+	opRethrowExit // pops a pendingException and raises it again if it's exiting the program
+	opImport      // imports the module described by the instruction's ast.ImportDecl
+)
+
+// Flags which are set in the operand of an opSlice instruction.
+const (
+	sliceHasLow = 1 << iota
+	sliceHasHigh
+)
+
+// typeCheck determines which operation an opCheckType instruction checks is valid for the object on top of the stack.
+// The check is made before the operands of the operation are evaluated, so that an error is raised before any of their
+// side effects happen.
+type typeCheck uint8
+
+const (
+	typeCheckIndex       typeCheck = iota // checked before opIndex
+	typeCheckSetIndex                     // checked before opSetIndex
+	typeCheckSlice                        // checked before opSlice
+	typeCheckSetProperty                  // checked before opSetProperty
+)
+
+// handlerKind determines how an exception handler receives the exception that it handles.
+type handlerKind uint8
+
+const (
+	// handlerKindCatch handlers receive the exception as a Lox object, converting runtime errors to Error instances.
+	handlerKindCatch handlerKind = iota
+	// handlerKindFinally handlers receive the exception as a pendingException which can be rethrown as it is.
+	handlerKindFinally
+)
+
+// chunk is a sequence of instructions along with the data that they reference.
+type chunk struct {
+	code      []byte
+	constants []loxObject
+	// nodes holds the AST node that each instruction was compiled from at the offset of its opcode. It's used to report
+	// errors.
+	nodes []ast.Node
+}
+
+// write appends an opcode and its operands to the chunk, recording node as the source of the instruction.
+func (c *chunk) write(node ast.Node, op opCode, operands ...byte) {
+	c.code = append(c.code, byte(op))
+	c.nodes = append(c.nodes, node)
+	c.code = append(c.code, operands...)
+	for range operands {
+		c.nodes = append(c.nodes, nil)
+	}
+}
+
+// addConstant adds a constant to the chunk and returns its index.
+func (c *chunk) addConstant(value loxObject) int {
+	c.constants = append(c.constants, value)
+	return len(c.constants) - 1
+}
+
+func (c *chunk) readU8(offset int) uint8 {
+	return c.code[offset]
+}
+
+func (c *chunk) readU16(offset int) uint16 {
+	return uint16(c.code[offset])<<8 | uint16(c.code[offset+1])
+}
+
+func u16(n int) []byte {
+	return []byte{byte(n >> 8), byte(n)}
+}
+
+// tokenNode adapts a token.Token to the ast.Node interface so that it can be recorded as the source of an instruction.
+type tokenNode struct {
+	tok token.Token
+}
+
+func (t tokenNode) Start() token.Position { return t.tok.Start }
+func (t tokenNode) End() token.Position   { return t.tok.End }
@@ -0,0 +1,808 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// compile compiles a program which has already been resolved into a function which executes its statements.
+// Top-level declarations are compiled to global variables, and all other declarations to local variables which live in
+// stack slots.
+func compile(program ast.Program) (function *loxFunction, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if loxErr, ok := r.(*lox.Error); ok {
+				err = loxErr
+			} else {
+				panic(r)
+			}
+		}
+	}()
+	c := newCompiler(nil, "script", funTypeScript)
+	for _, stmt := range program.Stmts {
+		c.compileStmt(stmt)
+	}
+	c.emitReturn(program)
+	return c.function, nil
+}
+
+type compiler struct {
+	enclosing           *compiler
+	function            *loxFunction
+	locals              []local
+	scopeDepth          int
+	upvalues            []upvalueRef
+	loops               []loop
+	tries               []*tryContext
+	constIndexesByIdent map[string]int
+}
+
+// local is a local variable which lives in a stack slot. Its slot is its index in compiler.locals.
+type local struct {
+	name       string // empty for variables which can't be referred to by name
+	depth      int
+	isCaptured bool
+}
+
+// upvalueRef refers to the variable which an upvalue captures. If isLocal is true, then index is the slot of a local
+// variable in the enclosing function. Otherwise, it's the index of an upvalue in the enclosing function.
+type upvalueRef struct {
+	isLocal bool
+	index   int
+}
+
+// loop is a loop which is being compiled.
+type loop struct {
+	localCount    int // number of locals declared outside of the loop body
+	tryCount      int // number of try statements which the loop is contained in
+	breakJumps    []int
+	continueJumps []int
+}
+
+// tryContext is a try statement which is being compiled.
+type tryContext struct {
+	localCount           int // number of locals declared outside of the try statement
+	finallyBody          ast.Stmt
+	catchHandlerActive   bool
+	finallyHandlerActive bool
+	// pendingExceptionActive is true whilst the finally block is being executed for an exception, which is stored in
+	// the local at localCount.
+	pendingExceptionActive bool
+}
+
+func newCompiler(enclosing *compiler, name string, typ funType) *compiler {
+	c := &compiler{
+		enclosing:           enclosing,
+		function:            &loxFunction{name: name, typ: typ},
+		constIndexesByIdent: map[string]int{},
+	}
+	// Slot 0 holds the receiver of a method call, or the function being called otherwise.
+	slotZeroName := ""
+	if typ == funTypeMethod || typ == funTypeInit {
+		slotZeroName = token.ThisIdent
+	}
+	c.locals = append(c.locals, local{name: slotZeroName})
+	return c
+}
+
+func (c *compiler) chunk() *chunk {
+	return &c.function.chunk
+}
+
+func (c *compiler) emit(node ast.Node, op opCode, operands ...byte) {
+	c.chunk().write(node, op, operands...)
+}
+
+// emitJump emits a jump instruction with a placeholder offset as its last operand and returns the position of the
+// offset so that it can be patched later.
+func (c *compiler) emitJump(node ast.Node, op opCode, operands ...byte) int {
+	c.emit(node, op, append(operands, 0xff, 0xff)...)
+	return len(c.chunk().code) - 2
+}
+
+// patchJump sets the offset of a jump instruction emitted by emitJump so that it jumps to the end of the chunk.
+func (c *compiler) patchJump(node ast.Node, offsetPos int) {
+	offset := len(c.chunk().code) - offsetPos - 2
+	if offset > math.MaxUint16 {
+		panic(lox.NewErrorFromNode(node, "too much code to jump over"))
+	}
+	copy(c.chunk().code[offsetPos:], u16(offset))
+}
+
+// emitLoop emits an instruction which jumps backwards to start.
+func (c *compiler) emitLoop(node ast.Node, start int) {
+	offset := len(c.chunk().code) + 3 - start
+	if offset > math.MaxUint16 {
+		panic(lox.NewErrorFromNode(node, "loop body too large"))
+	}
+	c.emit(node, opLoop, u16(offset)...)
+}
+
+func (c *compiler) makeConstant(node ast.Node, value loxObject) []byte {
+	index := c.chunk().addConstant(value)
+	if index > math.MaxUint16 {
+		panic(lox.NewErrorFromNode(node, "too many constants in one function"))
+	}
+	return u16(index)
+}
+
+// identConstant returns the index of a string constant holding the lexeme of an identifier, adding it to the chunk if
+// it's not already there.
+func (c *compiler) identConstant(tok token.Token) []byte {
+	if index, ok := c.constIndexesByIdent[tok.Lexeme]; ok {
+		return u16(index)
+	}
+	operand := c.makeConstant(tokenNode{tok}, loxString(tok.Lexeme))
+	c.constIndexesByIdent[tok.Lexeme] = len(c.chunk().constants) - 1
+	return operand
+}
+
+func (c *compiler) emitReturn(node ast.Node) {
+	if c.function.typ == funTypeInit {
+		c.emit(node, opGetLocal, u16(0)...)
+	} else {
+		c.emit(node, opNil)
+	}
+	c.emit(node, opReturn)
+}
+
+func (c *compiler) beginScope() {
+	c.scopeDepth++
+}
+
+func (c *compiler) endScope(node ast.Node) {
+	c.scopeDepth--
+	n := len(c.locals)
+	for n > 0 && c.locals[n-1].depth > c.scopeDepth {
+		n--
+	}
+	c.emitPopLocals(node, n, len(c.locals))
+	c.locals = c.locals[:n]
+}
+
+// emitPopLocals emits instructions which pop the locals in the slots [from, to) off the stack, closing any which have
+// been captured by a closure.
+func (c *compiler) emitPopLocals(node ast.Node, from int, to int) {
+	for i := to - 1; i >= from; i-- {
+		if c.locals[i].isCaptured {
+			c.emit(node, opCloseUpvalue)
+		} else {
+			c.emit(node, opPop)
+		}
+	}
+}
+
+// addLocal declares a local variable in the current scope whose value is at the top of the stack.
+func (c *compiler) addLocal(tok token.Token) {
+	name := tok.Lexeme
+	if name == token.BlankIdent {
+		name = ""
+	}
+	c.addHiddenLocal(tokenNode{tok}, name)
+}
+
+// addHiddenLocal declares a local variable which can't be referred to by Lox code if name is empty.
+func (c *compiler) addHiddenLocal(node ast.Node, name string) {
+	if len(c.locals) > math.MaxUint16 {
+		panic(lox.NewErrorFromNode(node, "too many local variables in one function"))
+	}
+	c.locals = append(c.locals, local{name: name, depth: c.scopeDepth})
+}
+
+// resolveLocal returns the slot of the local variable with the given name, or -1 if there isn't one.
+func (c *compiler) resolveLocal(name string) int {
+	for i := len(c.locals) - 1; i >= 0; i-- {
+		if c.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue returns the index of the upvalue which captures the variable with the given name from an enclosing
+// function, or -1 if there isn't one.
+func (c *compiler) resolveUpvalue(node ast.Node, name string) int {
+	if c.enclosing == nil {
+		return -1
+	}
+	if slot := c.enclosing.resolveLocal(name); slot != -1 {
+		c.enclosing.locals[slot].isCaptured = true
+		return c.addUpvalue(node, upvalueRef{isLocal: true, index: slot})
+	}
+	if index := c.enclosing.resolveUpvalue(node, name); index != -1 {
+		return c.addUpvalue(node, upvalueRef{isLocal: false, index: index})
+	}
+	return -1
+}
+
+func (c *compiler) addUpvalue(node ast.Node, ref upvalueRef) int {
+	for i, upvalue := range c.upvalues {
+		if upvalue == ref {
+			return i
+		}
+	}
+	if len(c.upvalues) > math.MaxUint16 {
+		panic(lox.NewErrorFromNode(node, "too many closure variables in one function"))
+	}
+	c.upvalues = append(c.upvalues, ref)
+	c.function.upvalueCount = len(c.upvalues)
+	return len(c.upvalues) - 1
+}
+
+// emitGetVariable emits an instruction which pushes the value of the variable with the given name.
+func (c *compiler) emitGetVariable(tok token.Token) {
+	node := tokenNode{tok}
+	if slot := c.resolveLocal(tok.Lexeme); slot != -1 {
+		c.emit(node, opGetLocal, u16(slot)...)
+	} else if index := c.resolveUpvalue(node, tok.Lexeme); index != -1 {
+		c.emit(node, opGetUpvalue, u16(index)...)
+	} else {
+		c.emit(node, opGetGlobal, c.identConstant(tok)...)
+	}
+}
+
+// emitSetVariable emits an instruction which assigns the value at the top of the stack to the variable with the given
+// name, leaving the value on the stack.
+func (c *compiler) emitSetVariable(tok token.Token) {
+	if tok.Lexeme == token.BlankIdent {
+		return
+	}
+	node := tokenNode{tok}
+	if slot := c.resolveLocal(tok.Lexeme); slot != -1 {
+		c.emit(node, opSetLocal, u16(slot)...)
+	} else if index := c.resolveUpvalue(node, tok.Lexeme); index != -1 {
+		c.emit(node, opSetUpvalue, u16(index)...)
+	} else {
+		c.emit(node, opSetGlobal, c.identConstant(tok)...)
+	}
+}
+
+// defineVariable defines a variable with the value at the top of the stack. At the top level, this is a global
+// variable. Otherwise, it's a local variable in the current scope.
+func (c *compiler) defineVariable(tok token.Token) {
+	if c.scopeDepth == 0 {
+		c.emit(tokenNode{tok}, opDefineGlobal, c.identConstant(tok)...)
+	} else {
+		c.addLocal(tok)
+	}
+}
+
+func (c *compiler) compileStmt(stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case ast.VarDecl:
+		c.compileVarDecl(stmt)
+	case ast.FunDecl:
+		c.compileFunDecl(stmt)
+	case ast.ClassDecl:
+		c.compileClassDecl(stmt)
+	case ast.ImportDecl:
+		c.compileImportDecl(stmt)
+	case ast.ExprStmt:
+		c.compileExprStmt(stmt)
+	case ast.PrintStmt:
+		c.compilePrintStmt(stmt)
+	case ast.BlockStmt:
+		c.compileBlockStmt(stmt)
+	case ast.IfStmt:
+		c.compileIfStmt(stmt)
+	case ast.WhileStmt:
+		c.compileWhileStmt(stmt)
+	case ast.ForStmt:
+		c.compileForStmt(stmt)
+	case ast.BreakStmt:
+		c.compileBreakStmt(stmt)
+	case ast.ContinueStmt:
+		c.compileContinueStmt(stmt)
+	case ast.ReturnStmt:
+		c.compileReturnStmt(stmt)
+	case ast.ThrowStmt:
+		c.compileThrowStmt(stmt)
+	case ast.TryStmt:
+		c.compileTryStmt(stmt)
+	default:
+		panic(fmt.Sprintf("unexpected statement type: %T", stmt))
+	}
+}
+
+func (c *compiler) compileVarDecl(stmt ast.VarDecl) {
+	switch {
+	case stmt.Initialiser != nil:
+		c.compileExpr(stmt.Initialiser)
+		c.defineVariable(stmt.Name)
+	case c.scopeDepth == 0:
+		c.emit(tokenNode{stmt.Name}, opDeclareGlobal, c.identConstant(stmt.Name)...)
+	default:
+		c.emit(stmt, opUndefined)
+		c.addLocal(stmt.Name)
+	}
+}
+
+func (c *compiler) compileFunDecl(stmt ast.FunDecl) {
+	if c.scopeDepth == 0 {
+		c.compileFunction(stmt, stmt.Name.Lexeme, funTypeFunction, stmt.Params, stmt.Body)
+		c.defineVariable(stmt.Name)
+		return
+	}
+	// The local is declared before the function is compiled so that the function can refer to itself.
+	c.addLocal(stmt.Name)
+	c.compileFunction(stmt, stmt.Name.Lexeme, funTypeFunction, stmt.Params, stmt.Body)
+}
+
+// compileFunction compiles a function and emits an instruction which creates a closure from it.
+func (c *compiler) compileFunction(node ast.Node, name string, typ funType, params []token.Token, body []ast.Stmt) {
+	fc := newCompiler(c, name, typ)
+	fc.beginScope()
+	for _, param := range params {
+		fc.function.params = append(fc.function.params, param.Lexeme)
+		fc.addLocal(param)
+	}
+	for _, stmt := range body {
+		fc.compileStmt(stmt)
+	}
+	fc.emitReturn(node)
+
+	operands := c.makeConstant(node, fc.function)
+	for _, upvalue := range fc.upvalues {
+		isLocal := byte(0)
+		if upvalue.isLocal {
+			isLocal = 1
+		}
+		operands = append(operands, isLocal)
+		operands = append(operands, u16(upvalue.index)...)
+	}
+	c.emit(node, opClosure, operands...)
+}
+
+func (c *compiler) compileClassDecl(stmt ast.ClassDecl) {
+	isGlobal := c.scopeDepth == 0
+	slot := len(c.locals)
+	if !isGlobal {
+		// The local is declared before the methods are compiled so that they can refer to the class.
+		c.emit(stmt, opUndefined)
+		c.addLocal(stmt.Name)
+	}
+
+	var classNode ast.Node = stmt
+	hasSuperclass := byte(0)
+	if stmt.Superclass != nil {
+		c.compileExpr(stmt.Superclass)
+		c.beginScope()
+		c.addHiddenLocal(stmt.Superclass, token.SuperIdent)
+		classNode = stmt.Superclass
+		hasSuperclass = 1
+	}
+	c.emit(classNode, opClass, append(c.identConstant(stmt.Name), hasSuperclass)...)
+
+	for _, methodDecl := range stmt.Body {
+		typ := funTypeMethod
+		if methodDecl.Name.Lexeme == token.InitIdent {
+			typ = funTypeInit
+		}
+		name := stmt.Name.Lexeme + "." + methodDecl.Name.Lexeme
+		c.compileFunction(methodDecl, name, typ, methodDecl.Params, methodDecl.Body)
+		c.emit(methodDecl, opMethod, c.identConstant(methodDecl.Name)...)
+	}
+
+	if isGlobal {
+		c.emit(tokenNode{stmt.Name}, opDefineGlobal, c.identConstant(stmt.Name)...)
+	} else {
+		c.emit(stmt, opSetLocal, u16(slot)...)
+		c.emit(stmt, opPop)
+	}
+	if stmt.Superclass != nil {
+		c.endScope(stmt)
+	}
+}
+
+func (c *compiler) compileImportDecl(stmt ast.ImportDecl) {
+	c.emit(stmt, opImport)
+	c.defineVariable(stmt.Alias)
+}
+
+func (c *compiler) compileExprStmt(stmt ast.ExprStmt) {
+	c.compileExpr(stmt.Expr)
+	c.emit(stmt, opPopExprStmt)
+}
+
+func (c *compiler) compilePrintStmt(stmt ast.PrintStmt) {
+	c.compileExpr(stmt.Expr)
+	c.emit(stmt, opPrint)
+}
+
+func (c *compiler) compileBlockStmt(stmt ast.BlockStmt) {
+	c.beginScope()
+	for _, stmt := range stmt.Stmts {
+		c.compileStmt(stmt)
+	}
+	c.endScope(stmt)
+}
+
+func (c *compiler) compileIfStmt(stmt ast.IfStmt) {
+	c.compileExpr(stmt.Condition)
+	elseJump := c.emitJump(stmt, opJumpIfFalse)
+	c.emit(stmt, opPop)
+	c.compileStmt(stmt.Then)
+	endJump := c.emitJump(stmt, opJump)
+	c.patchJump(stmt, elseJump)
+	c.emit(stmt, opPop)
+	if stmt.Else != nil {
+		c.compileStmt(stmt.Else)
+	}
+	c.patchJump(stmt, endJump)
+}
+
+func (c *compiler) compileWhileStmt(stmt ast.WhileStmt) {
+	start := len(c.chunk().code)
+	c.compileExpr(stmt.Condition)
+	exitJump := c.emitJump(stmt, opJumpIfFalse)
+	c.emit(stmt, opPop)
+	c.beginLoop()
+	c.compileStmt(stmt.Body)
+	loop := c.endLoop()
+	c.patchJumps(stmt, loop.continueJumps)
+	c.emitLoop(stmt, start)
+	c.patchJump(stmt, exitJump)
+	c.emit(stmt, opPop)
+	c.patchJumps(stmt, loop.breakJumps)
+}
+
+func (c *compiler) compileForStmt(stmt ast.ForStmt) {
+	c.beginScope()
+	if stmt.Initialise != nil {
+		c.compileStmt(stmt.Initialise)
+	}
+	start := len(c.chunk().code)
+	exitJump := -1
+	if stmt.Condition != nil {
+		c.compileExpr(stmt.Condition)
+		exitJump = c.emitJump(stmt, opJumpIfFalse)
+		c.emit(stmt, opPop)
+	}
+	c.beginLoop()
+	c.compileStmt(stmt.Body)
+	loop := c.endLoop()
+	c.patchJumps(stmt, loop.continueJumps)
+	if stmt.Update != nil {
+		c.compileExpr(stmt.Update)
+		c.emit(stmt, opPop)
+	}
+	c.emitLoop(stmt, start)
+	if exitJump != -1 {
+		c.patchJump(stmt, exitJump)
+		c.emit(stmt, opPop)
+	}
+	c.patchJumps(stmt, loop.breakJumps)
+	c.endScope(stmt)
+}
+
+func (c *compiler) beginLoop() {
+	c.loops = append(c.loops, loop{localCount: len(c.locals), tryCount: len(c.tries)})
+}
+
+func (c *compiler) endLoop() loop {
+	loop := c.loops[len(c.loops)-1]
+	c.loops = c.loops[:len(c.loops)-1]
+	return loop
+}
+
+func (c *compiler) patchJumps(node ast.Node, offsetPositions []int) {
+	for _, offsetPos := range offsetPositions {
+		c.patchJump(node, offsetPos)
+	}
+}
+
+func (c *compiler) compileBreakStmt(stmt ast.BreakStmt) {
+	loop := &c.loops[len(c.loops)-1]
+	c.emitPopLocals(stmt, loop.localCount, c.exitTries(stmt, loop.tryCount))
+	loop.breakJumps = append(loop.breakJumps, c.emitJump(stmt, opJump))
+}
+
+func (c *compiler) compileContinueStmt(stmt ast.ContinueStmt) {
+	loop := &c.loops[len(c.loops)-1]
+	c.emitPopLocals(stmt, loop.localCount, c.exitTries(stmt, loop.tryCount))
+	loop.continueJumps = append(loop.continueJumps, c.emitJump(stmt, opJump))
+}
+
+func (c *compiler) compileReturnStmt(stmt ast.ReturnStmt) {
+	switch {
+	case c.function.typ == funTypeInit:
+		c.emit(stmt, opGetLocal, u16(0)...)
+	case stmt.Value != nil:
+		c.compileExpr(stmt.Value)
+	default:
+		c.emit(stmt, opNil)
+	}
+	if len(c.tries) > 0 {
+		// The return value is stored outside of the stack whilst any finally blocks are executed.
+		c.emit(stmt, opStoreReturn)
+		c.exitTries(stmt, 0)
+		c.emit(stmt, opLoadReturn)
+	}
+	c.emit(stmt, opReturn)
+}
+
+// exitTries emits the instructions which are executed when a break, continue, or return statement jumps out of the try
+// statements which are nested deeper than tryCount. For each statement, innermost first, the locals declared inside it
+// are popped, its exception handlers are popped, and then its finally block is executed. The number of locals which
+// are left on the stack is returned.
+func (c *compiler) exitTries(node ast.Node, tryCount int) int {
+	localCount := len(c.locals)
+	for i := len(c.tries) - 1; i >= tryCount; i-- {
+		try := c.tries[i]
+		if try.pendingExceptionActive {
+			// A break, continue, or return in a finally block discards the exception which it's being executed for,
+			// unless the program is exiting, which can't be stopped.
+			c.emit(node, opGetLocal, u16(try.localCount)...)
+			c.emit(node, opRethrowExit)
+		}
+		c.emitPopLocals(node, try.localCount, localCount)
+		localCount = try.localCount
+		if try.catchHandlerActive {
+			c.emit(node, opPopHandler)
+		}
+		if try.finallyHandlerActive {
+			c.emit(node, opPopHandler)
+			// The finally block is compiled as if it's being executed after the try statement, so the locals and try
+			// statements nested inside it are hidden. Capping the capacity of the slices means that they're copied
+			// rather than overwritten if they're appended to.
+			locals, tries := c.locals, c.tries
+			c.locals, c.tries = locals[:localCount:localCount], tries[:i:i]
+			c.compileStmt(try.finallyBody)
+			c.locals, c.tries = locals, tries
+		}
+	}
+	return localCount
+}
+
+func (c *compiler) compileThrowStmt(stmt ast.ThrowStmt) {
+	c.compileExpr(stmt.Value)
+	c.emit(stmt.Value, opThrow)
+}
+
+// compileTryStmt compiles a try statement. Exceptions raised in the try block are handled by a catch handler which jumps
+// to the catch block, and exceptions raised in the try or catch blocks are handled by a finally handler which executes
+// the finally block and then raises the exception again.
+func (c *compiler) compileTryStmt(stmt ast.TryStmt) {
+	try := &tryContext{localCount: len(c.locals), finallyBody: stmt.FinallyBody}
+	var finallyHandler, catchHandler int
+	if stmt.FinallyBody != nil {
+		finallyHandler = c.emitJump(stmt, opPushHandler, byte(handlerKindFinally))
+		try.finallyHandlerActive = true
+	}
+	if stmt.CatchBody != nil {
+		catchHandler = c.emitJump(stmt, opPushHandler, byte(handlerKindCatch))
+		try.catchHandlerActive = true
+	}
+	c.tries = append(c.tries, try)
+
+	c.compileStmt(stmt.Body)
+
+	if stmt.CatchBody != nil {
+		c.emit(stmt, opPopHandler)
+		try.catchHandlerActive = false
+		endJump := c.emitJump(stmt, opJump)
+		c.patchJump(stmt, catchHandler)
+		c.beginScope()
+		c.addLocal(stmt.CatchIdent)
+		c.compileStmt(stmt.CatchBody)
+		c.endScope(stmt)
+		c.patchJump(stmt, endJump)
+	}
+
+	if stmt.FinallyBody != nil {
+		c.emit(stmt, opPopHandler)
+		try.finallyHandlerActive = false
+		c.compileStmt(stmt.FinallyBody)
+		endJump := c.emitJump(stmt, opJump)
+		c.patchJump(stmt, finallyHandler)
+		// The pending exception is pushed by the VM before jumping to the handler.
+		c.addHiddenLocal(stmt, "")
+		try.pendingExceptionActive = true
+		c.compileStmt(stmt.FinallyBody)
+		try.pendingExceptionActive = false
+		c.emit(stmt, opRethrow)
+		c.locals = c.locals[:len(c.locals)-1]
+		c.patchJump(stmt, endJump)
+	}
+
+	c.tries = c.tries[:len(c.tries)-1]
+}
+
+func (c *compiler) compileExpr(expr ast.Expr) {
+	switch expr := expr.(type) {
+	case ast.FunExpr:
+		c.compileFunction(expr, "(anonymous)", funTypeFunction, expr.Params, expr.Body)
+	case ast.GroupExpr:
+		c.compileExpr(expr.Expr)
+	case ast.LiteralExpr:
+		c.compileLiteralExpr(expr)
+	case ast.InterpolationExpr:
+		c.compileInterpolationExpr(expr)
+	case ast.ListExpr:
+		c.compileListExpr(expr)
+	case ast.MapExpr:
+		c.compileMapExpr(expr)
+	case ast.VariableExpr:
+		c.emitGetVariable(expr.Name)
+	case ast.ThisExpr:
+		c.emitGetVariable(expr.This)
+	case ast.SuperExpr:
+		c.compileSuperExpr(expr)
+	case ast.CallExpr:
+		c.compileCallExpr(expr)
+	case ast.GetExpr:
+		c.compileExpr(expr.Object)
+		c.emit(expr, opGetProperty, c.identConstant(expr.Name)...)
+	case ast.IndexExpr:
+		c.compileExpr(expr.Object)
+		c.emit(expr, opCheckType, byte(typeCheckIndex))
+		c.compileExpr(expr.Index)
+		c.emit(expr, opIndex)
+	case ast.SliceExpr:
+		c.compileSliceExpr(expr)
+	case ast.UnaryExpr:
+		c.compileUnaryExpr(expr)
+	case ast.BinaryExpr:
+		c.compileBinaryExpr(expr)
+	case ast.TernaryExpr:
+		c.compileTernaryExpr(expr)
+	case ast.AssignmentExpr:
+		c.compileExpr(expr.Right)
+		c.emitSetVariable(expr.Left)
+	case ast.SetExpr:
+		c.compileExpr(expr.Object)
+		c.emit(expr, opCheckType, byte(typeCheckSetProperty))
+		c.compileExpr(expr.Value)
+		c.emit(expr, opSetProperty, c.identConstant(expr.Name)...)
+	case ast.IndexSetExpr:
+		c.compileExpr(expr.Object)
+		c.emit(expr, opCheckType, byte(typeCheckSetIndex))
+		c.compileExpr(expr.Index)
+		c.compileExpr(expr.Value)
+		c.emit(expr, opSetIndex)
+	default:
+		panic(fmt.Sprintf("unexpected expression type: %T", expr))
+	}
+}
+
+func (c *compiler) compileLiteralExpr(expr ast.LiteralExpr) {
+	switch tok := expr.Value; tok.Type {
+	case token.Number:
+		value, err := strconv.ParseFloat(tok.Lexeme, 64)
+		if err != nil {
+			panic(fmt.Sprintf("unexpected error parsing number literal: %s", err))
+		}
+		c.emit(expr, opConstant, c.makeConstant(expr, loxNumber(value))...)
+	case token.String, token.StringHead, token.StringMiddle, token.StringTail:
+		c.emit(expr, opConstant, c.makeConstant(expr, loxString(tok.Literal))...)
+	case token.True:
+		c.emit(expr, opTrue)
+	case token.False:
+		c.emit(expr, opFalse)
+	case token.Nil:
+		c.emit(expr, opNil)
+	default:
+		panic(fmt.Sprintf("unexpected literal type: %s", tok.Type))
+	}
+}
+
+func (c *compiler) compileInterpolationExpr(expr ast.InterpolationExpr) {
+	for _, part := range expr.Parts {
+		c.compileExpr(part)
+	}
+	c.emit(expr, opInterpolate, c.count(expr, len(expr.Parts), "string parts")...)
+}
+
+func (c *compiler) compileListExpr(expr ast.ListExpr) {
+	for _, element := range expr.Elements {
+		c.compileExpr(element)
+	}
+	c.emit(expr, opList, c.count(expr, len(expr.Elements), "list elements")...)
+}
+
+func (c *compiler) compileMapExpr(expr ast.MapExpr) {
+	for _, entry := range expr.Entries {
+		c.compileExpr(entry.Key)
+		c.compileExpr(entry.Value)
+	}
+	c.emit(expr, opMap, c.count(expr, len(expr.Entries), "map entries")...)
+}
+
+// count returns the u16 operand for the number of items in an expression, raising an error if there are too many.
+func (c *compiler) count(node ast.Node, n int, items string) []byte {
+	if n > math.MaxUint16 {
+		panic(lox.NewErrorFromNode(node, "too many %s in one expression", items))
+	}
+	return u16(n)
+}
+
+func (c *compiler) compileSuperExpr(expr ast.SuperExpr) {
+	c.emitGetVariable(token.Token{Type: token.This, Lexeme: token.ThisIdent, Start: expr.Super.Start, End: expr.Super.End})
+	c.emitGetVariable(expr.Super)
+	c.emit(expr, opGetSuper, c.identConstant(expr.Method)...)
+}
+
+func (c *compiler) compileCallExpr(expr ast.CallExpr) {
+	c.compileExpr(expr.Callee)
+	for _, arg := range expr.Args {
+		c.compileExpr(arg)
+	}
+	if len(expr.Args) > math.MaxUint8 {
+		panic(lox.NewErrorFromNode(expr, "too many arguments in one call"))
+	}
+	c.emit(expr, opCall, byte(len(expr.Args)))
+}
+
+func (c *compiler) compileSliceExpr(expr ast.SliceExpr) {
+	c.compileExpr(expr.Object)
+	c.emit(expr, opCheckType, byte(typeCheckSlice))
+	var flags byte
+	if expr.Low != nil {
+		c.compileExpr(expr.Low)
+		flags |= sliceHasLow
+	}
+	if expr.High != nil {
+		c.compileExpr(expr.High)
+		flags |= sliceHasHigh
+	}
+	c.emit(expr, opSlice, flags)
+}
+
+func (c *compiler) compileUnaryExpr(expr ast.UnaryExpr) {
+	c.compileExpr(expr.Right)
+	switch expr.Op.Type {
+	case token.Bang:
+		c.emit(expr, opNot)
+	case token.Minus:
+		c.emit(tokenNode{expr.Op}, opNegate)
+	default:
+		panic(fmt.Sprintf("unexpected unary operator: %s", expr.Op.Type))
+	}
+}
+
+func (c *compiler) compileBinaryExpr(expr ast.BinaryExpr) {
+	c.compileExpr(expr.Left)
+	switch expr.Op.Type {
+	case token.Or, token.And:
+		jumpOp := opJumpIfTrue
+		if expr.Op.Type == token.And {
+			jumpOp = opJumpIfFalse
+		}
+		endJump := c.emitJump(expr, jumpOp)
+		c.emit(expr, opPop)
+		c.compileExpr(expr.Right)
+		c.patchJump(expr, endJump)
+		return
+	case token.Comma:
+		c.emit(expr, opPop)
+		c.compileExpr(expr.Right)
+		return
+	}
+
+	c.compileExpr(expr.Right)
+	switch expr.Op.Type {
+	case token.EqualEqual:
+		c.emit(expr, opEqual)
+	case token.BangEqual:
+		c.emit(expr, opNotEqual)
+	default:
+		c.emit(tokenNode{expr.Op}, opBinary, byte(expr.Op.Type))
+	}
+}
+
+func (c *compiler) compileTernaryExpr(expr ast.TernaryExpr) {
+	c.compileExpr(expr.Condition)
+	elseJump := c.emitJump(expr, opJumpIfFalse)
+	c.emit(expr, opPop)
+	c.compileExpr(expr.Then)
+	endJump := c.emitJump(expr, opJump)
+	c.patchJump(expr, elseJump)
+	c.emit(expr, opPop)
+	c.compileExpr(expr.Else)
+	c.patchJump(expr, endJump)
+}
@@ -0,0 +1,65 @@
+package vm
+
+import "slices"
+
+// GlobalIdents returns the identifiers of the global declarations, including the built-in ones, in sorted order.
+func (vm *VM) GlobalIdents() []string {
+	return sortedKeys(vm.globals.valuesByIdent)
+}
+
+// PropertyNames returns the sorted names which can follow a dot after the value that path leads to: the fields and
+// methods of an instance or the exported declarations of a module. path starts with the identifier of a global and is
+// followed by the names of the properties to access, so the path [a b] leads to a.b. nil is returned if the path
+// doesn't lead to an instance or module.
+func (vm *VM) PropertyNames(path []string) []string {
+	switch object := vm.lookupPath(path).(type) {
+	case *loxInstance:
+		names := make(map[string]bool, len(object.fieldValuesByName))
+		for name := range object.fieldValuesByName {
+			names[name] = true
+		}
+		for class := object.class; class != nil; class = class.superclass {
+			for name := range class.methodsByName {
+				names[name] = true
+			}
+		}
+		return sortedKeys(names)
+	case *loxModule:
+		return sortedKeys(object.exportedIdents)
+	default:
+		return nil
+	}
+}
+
+// lookupPath returns the value which path leads to, or nil if there isn't one. Properties are read straight from the
+// fields of instances and globals of modules rather than with opGetProperty, so that completing a name never runs any
+// Lox code.
+func (vm *VM) lookupPath(path []string) loxObject {
+	if len(path) == 0 {
+		return nil
+	}
+	value := vm.globals.valuesByIdent[path[0]]
+	for _, name := range path[1:] {
+		switch object := value.(type) {
+		case *loxInstance:
+			value = object.fieldValuesByName[name]
+		case *loxModule:
+			if !object.exportedIdents[name] {
+				return nil
+			}
+			value = object.globals.valuesByIdent[name]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// globals holds the global declarations of a module. Unlike local variables, which are resolved to stack slots at
+// compile time, globals are looked up by name at runtime.
+type globals struct {
+	valuesByIdent map[string]loxObject
+}
+
+func newGlobals() *globals {
+	return &globals{valuesByIdent: make(map[string]loxObject)}
+}
+
+func (g *globals) String() string {
+	if len(g.valuesByIdent) == 0 {
+		return "<empty>"
+	}
+	idents := make([]string, 0, len(g.valuesByIdent))
+	for ident := range g.valuesByIdent {
+		idents = append(idents, ident)
+	}
+	slices.Sort(idents)
+	var b strings.Builder
+	for i, ident := range idents {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s: %s", ident, g.valuesByIdent[ident])
+	}
+	return b.String()
+}
+
+// Declare declares an identifier without defining it.
+// If the identifier has already been declared, then an error is raised.
+// If the identifier is [token.BlankIdent], then this method is a no-op.
+func (g *globals) Declare(node ast.Node, ident string) {
+	g.Define(node, ident, loxUndefined{})
+}
+
+// Define declares an identifier and defines it with a value.
+// If the identifier has already been declared, then an error is raised.
+// If the identifier is [token.BlankIdent], then this method is a no-op.
+func (g *globals) Define(node ast.Node, ident string, value loxObject) {
+	if ident == token.BlankIdent {
+		return
+	}
+	if _, ok := g.valuesByIdent[ident]; ok {
+		panic(lox.NewErrorFromNode(node, "%s has already been declared", ident))
+	}
+	g.valuesByIdent[ident] = value
+}
+
+// Set declares an identifier and defines it with a value.
+// If the identifier has already been declared, then this method panics.
+// This method should be used for defining values which did not originate from code, such as built-in functions.
+// Otherwise, use [*globals.Define].
+func (g *globals) Set(ident string, value loxObject) {
+	if _, ok := g.valuesByIdent[ident]; ok {
+		// It's a bug if we end up here
+		panic(fmt.Sprintf("%s has already been declared", ident))
+	}
+	g.valuesByIdent[ident] = value
+}
+
+// Assign assigns a value to an identifier.
+// If the identifier has not been declared, then an error is raised.
+// If the identifier is [token.BlankIdent], then this method is a no-op.
+func (g *globals) Assign(node ast.Node, ident string, value loxObject) {
+	if ident == token.BlankIdent {
+		return
+	}
+	if _, ok := g.valuesByIdent[ident]; !ok {
+		panic(lox.NewErrorFromNode(node, "%s has not been declared", ident))
+	}
+	g.valuesByIdent[ident] = value
+}
+
+// Get returns the value of an identifier.
+// If the identifier has not been declared or defined, then an error is raised.
+func (g *globals) Get(node ast.Node, ident string) loxObject {
+	value, ok := g.valuesByIdent[ident]
+	if !ok {
+		panic(lox.NewErrorFromNode(node, "%s has not been declared", ident))
+	}
+	if value == (loxUndefined{}) {
+		panic(lox.NewErrorFromNode(node, "%s has not been defined", ident))
+	}
+	return value
+}
+
+// GetByIdent returns the value of an identifier which must have been defined.
+// This method should be used for accesses which did not originate from code. Otherwise, use [*globals.Get].
+func (g *globals) GetByIdent(ident string) loxObject {
+	value, ok := g.valuesByIdent[ident]
+	if !ok || value == (loxUndefined{}) {
+		// It's a bug if we end up here
+		panic(fmt.Sprintf("%s has not been defined", ident))
+	}
+	return value
+}
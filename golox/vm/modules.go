@@ -0,0 +1,91 @@
+package vm
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/parser"
+)
+
+// moduleError is used as a panic value to unwind the stack when an imported module could not be parsed or resolved.
+// The errors are reported as they are, rather than as a runtime error, since they describe problems with the source
+// code of the module.
+type moduleError struct {
+	err error
+}
+
+// importingModule is a module which is in the process of being imported.
+type importingModule struct {
+	path string // absolute path of the module
+	name string // path of the module as it should be displayed to the user
+}
+
+// importModule returns the module imported by an import declaration. The module is executed the first time that it's
+// imported and cached for subsequent imports. Module paths are relative to the directory of the importing file.
+func (vm *VM) importModule(stmt ast.ImportDecl) *loxModule {
+	importer := stmt.Path.Start.File.Name
+	name := stmt.Path.Literal
+	if !filepath.IsAbs(name) && importer != "" {
+		name = filepath.Join(filepath.Dir(importer), name)
+	}
+	path, err := filepath.Abs(name)
+	if err != nil {
+		panic(lox.NewErrorFromToken(stmt.Path, "cannot import %s: %s", name, err))
+	}
+
+	if module, ok := vm.modulesByPath[path]; ok {
+		return module
+	}
+
+	if len(vm.importStack) == 0 && importer != "" {
+		// The file containing the first import is at the bottom of the import stack so that cycles back to it can be
+		// detected.
+		if importerPath, err := filepath.Abs(importer); err == nil {
+			vm.importStack = append(vm.importStack, importingModule{path: importerPath, name: importer})
+			defer func() { vm.importStack = vm.importStack[:0] }()
+		}
+	}
+	if start := slices.IndexFunc(vm.importStack, func(m importingModule) bool { return m.path == path }); start != -1 {
+		var cycle []string
+		for _, m := range vm.importStack[start:] {
+			cycle = append(cycle, m.name)
+		}
+		cycle = append(cycle, name)
+		panic(lox.NewErrorFromToken(stmt.Path, "import cycle: %s", strings.Join(cycle, " -> ")))
+	}
+	vm.importStack = append(vm.importStack, importingModule{path: path, name: name})
+	defer func() { vm.importStack = vm.importStack[:len(vm.importStack)-1] }()
+
+	f, err := os.Open(name)
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		panic(lox.NewErrorFromToken(stmt.Path, "cannot import %s: %s", name, err))
+	}
+	defer f.Close()
+	program, err := parser.Parse(f)
+	if err != nil {
+		panic(moduleError{err: err})
+	}
+
+	// Expression statement results are only printed for the program being interpreted, not the modules it imports.
+	printExprStmtResults := vm.printExprStmtResults
+	vm.printExprStmtResults = false
+	defer func() { vm.printExprStmtResults = printExprStmtResults }()
+
+	globals := vm.newGlobals()
+	if err := vm.interpretProgram(globals, program); err != nil {
+		panic(moduleError{err: err})
+	}
+	module := newLoxModule(stmt.Path.Literal, globals, vm.builtins)
+	vm.modulesByPath[path] = module
+	return module
+}
@@ -0,0 +1,690 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// loxType is the string representation of a Lox object's type.
+type loxType string
+
+const (
+	loxTypeNumber   loxType = "number"
+	loxTypeString   loxType = "string"
+	loxTypeBool     loxType = "bool"
+	loxTypeNil      loxType = "nil"
+	loxTypeFunction loxType = "function"
+	loxTypeClass    loxType = "class"
+	loxTypeList     loxType = "list"
+	loxTypeMap      loxType = "map"
+	loxTypeModule   loxType = "module"
+)
+
+// Format implements fmt.Formatter. All verbs have the default behaviour, except for 'm' (message) which formats the
+// type for use in an error message.
+func (t loxType) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 'm':
+		fmt.Fprintf(f, "'%s'", t)
+	default:
+		fmt.Fprintf(f, fmt.FormatString(f, verb), string(t))
+	}
+}
+
+type loxObject interface {
+	String() string
+	Type() loxType
+}
+
+type loxPropertyAccessor interface {
+	// Get returns the value of the property with the given name. If the property doesn't exist, then an error is
+	// raised at node.
+	Get(node ast.Node, name string) loxObject
+}
+
+type loxCallable interface {
+	Name() string
+	Params() []string
+}
+
+func isTruthy(obj loxObject) bool {
+	switch obj := obj.(type) {
+	case loxBool:
+		return bool(obj)
+	case loxNil:
+		return false
+	case loxNumber:
+		return obj != 0
+	case loxString:
+		return obj != ""
+	case *loxList:
+		return len(obj.elements) > 0
+	case *loxMap:
+		return len(obj.entries) > 0
+	default:
+		return true
+	}
+}
+
+type loxNumber float64
+
+func (n loxNumber) String() string {
+	return strconv.FormatFloat(float64(n), 'f', -1, 64)
+}
+
+func (n loxNumber) Type() loxType {
+	return loxTypeNumber
+}
+
+type loxString string
+
+func (s loxString) String() string {
+	return string(s)
+}
+
+func (s loxString) Type() loxType {
+	return loxTypeString
+}
+
+type loxBool bool
+
+func (b loxBool) String() string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+func (b loxBool) Type() loxType {
+	return loxTypeBool
+}
+
+type loxNil struct{}
+
+func (n loxNil) String() string {
+	return "nil"
+}
+
+func (n loxNil) Type() loxType {
+	return loxTypeNil
+}
+
+// loxUndefined is the value of a variable which has been declared but not defined. It's never visible to Lox code.
+type loxUndefined struct{}
+
+func (loxUndefined) String() string {
+	return "<undefined>"
+}
+
+func (loxUndefined) Type() loxType {
+	return "undefined"
+}
+
+// binaryOp returns the result of applying a binary operator, other than ==, !=, and the short-circuiting operators,
+// to two objects. node is the operator token and is used to report errors.
+func binaryOp(op token.Type, node ast.Node, left loxObject, right loxObject) loxObject {
+	switch left := left.(type) {
+	case loxNumber:
+		switch right := right.(type) {
+		case loxNumber:
+			switch op {
+			case token.Asterisk:
+				return left * right
+			case token.Slash:
+				if right == 0 {
+					panic(lox.NewErrorFromNode(node, "cannot divide by 0"))
+				}
+				return left / right
+			case token.Percent:
+				if right == 0 {
+					panic(lox.NewErrorFromNode(node, "cannot modulo by 0"))
+				}
+				return loxNumber(math.Mod(float64(left), float64(right)))
+			case token.Plus:
+				return left + right
+			case token.Minus:
+				return left - right
+			case token.Less:
+				return loxBool(left < right)
+			case token.LessEqual:
+				return loxBool(left <= right)
+			case token.Greater:
+				return loxBool(left > right)
+			case token.GreaterEqual:
+				return loxBool(left >= right)
+			}
+		case loxString:
+			if op == token.Asterisk {
+				return numberTimesString(left, node, right)
+			}
+		}
+	case loxString:
+		switch right := right.(type) {
+		case loxString:
+			switch op {
+			case token.Plus:
+				return left + right
+			case token.Less:
+				return loxBool(left < right)
+			case token.LessEqual:
+				return loxBool(left <= right)
+			case token.Greater:
+				return loxBool(left > right)
+			case token.GreaterEqual:
+				return loxBool(left >= right)
+			}
+		case loxNumber:
+			if op == token.Asterisk {
+				return numberTimesString(right, node, left)
+			}
+		}
+	case *loxList:
+		if right, ok := right.(*loxList); ok && op == token.Plus {
+			elements := make([]loxObject, 0, len(left.elements)+len(right.elements))
+			elements = append(elements, left.elements...)
+			elements = append(elements, right.elements...)
+			return newLoxList(elements)
+		}
+	}
+	panic(lox.NewErrorFromNode(node, "%m operator cannot be used with types %m and %m", op, left.Type(), right.Type()))
+}
+
+func numberTimesString(n loxNumber, node ast.Node, s loxString) loxString {
+	if math.Floor(float64(n)) != float64(n) {
+		panic(lox.NewErrorFromNode(node, "cannot multiply %m by non-integer %m", loxTypeString, loxTypeNumber))
+	}
+	if n < 0 {
+		panic(lox.NewErrorFromNode(node, "cannot multiply %m by negative %m", loxTypeString, loxTypeNumber))
+	}
+	if len(s) == 0 {
+		return ""
+	}
+	// The length is calculated as a float so that it can't overflow.
+	if float64(len(s))*float64(n) >= math.MaxInt {
+		panic(lox.NewErrorFromNode(node, "cannot multiply %m by %s: result is too long", loxTypeString, n))
+	}
+	return loxString(strings.Repeat(string(s), int(n)))
+}
+
+type loxList struct {
+	elements []loxObject
+}
+
+func newLoxList(elements []loxObject) *loxList {
+	return &loxList{elements: elements}
+}
+
+func (l *loxList) String() string {
+	return l.string(nil)
+}
+
+// string formats the list. enclosing are the containers which the list is being formatted as an element of. If the
+// list is one of them, then it contains itself and is formatted as [...] instead.
+func (l *loxList) string(enclosing []loxObject) string {
+	if slices.Contains(enclosing, loxObject(l)) {
+		return "[...]"
+	}
+	enclosing = append(enclosing, l)
+	var b strings.Builder
+	b.WriteString("[")
+	for i, element := range l.elements {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(containedElementString(element, enclosing))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// elementString formats an object for display as an element of a container, such as a list or map.
+// Strings are quoted so that they can be distinguished from other types.
+func elementString(obj loxObject) string {
+	return containedElementString(obj, nil)
+}
+
+// containedElementString is like elementString but enclosing are the containers which obj is being formatted as an
+// element of.
+func containedElementString(obj loxObject, enclosing []loxObject) string {
+	switch obj := obj.(type) {
+	case loxString:
+		return strconv.Quote(string(obj))
+	case *loxList:
+		return obj.string(enclosing)
+	case *loxMap:
+		return obj.string(enclosing)
+	default:
+		return obj.String()
+	}
+}
+
+func (l *loxList) Type() loxType {
+	return loxTypeList
+}
+
+// elementIndex returns the index into l.elements that the given index object refers to. Negative indexes count
+// backwards from the end of the list.
+func (l *loxList) elementIndex(indexExpr ast.Expr, index loxObject) int {
+	n := listIndexInt(indexExpr, index, "list index")
+	if n < 0 {
+		n += len(l.elements)
+	}
+	if n < 0 || n >= len(l.elements) {
+		panic(lox.NewErrorFromNode(indexExpr, "list index %s out of range for list of length %d", index, len(l.elements)))
+	}
+	return n
+}
+
+func (l *loxList) slice(expr ast.SliceExpr, low loxObject, high loxObject) *loxList {
+	lowIndex := 0
+	if low != nil {
+		lowIndex = l.sliceIndex(expr.Low, low)
+	}
+	highIndex := len(l.elements)
+	if high != nil {
+		highIndex = l.sliceIndex(expr.High, high)
+	}
+	if lowIndex >= highIndex {
+		return newLoxList(nil)
+	}
+	return newLoxList(slices.Clone(l.elements[lowIndex:highIndex]))
+}
+
+// sliceIndex returns the index into l.elements that the given slice index object refers to. Negative indexes count
+// backwards from the end of the list and indexes which are out of range are clamped to the bounds of the list.
+func (l *loxList) sliceIndex(indexExpr ast.Expr, index loxObject) int {
+	n := listIndexInt(indexExpr, index, "list slice index")
+	if n < 0 {
+		n += len(l.elements)
+	}
+	return max(0, min(n, len(l.elements)))
+}
+
+// listIndexInt converts an index object to an int, raising an error if it's not an integer. name is used to describe
+// the index in error messages.
+func listIndexInt(indexExpr ast.Expr, index loxObject, name string) int {
+	n, ok := index.(loxNumber)
+	if !ok {
+		panic(lox.NewErrorFromNode(indexExpr, "%s must be a %m, got %m", name, loxTypeNumber, index.Type()))
+	}
+	if math.Floor(float64(n)) != float64(n) {
+		panic(lox.NewErrorFromNode(indexExpr, "%s must be an integer, got %s", name, n))
+	}
+	return int(n)
+}
+
+type loxMap struct {
+	entries      []loxMapEntry
+	indexesByKey map[any]int
+}
+
+type loxMapEntry struct {
+	Key   loxObject
+	Value loxObject
+}
+
+func newLoxMap() *loxMap {
+	return &loxMap{indexesByKey: map[any]int{}}
+}
+
+// String formats the map with its entries in the order that their keys were first inserted.
+func (m *loxMap) String() string {
+	return m.string(nil)
+}
+
+// string formats the map. enclosing are the containers which the map is being formatted as an element of. If the map
+// is one of them, then it contains itself and is formatted as {...} instead.
+func (m *loxMap) string(enclosing []loxObject) string {
+	if slices.Contains(enclosing, loxObject(m)) {
+		return "{...}"
+	}
+	enclosing = append(enclosing, m)
+	var b strings.Builder
+	b.WriteString("{")
+	for i, entry := range m.entries {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		key := containedElementString(entry.Key, enclosing)
+		value := containedElementString(entry.Value, enclosing)
+		fmt.Fprintf(&b, "%s: %s", key, value)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (m *loxMap) Type() loxType {
+	return loxTypeMap
+}
+
+// Get returns the value of a key in the map. keyExpr is the expression which the key was evaluated from and is used
+// to report errors.
+func (m *loxMap) Get(vm *VM, keyExpr ast.Expr, key loxObject) loxObject {
+	index, ok := m.indexesByKey[hashKey(vm, keyExpr, key)]
+	if !ok {
+		panic(lox.NewErrorFromNode(keyExpr, "map has no key %s", elementString(key)))
+	}
+	return m.entries[index].Value
+}
+
+// Set sets the value of a key in the map. If the key is not already present, then it's added after all existing keys.
+// keyExpr is the expression which the key was evaluated from and is used to report errors.
+func (m *loxMap) Set(vm *VM, keyExpr ast.Expr, key loxObject, value loxObject) {
+	hash := hashKey(vm, keyExpr, key)
+	if index, ok := m.indexesByKey[hash]; ok {
+		m.entries[index].Value = value
+		return
+	}
+	m.indexesByKey[hash] = len(m.entries)
+	m.entries = append(m.entries, loxMapEntry{Key: key, Value: value})
+}
+
+// hashMethodName is the name of the method which makes an instance hashable when defined on its class.
+const hashMethodName = "hash"
+
+// instanceHashKey is the hash key of an instance whose class defines a hash method.
+type instanceHashKey struct {
+	class *loxClass
+	hash  loxObject
+}
+
+// hashKey returns a comparable value which identifies the given map key. Objects with equal hash keys refer to the same
+// map entry.
+// Numbers, strings, bools, and nil are hashable, as are instances whose class defines a hash method which returns one
+// of these types. Any other object is unhashable and an error is raised. keyExpr is the expression which the key was
+// evaluated from and is used to report errors.
+func hashKey(vm *VM, keyExpr ast.Expr, key loxObject) any {
+	switch key := key.(type) {
+	case loxNumber, loxString, loxBool, loxNil:
+		return key
+	case *loxInstance:
+		method, ok := key.class.GetMethod(hashMethodName)
+		if !ok {
+			break
+		}
+		if len(method.Params()) > 0 {
+			panic(lox.NewErrorFromNode(keyExpr, "%s() must not accept any arguments to be used as a hash method", method.Name()))
+		}
+		switch hash := vm.callMethod(keyExpr, key, method).(type) {
+		case loxNumber, loxString, loxBool, loxNil:
+			return instanceHashKey{class: key.class, hash: hash}
+		default:
+			panic(lox.NewErrorFromNode(
+				keyExpr,
+				"%s() must return a %m, %m, %m, or %m to be used as a hash method, got %m",
+				method.Name(), loxTypeNumber, loxTypeString, loxTypeBool, loxTypeNil, hash.Type(),
+			))
+		}
+	}
+	panic(lox.NewErrorFromNode(keyExpr, "%m object is not hashable", key.Type()))
+}
+
+type funType int
+
+const (
+	funTypeScript funType = iota
+	funTypeFunction
+	funTypeMethod
+	funTypeInit
+)
+
+// loxFunction is a compiled function. It's not a Lox object itself, but is wrapped in a loxClosure at runtime.
+type loxFunction struct {
+	name         string
+	params       []string
+	typ          funType
+	chunk        chunk
+	upvalueCount int
+}
+
+func (f *loxFunction) String() string {
+	return fmt.Sprintf("<compiled function %s>", f.name)
+}
+
+func (f *loxFunction) Type() loxType {
+	return loxTypeFunction
+}
+
+// upvalue is a variable which has been captured by a closure. It refers to a slot on the stack until the variable goes
+// out of scope, at which point it's closed and holds the value itself.
+type upvalue struct {
+	slot   int
+	closed bool
+	value  loxObject
+}
+
+type loxClosure struct {
+	function *loxFunction
+	upvalues []*upvalue
+	globals  *globals
+}
+
+func (c *loxClosure) String() string {
+	switch c.function.typ {
+	case funTypeScript, funTypeFunction:
+		return fmt.Sprintf("[function %s]", c.function.name)
+	case funTypeMethod, funTypeInit:
+		return fmt.Sprintf("[bound method %s]", c.function.name)
+	default:
+		panic(fmt.Sprintf("unexpected function type %d", c.function.typ))
+	}
+}
+
+func (c *loxClosure) Type() loxType {
+	return loxTypeFunction
+}
+
+func (c *loxClosure) Name() string {
+	return c.function.name
+}
+
+func (c *loxClosure) Params() []string {
+	return c.function.params
+}
+
+type loxBoundMethod struct {
+	receiver *loxInstance
+	method   *loxClosure
+}
+
+func (m *loxBoundMethod) String() string {
+	return m.method.String()
+}
+
+func (m *loxBoundMethod) Type() loxType {
+	return loxTypeFunction
+}
+
+func (m *loxBoundMethod) Name() string {
+	return m.method.Name()
+}
+
+func (m *loxBoundMethod) Params() []string {
+	return m.method.Params()
+}
+
+type loxBuiltinFunction struct {
+	name   string
+	params []string
+	body   func(vm *VM, call ast.CallExpr, args []loxObject) loxObject
+}
+
+func newLoxBuiltinFunction(
+	name string,
+	params []string,
+	body func(vm *VM, call ast.CallExpr, args []loxObject) loxObject,
+) *loxBuiltinFunction {
+	return &loxBuiltinFunction{
+		name:   name,
+		params: params,
+		body:   body,
+	}
+}
+
+func (f *loxBuiltinFunction) String() string {
+	return fmt.Sprintf("[builtin function %s]", f.name)
+}
+
+func (f *loxBuiltinFunction) Type() loxType {
+	return loxTypeFunction
+}
+
+func (f *loxBuiltinFunction) Name() string {
+	return f.name
+}
+
+func (f *loxBuiltinFunction) Params() []string {
+	return f.params
+}
+
+type loxClass struct {
+	name          string
+	superclass    *loxClass
+	init          *loxClosure
+	methodsByName map[string]*loxClosure
+}
+
+func newLoxClass(name string, superclass *loxClass) *loxClass {
+	class := &loxClass{
+		name:          name,
+		superclass:    superclass,
+		methodsByName: map[string]*loxClosure{},
+	}
+	if superclass != nil {
+		class.init = superclass.init
+	}
+	return class
+}
+
+func (c *loxClass) String() string {
+	return fmt.Sprintf("[class %s]", c.name)
+}
+
+func (c *loxClass) Type() loxType {
+	return loxTypeClass
+}
+
+func (c *loxClass) Name() string {
+	return c.name
+}
+
+func (c *loxClass) Params() []string {
+	if c.init == nil {
+		return nil
+	}
+	return c.init.Params()
+}
+
+// AddMethod adds a method to the class.
+func (c *loxClass) AddMethod(name string, method *loxClosure) {
+	c.methodsByName[name] = method
+	if name == token.InitIdent {
+		c.init = method
+	}
+}
+
+// GetMethod returns the method with the given name, searching up the superclass chain if it's not defined on this
+// class.
+func (c *loxClass) GetMethod(name string) (*loxClosure, bool) {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.methodsByName[name]; ok {
+			return method, true
+		}
+	}
+	return nil, false
+}
+
+type loxInstance struct {
+	class             *loxClass
+	fieldValuesByName map[string]loxObject
+}
+
+func newLoxInstance(class *loxClass) *loxInstance {
+	return &loxInstance{
+		class:             class,
+		fieldValuesByName: make(map[string]loxObject),
+	}
+}
+
+func (i *loxInstance) String() string {
+	return fmt.Sprintf("[%s object]", i.class.Name())
+}
+
+func (i *loxInstance) Type() loxType {
+	return loxType(i.class.Name())
+}
+
+func (i *loxInstance) Get(node ast.Node, name string) loxObject {
+	if value, ok := i.fieldValuesByName[name]; ok {
+		return value
+	}
+	if method, ok := i.class.GetMethod(name); ok {
+		return &loxBoundMethod{receiver: i, method: method}
+	}
+	panic(lox.NewErrorFromNode(node, "%m object has no property %s", i.Type(), name))
+}
+
+// Set sets the value of a field.
+func (i *loxInstance) Set(name string, value loxObject) {
+	i.fieldValuesByName[name] = value
+}
+
+type loxModule struct {
+	name           string
+	globals        *globals
+	exportedIdents map[string]bool
+}
+
+// newLoxModule returns a module whose properties are the declarations in its global environment, excluding the
+// built-in declarations which still have their built-in values. A built-in which the module has redeclared or assigned
+// to is one of its properties.
+func newLoxModule(name string, moduleGlobals *globals, builtins *globals) *loxModule {
+	exportedIdents := make(map[string]bool)
+	for ident, value := range moduleGlobals.valuesByIdent {
+		if builtin, ok := builtins.valuesByIdent[ident]; !ok || value != builtin {
+			exportedIdents[ident] = true
+		}
+	}
+	return &loxModule{
+		name:           name,
+		globals:        moduleGlobals,
+		exportedIdents: exportedIdents,
+	}
+}
+
+func (m *loxModule) String() string {
+	return fmt.Sprintf("[module %s]", m.name)
+}
+
+func (m *loxModule) Type() loxType {
+	return loxTypeModule
+}
+
+func (m *loxModule) Get(node ast.Node, name string) loxObject {
+	if !m.exportedIdents[name] {
+		panic(lox.NewErrorFromNode(node, "%m object has no property %s", m.Type(), name))
+	}
+	return m.globals.Get(node, name)
+}
+
+// pendingException is an exception which is being handled by a finally block. It's never visible to Lox code.
+type pendingException struct {
+	// panicValue is the value which the exception was raised with and is used to raise it again once the finally
+	// block has been executed.
+	panicValue any
+}
+
+func (pendingException) String() string {
+	return "<pending exception>"
+}
+
+func (pendingException) Type() loxType {
+	return "pending exception"
+}
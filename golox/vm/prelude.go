@@ -0,0 +1,29 @@
+package vm
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+
+	"github.com/marcuscaisey/lox/golox/parser"
+)
+
+// prelude is Lox source code which is interpreted by every new VM before any user code. Its declarations are
+// available in every module.
+//
+//go:embed prelude.lox
+var prelude []byte
+
+// errorClassName is the name of the class defined in the prelude which runtime errors are instances of.
+const errorClassName = "Error"
+
+func (vm *VM) interpretPrelude() {
+	program, err := parser.Parse(bytes.NewReader(prelude))
+	if err != nil {
+		panic(fmt.Sprintf("parsing prelude: %s", err))
+	}
+	if err := vm.interpretProgram(vm.builtins, program); err != nil {
+		panic(fmt.Sprintf("resolving prelude: %s", err))
+	}
+	vm.errorClass = vm.builtins.GetByIdent(errorClassName).(*loxClass)
+}
@@ -0,0 +1,825 @@
+// Package vm defines a bytecode virtual machine for the language. Programs are compiled to bytecode which is executed
+// on a value stack, rather than by walking their AST.
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/resolver"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// VM is a bytecode virtual machine for the language.
+type VM struct {
+	builtins             *globals // declarations which are available in every module
+	globals              *globals
+	printExprStmtResults bool
+	errorClass           *loxClass
+	modulesByPath        map[string]*loxModule
+	importStack          []importingModule
+
+	stack        []loxObject
+	frames       []callFrame
+	handlers     []handler
+	openUpvalues []*upvalue // sorted by slot in ascending order
+	maxCallDepth int
+
+	stdout flushWriter // flushed when execution finishes or input is read
+	stdin  *bufio.Reader
+	args   []string
+}
+
+// callFrame is an invocation of a function which hasn't returned yet.
+type callFrame struct {
+	closure     *loxClosure
+	ip          int
+	base        int       // index of the stack slot which holds the function or receiver, followed by the locals
+	returnValue loxObject // set by opStoreReturn
+	name        string    // name of the callable which was called, or empty if the frame wasn't created by a call
+	call        ast.Node  // expression which made the call, or nil if the frame wasn't created by a call
+	callDepth   int       // number of frames up to and including this one which were created by call expressions
+}
+
+// handler is an exception handler which has been pushed by a try statement.
+type handler struct {
+	kind        handlerKind
+	frameCount  int // number of call frames when the handler was pushed, the last of which contains the try statement
+	stackHeight int
+	ip          int // offset of the handler code in the chunk of the frame which contains the try statement
+}
+
+// Option can be passed to New to configure the VM.
+type Option func(*VM)
+
+// REPLMode sets the VM to REPL mode.
+// In REPL mode, the VM will print the result of expression statements.
+func REPLMode() Option {
+	return func(vm *VM) {
+		vm.printExprStmtResults = true
+	}
+}
+
+// DefaultMaxCallDepth is the maximum depth of nested calls if one isn't set with [MaxCallDepth].
+const DefaultMaxCallDepth = 10000
+
+// MaxCallDepth sets the maximum depth of nested calls.
+// A call which would exceed it raises a "stack overflow" error instead, which stops unbounded recursion from growing the
+// call stack indefinitely.
+func MaxCallDepth(depth int) Option {
+	return func(vm *VM) {
+		vm.maxCallDepth = depth
+	}
+}
+
+// Stdout sets the writer which program output is written to.
+// Output is buffered and flushed when [*VM.Interpret] returns and before input is read. The default is [os.Stdout],
+// which is also flushed at the end of each line so that output isn't held back from a program which runs for a long
+// time or is killed.
+func Stdout(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.stdout = bufio.NewWriter(w)
+	}
+}
+
+// flushWriter is a buffered writer.
+type flushWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// Stdin sets the reader which input is read from. The default is [os.Stdin].
+func Stdin(r io.Reader) Option {
+	return func(vm *VM) {
+		vm.stdin = bufio.NewReader(r)
+	}
+}
+
+// Args sets the command-line arguments which are returned by the args built-in function.
+func Args(args []string) Option {
+	return func(vm *VM) {
+		vm.args = args
+	}
+}
+
+// New constructs a new VM with the given options.
+func New(opts ...Option) *VM {
+	builtinsGlobals := newGlobals()
+	for _, fun := range builtins {
+		builtinsGlobals.Set(fun.Name(), fun)
+	}
+	vm := &VM{
+		builtins:      builtinsGlobals,
+		modulesByPath: map[string]*loxModule{},
+		maxCallDepth:  DefaultMaxCallDepth,
+		stdout:        lox.NewLineWriter(os.Stdout),
+		stdin:         bufio.NewReader(os.Stdin),
+	}
+	vm.interpretPrelude()
+	vm.globals = vm.newGlobals()
+	for _, opt := range opts {
+		opt(vm)
+	}
+	return vm
+}
+
+// Interpret compiles and executes a program and returns an error if one occurred.
+// If the program calls the exit built-in function, then a [*lox.ExitError] is returned.
+// Interpret can be called multiple times with different ASTs and the state will be maintained between calls.
+func (vm *VM) Interpret(program ast.Program) (err error) {
+	defer func() {
+		if flushErr := vm.stdout.Flush(); err == nil {
+			err = flushErr
+		}
+	}()
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		r = vm.withTraceback(r)
+		vm.stack = vm.stack[:0]
+		vm.frames = vm.frames[:0]
+		vm.handlers = vm.handlers[:0]
+		vm.openUpvalues = vm.openUpvalues[:0]
+		switch r := r.(type) {
+		case *lox.Error:
+			err = r
+		case thrownValue:
+			err = lox.NewErrorFromNode(r.node, "%s", vm.uncaughtMessage(r.value)).(*lox.Error).WithTraceback(r.traceback)
+		case moduleError:
+			err = r.err
+		case *lox.ExitError:
+			err = r
+		default:
+			panic(r)
+		}
+	}()
+	return vm.interpretProgram(vm.globals, program)
+}
+
+// DumpGlobals returns a description of the global declarations, including the built-in ones, with one declaration per
+// line.
+func (vm *VM) DumpGlobals() string {
+	return vm.globals.String()
+}
+
+// newGlobals returns a new set of globals for a module which contains the built-in declarations.
+func (vm *VM) newGlobals() *globals {
+	globals := newGlobals()
+	for ident, value := range vm.builtins.valuesByIdent {
+		globals.Set(ident, value)
+	}
+	return globals
+}
+
+// interpretProgram resolves, compiles, and then executes a program with the given globals. An error is returned if
+// the program could not be resolved or compiled.
+func (vm *VM) interpretProgram(globals *globals, program ast.Program) error {
+	if _, err := resolver.Resolve(program); err != nil {
+		return err
+	}
+	function, err := compile(program)
+	if err != nil {
+		return err
+	}
+	closure := &loxClosure{function: function, globals: globals}
+	vm.push(closure)
+	vm.pushFrame(closure, len(vm.stack)-1, nil, "")
+	vm.run(len(vm.frames) - 1)
+	return nil
+}
+
+func (vm *VM) push(value loxObject) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() loxObject {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *VM) peek() loxObject {
+	return vm.stack[len(vm.stack)-1]
+}
+
+// pushFrame pushes a call frame for a closure whose function or receiver is in the given stack slot. call is the
+// expression which called the callable with the given name, or nil if the frame isn't being pushed for a call.
+func (vm *VM) pushFrame(closure *loxClosure, base int, call ast.Node, name string) {
+	callDepth := vm.callDepth()
+	if call != nil {
+		callDepth++
+	}
+	vm.frames = append(vm.frames, callFrame{closure: closure, base: base, name: name, call: call, callDepth: callDepth})
+}
+
+// callDepth returns the number of calls which are in progress.
+func (vm *VM) callDepth() int {
+	if len(vm.frames) == 0 {
+		return 0
+	}
+	return vm.frames[len(vm.frames)-1].callDepth
+}
+
+// thrownValue is used as a panic value to unwind the stack when a value is thrown by a throw statement.
+type thrownValue struct {
+	value     loxObject
+	node      ast.Node // expression that the value was evaluated from
+	traceback []lox.StackFrame
+}
+
+// traceback returns the calls which are currently in progress, ordered from the outermost call to the innermost.
+func (vm *VM) traceback() []lox.StackFrame {
+	var traceback []lox.StackFrame
+	for _, frame := range vm.frames {
+		if frame.call != nil {
+			traceback = append(traceback, lox.StackFrame{Name: frame.name, Call: frame.call.Start()})
+		}
+	}
+	return traceback
+}
+
+// withTraceback attaches the current call stack to an exception as its traceback, unless it already has one. This
+// must be done before the call frames are unwound.
+func (vm *VM) withTraceback(r any) any {
+	switch r := r.(type) {
+	case *lox.Error:
+		if r.Traceback() == nil {
+			return r.WithTraceback(vm.traceback())
+		}
+	case thrownValue:
+		if r.traceback == nil {
+			r.traceback = vm.traceback()
+			return r
+		}
+	}
+	return r
+}
+
+// run executes instructions until the call frame at index baseFrameCount returns and then returns its result.
+// Exceptions are handled by the innermost handler which was pushed by one of the frames being executed. If there
+// isn't one, then the exception is propagated to the caller of run.
+func (vm *VM) run(baseFrameCount int) loxObject {
+	for {
+		if result, returned := vm.runUntilHandled(baseFrameCount); returned {
+			return result
+		}
+	}
+}
+
+// runUntilHandled executes instructions until either the call frame at index baseFrameCount returns, in which case its
+// result is returned, or an exception is handled, in which case execution should be resumed.
+func (vm *VM) runUntilHandled(baseFrameCount int) (result loxObject, returned bool) {
+	defer func() {
+		if r := recover(); r != nil && !vm.handleException(r, baseFrameCount) {
+			panic(r)
+		}
+	}()
+	return vm.execute(baseFrameCount), true
+}
+
+// handleException unwinds the stack to the innermost exception handler and pushes the exception for it to handle. If
+// there is no handler above baseFrameCount, or the panic value is not an exception, then false is returned.
+func (vm *VM) handleException(r any, baseFrameCount int) bool {
+	switch r.(type) {
+	case thrownValue, *lox.Error:
+	case *lox.ExitError:
+		// Exiting can't be caught, so it's only handled by finally blocks.
+		for len(vm.handlers) > 0 {
+			h := vm.handlers[len(vm.handlers)-1]
+			if h.kind == handlerKindFinally || h.frameCount <= baseFrameCount {
+				break
+			}
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		}
+	default:
+		return false
+	}
+	if len(vm.handlers) == 0 {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	if h.frameCount <= baseFrameCount {
+		return false
+	}
+	if h.kind == handlerKindFinally {
+		// The exception will be raised again once the finally block has been executed, by which point the frames
+		// which were being executed when it was first raised will have been unwound.
+		r = vm.withTraceback(r)
+	}
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.closeUpvalues(h.stackHeight)
+	vm.stack = vm.stack[:h.stackHeight]
+	vm.frames = vm.frames[:h.frameCount]
+	vm.frames[len(vm.frames)-1].ip = h.ip
+	switch h.kind {
+	case handlerKindCatch:
+		vm.push(vm.caughtValue(r))
+	case handlerKindFinally:
+		vm.push(pendingException{panicValue: r})
+	}
+	return true
+}
+
+// caughtValue returns the value which a catch block receives for an exception. Runtime errors are converted to
+// instances of the Error class.
+func (vm *VM) caughtValue(r any) loxObject {
+	switch r := r.(type) {
+	case thrownValue:
+		return r.value
+	case *lox.Error:
+		return vm.newErrorInstance(r.Message(), r.Start())
+	default:
+		panic(fmt.Sprintf("unexpected exception type: %T", r))
+	}
+}
+
+// execute executes instructions until the call frame at index baseFrameCount returns and then returns its result.
+func (vm *VM) execute(baseFrameCount int) loxObject {
+	var (
+		frame *callFrame
+		chunk *chunk
+	)
+	// loadFrame must be called whenever the call frames change, including when a nested call to run may have grown
+	// them.
+	loadFrame := func() {
+		frame = &vm.frames[len(vm.frames)-1]
+		chunk = &frame.closure.function.chunk
+	}
+	readU8 := func() uint8 {
+		n := chunk.readU8(frame.ip)
+		frame.ip++
+		return n
+	}
+	readU16 := func() int {
+		n := chunk.readU16(frame.ip)
+		frame.ip += 2
+		return int(n)
+	}
+	readString := func() string {
+		return string(chunk.constants[readU16()].(loxString))
+	}
+
+	loadFrame()
+	for {
+		start := frame.ip
+		node := chunk.nodes[start]
+		op := opCode(readU8())
+		switch op {
+		case opConstant:
+			vm.push(chunk.constants[readU16()])
+		case opNil:
+			vm.push(loxNil{})
+		case opTrue:
+			vm.push(loxBool(true))
+		case opFalse:
+			vm.push(loxBool(false))
+		case opUndefined:
+			vm.push(loxUndefined{})
+		case opPop:
+			vm.pop()
+		case opPopExprStmt:
+			value := vm.pop()
+			if vm.printExprStmtResults {
+				fmt.Fprintln(vm.stdout, value.String())
+			}
+		case opDefineGlobal:
+			frame.closure.globals.Define(node, readString(), vm.pop())
+		case opDeclareGlobal:
+			frame.closure.globals.Declare(node, readString())
+		case opGetGlobal:
+			vm.push(frame.closure.globals.Get(node, readString()))
+		case opSetGlobal:
+			frame.closure.globals.Assign(node, readString(), vm.peek())
+		case opGetLocal:
+			vm.push(checkDefined(node, vm.stack[frame.base+readU16()]))
+		case opSetLocal:
+			vm.stack[frame.base+readU16()] = vm.peek()
+		case opGetUpvalue:
+			vm.push(checkDefined(node, vm.upvalueValue(frame.closure.upvalues[readU16()])))
+		case opSetUpvalue:
+			vm.setUpvalueValue(frame.closure.upvalues[readU16()], vm.peek())
+		case opCloseUpvalue:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+		case opNegate:
+			value := vm.pop()
+			n, ok := value.(loxNumber)
+			if !ok {
+				panic(lox.NewErrorFromNode(node, "%m operator cannot be used with type %m", token.Minus, value.Type()))
+			}
+			vm.push(-n)
+		case opNot:
+			vm.push(loxBool(!isTruthy(vm.pop())))
+		case opBinary:
+			op := token.Type(readU8())
+			right := vm.pop()
+			left := vm.pop()
+			vm.push(binaryOp(op, node, left, right))
+		case opEqual:
+			right := vm.pop()
+			left := vm.pop()
+			vm.push(loxBool(left == right))
+		case opNotEqual:
+			right := vm.pop()
+			left := vm.pop()
+			vm.push(loxBool(left != right))
+		case opPrint:
+			fmt.Fprintln(vm.stdout, vm.pop().String())
+		case opJump:
+			offset := readU16()
+			frame.ip += offset
+		case opJumpIfFalse:
+			offset := readU16()
+			if !isTruthy(vm.peek()) {
+				frame.ip += offset
+			}
+		case opJumpIfTrue:
+			offset := readU16()
+			if isTruthy(vm.peek()) {
+				frame.ip += offset
+			}
+		case opLoop:
+			offset := readU16()
+			frame.ip -= offset
+		case opCall:
+			vm.callValue(node.(ast.CallExpr), int(readU8()))
+			loadFrame()
+		case opClosure:
+			function := chunk.constants[readU16()].(*loxFunction)
+			closure := &loxClosure{
+				function: function,
+				upvalues: make([]*upvalue, function.upvalueCount),
+				globals:  frame.closure.globals,
+			}
+			for i := range closure.upvalues {
+				isLocal := readU8() == 1
+				index := readU16()
+				if isLocal {
+					closure.upvalues[i] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(closure)
+		case opReturn:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			vm.stack = vm.stack[:frame.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			// Any handlers which the function pushed are no longer needed.
+			n := len(vm.handlers)
+			for n > 0 && vm.handlers[n-1].frameCount > len(vm.frames) {
+				n--
+			}
+			vm.handlers = vm.handlers[:n]
+			if len(vm.frames) == baseFrameCount {
+				return result
+			}
+			vm.push(result)
+			loadFrame()
+		case opStoreReturn:
+			frame.returnValue = vm.pop()
+		case opLoadReturn:
+			vm.push(frame.returnValue)
+		case opClass:
+			name := readString()
+			var superclass *loxClass
+			if hasSuperclass := readU8() == 1; hasSuperclass {
+				object := vm.peek()
+				class, ok := object.(*loxClass)
+				if !ok {
+					panic(lox.NewErrorFromNode(node, "%m object cannot be used as a superclass", object.Type()))
+				}
+				superclass = class
+			}
+			vm.push(newLoxClass(name, superclass))
+		case opMethod:
+			name := readString()
+			method := vm.pop().(*loxClosure)
+			vm.peek().(*loxClass).AddMethod(name, method)
+		case opGetProperty:
+			expr := node.(ast.GetExpr)
+			name := readString()
+			object := vm.pop()
+			accessor, ok := object.(loxPropertyAccessor)
+			if !ok {
+				panic(lox.NewError(expr.Object.Start(), expr.Name.End, "property access is not valid for %m object", object.Type()))
+			}
+			vm.push(accessor.Get(tokenNode{expr.Name}, name))
+		case opSetProperty:
+			name := readString()
+			value := vm.pop()
+			instance := vm.pop().(*loxInstance)
+			instance.Set(name, value)
+			vm.push(value)
+		case opGetSuper:
+			expr := node.(ast.SuperExpr)
+			name := readString()
+			superclass := vm.pop().(*loxClass)
+			instance := vm.pop().(*loxInstance)
+			method, ok := superclass.GetMethod(name)
+			if !ok {
+				panic(lox.NewErrorFromToken(expr.Method, "superclass %s has no method %s", superclass.Name(), name))
+			}
+			vm.push(&loxBoundMethod{receiver: instance, method: method})
+		case opList:
+			n := readU16()
+			elements := slices.Clone(vm.stack[len(vm.stack)-n:])
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(newLoxList(elements))
+		case opMap:
+			expr := node.(ast.MapExpr)
+			n := readU16()
+			entries := vm.stack[len(vm.stack)-2*n:]
+			m := newLoxMap()
+			for i, entry := range expr.Entries {
+				m.Set(vm, entry.Key, entries[2*i], entries[2*i+1])
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*n]
+			vm.push(m)
+			loadFrame()
+		case opCheckType:
+			checkType(node, typeCheck(readU8()), vm.peek())
+		case opIndex:
+			expr := node.(ast.IndexExpr)
+			index := vm.pop()
+			switch object := vm.pop().(type) {
+			case *loxList:
+				vm.push(object.elements[object.elementIndex(expr.Index, index)])
+			case *loxMap:
+				vm.push(object.Get(vm, expr.Index, index))
+			default:
+				panic(fmt.Sprintf("unexpected indexed object type: %T", object))
+			}
+			loadFrame()
+		case opSetIndex:
+			expr := node.(ast.IndexSetExpr)
+			value := vm.pop()
+			index := vm.pop()
+			switch object := vm.pop().(type) {
+			case *loxList:
+				object.elements[object.elementIndex(expr.Index, index)] = value
+			case *loxMap:
+				object.Set(vm, expr.Index, index, value)
+			default:
+				panic(fmt.Sprintf("unexpected indexed object type: %T", object))
+			}
+			vm.push(value)
+			loadFrame()
+		case opSlice:
+			expr := node.(ast.SliceExpr)
+			flags := readU8()
+			var low, high loxObject
+			if flags&sliceHasHigh != 0 {
+				high = vm.pop()
+			}
+			if flags&sliceHasLow != 0 {
+				low = vm.pop()
+			}
+			list := vm.pop().(*loxList)
+			vm.push(list.slice(expr, low, high))
+		case opInterpolate:
+			n := readU16()
+			var b strings.Builder
+			for _, part := range vm.stack[len(vm.stack)-n:] {
+				b.WriteString(part.String())
+			}
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(loxString(b.String()))
+		case opThrow:
+			value := vm.pop()
+			if instance, ok := value.(*loxInstance); ok && vm.isErrorInstance(instance) {
+				if _, ok := instance.fieldValuesByName[errorLineField]; !ok {
+					setErrorPosition(instance, node.Start())
+				}
+			}
+			panic(thrownValue{value: value, node: node})
+		case opPushHandler:
+			kind := handlerKind(readU8())
+			offset := readU16()
+			vm.handlers = append(vm.handlers, handler{
+				kind:        kind,
+				frameCount:  len(vm.frames),
+				stackHeight: len(vm.stack),
+				ip:          frame.ip + offset,
+			})
+		case opPopHandler:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case opRethrow:
+			panic(vm.pop().(pendingException).panicValue)
+		case opRethrowExit:
+			if exitErr, ok := vm.pop().(pendingException).panicValue.(*lox.ExitError); ok {
+				panic(exitErr)
+			}
+		case opImport:
+			vm.push(vm.importModule(node.(ast.ImportDecl)))
+			loadFrame()
+		default:
+			panic(fmt.Sprintf("unexpected opcode: %d", op))
+		}
+	}
+}
+
+// checkDefined raises an error if the value of the variable referred to by node is undefined.
+func checkDefined(node ast.Node, value loxObject) loxObject {
+	if value == (loxUndefined{}) {
+		panic(lox.NewErrorFromNode(node, "%s has not been defined", node.(tokenNode).tok.Lexeme))
+	}
+	return value
+}
+
+// checkType raises an error if the operation determined by check isn't valid for object.
+func checkType(node ast.Node, check typeCheck, object loxObject) {
+	switch check {
+	case typeCheckIndex:
+		switch object.(type) {
+		case *loxList, *loxMap:
+		default:
+			panic(lox.NewErrorFromNode(node, "indexing is not valid for %m object", object.Type()))
+		}
+	case typeCheckSetIndex:
+		switch object.(type) {
+		case *loxList, *loxMap:
+		default:
+			expr := node.(ast.IndexSetExpr)
+			panic(lox.NewErrorFromNodeRange(expr.Object, expr.Value, "index assignment is not valid for %m object", object.Type()))
+		}
+	case typeCheckSlice:
+		if _, ok := object.(*loxList); !ok {
+			panic(lox.NewErrorFromNode(node, "slicing is not valid for %m object", object.Type()))
+		}
+	case typeCheckSetProperty:
+		if _, ok := object.(*loxInstance); !ok {
+			expr := node.(ast.SetExpr)
+			panic(lox.NewErrorFromNodeRange(expr.Object, expr.Value, "property assignment is not valid for %m object", object.Type()))
+		}
+	default:
+		panic(fmt.Sprintf("unexpected type check: %d", check))
+	}
+}
+
+// callValue calls the callee which is on the stack below its arguments.
+func (vm *VM) callValue(expr ast.CallExpr, argCount int) {
+	base := len(vm.stack) - argCount - 1
+	callee := vm.stack[base]
+	callable, ok := callee.(loxCallable)
+	if !ok {
+		panic(lox.NewErrorFromNode(expr.Callee, "%m object is not callable", callee.Type()))
+	}
+	checkArity(expr, callable, argCount)
+	if vm.callDepth() >= vm.maxCallDepth {
+		panic(lox.NewErrorFromNode(expr, "stack overflow"))
+	}
+
+	switch callee := callable.(type) {
+	case *loxClosure:
+		vm.pushFrame(callee, base, expr, callee.Name())
+	case *loxBoundMethod:
+		vm.stack[base] = callee.receiver
+		vm.pushFrame(callee.method, base, expr, callee.Name())
+	case *loxClass:
+		vm.stack[base] = newLoxInstance(callee)
+		if callee.init != nil {
+			vm.pushFrame(callee.init, base, expr, callee.Name())
+		}
+	case *loxBuiltinFunction:
+		result := callee.body(vm, expr, vm.stack[base+1:])
+		vm.stack = vm.stack[:base]
+		vm.push(result)
+	default:
+		panic(fmt.Sprintf("unexpected callable type: %T", callee))
+	}
+}
+
+func checkArity(expr ast.CallExpr, callable loxCallable, argCount int) {
+	params := callable.Params()
+	arity := len(params)
+	switch {
+	case argCount < arity:
+		argumentSuffix := ""
+		if arity-argCount > 1 {
+			argumentSuffix = "s"
+		}
+		missingArgs := params[argCount:]
+		var missingArgsStr string
+		switch len(missingArgs) {
+		case 1:
+			missingArgsStr = missingArgs[0]
+		case 2:
+			missingArgsStr = missingArgs[0] + " and " + missingArgs[1]
+		default:
+			missingArgsStr = strings.Join(missingArgs[:len(missingArgs)-1], ", ") + ", and " + missingArgs[len(missingArgs)-1]
+		}
+		panic(lox.NewErrorFromNode(
+			expr,
+			"%s() missing %d argument%s: %s", callable.Name(), arity-argCount, argumentSuffix, missingArgsStr,
+		))
+	case argCount > arity:
+		panic(lox.NewErrorFromNodeRange(
+			expr.Args[arity],
+			expr.Args[argCount-1],
+			"%s() accepts %d arguments but %d were given", callable.Name(), arity, argCount,
+		))
+	}
+}
+
+// callMethod calls a method with no arguments from Go code and returns its result. node is the expression which caused
+// the call, such as a map key whose hash method is called. The call counts towards the maximum call depth.
+func (vm *VM) callMethod(node ast.Node, receiver *loxInstance, method *loxClosure) loxObject {
+	if vm.callDepth() >= vm.maxCallDepth {
+		panic(lox.NewErrorFromNode(node, "stack overflow"))
+	}
+	vm.push(receiver)
+	vm.pushFrame(method, len(vm.stack)-1, node, method.Name())
+	return vm.run(len(vm.frames) - 1)
+}
+
+// captureUpvalue returns an upvalue which captures the local variable in the given stack slot. Closures which capture
+// the same variable share the same upvalue.
+func (vm *VM) captureUpvalue(slot int) *upvalue {
+	i := len(vm.openUpvalues)
+	for i > 0 && vm.openUpvalues[i-1].slot >= slot {
+		if vm.openUpvalues[i-1].slot == slot {
+			return vm.openUpvalues[i-1]
+		}
+		i--
+	}
+	upvalue := &upvalue{slot: slot}
+	vm.openUpvalues = slices.Insert(vm.openUpvalues, i, upvalue)
+	return upvalue
+}
+
+// closeUpvalues closes the upvalues which capture the variables in the given stack slot and above.
+func (vm *VM) closeUpvalues(slot int) {
+	n := len(vm.openUpvalues)
+	for n > 0 && vm.openUpvalues[n-1].slot >= slot {
+		upvalue := vm.openUpvalues[n-1]
+		upvalue.value = vm.stack[upvalue.slot]
+		upvalue.closed = true
+		n--
+	}
+	vm.openUpvalues = vm.openUpvalues[:n]
+}
+
+func (vm *VM) upvalueValue(upvalue *upvalue) loxObject {
+	if upvalue.closed {
+		return upvalue.value
+	}
+	return vm.stack[upvalue.slot]
+}
+
+func (vm *VM) setUpvalueValue(upvalue *upvalue, value loxObject) {
+	if upvalue.closed {
+		upvalue.value = value
+	} else {
+		vm.stack[upvalue.slot] = value
+	}
+}
+
+const (
+	errorMessageField = "message"
+	errorLineField    = "line"
+	errorColumnField  = "column"
+)
+
+// newErrorInstance returns an instance of the Error class with the given message and position. Its fields are set
+// directly, rather than by calling init, so that no Lox code is executed whilst an exception is being handled.
+func (vm *VM) newErrorInstance(msg string, pos token.Position) *loxInstance {
+	instance := newLoxInstance(vm.errorClass)
+	instance.Set(errorMessageField, loxString(msg))
+	setErrorPosition(instance, pos)
+	return instance
+}
+
+func setErrorPosition(instance *loxInstance, pos token.Position) {
+	instance.Set(errorLineField, loxNumber(pos.Line))
+	instance.Set(errorColumnField, loxNumber(pos.DisplayColumn()))
+}
+
+// isErrorInstance reports whether an instance is an instance of the Error class or one of its subclasses.
+func (vm *VM) isErrorInstance(instance *loxInstance) bool {
+	for class := instance.class; class != nil; class = class.superclass {
+		if class == vm.errorClass {
+			return true
+		}
+	}
+	return false
+}
+
+// uncaughtMessage returns the message to report when a thrown value is not caught.
+func (vm *VM) uncaughtMessage(value loxObject) string {
+	if instance, ok := value.(*loxInstance); ok && vm.isErrorInstance(instance) {
+		if msg, ok := instance.fieldValuesByName[errorMessageField]; ok {
+			return fmt.Sprintf("%s: %s", instance.class.Name(), msg)
+		}
+	}
+	return fmt.Sprintf("uncaught exception: %s", value)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/marcuscaisey/lox/golox/parser"
+	"github.com/marcuscaisey/lox/golox/token"
+)
+
+// watchDebounce is how long to wait for the watched files to stop changing before the script is run again, so that an
+// editor which saves a file in several steps only causes one run.
+const watchDebounce = 100 * time.Millisecond
+
+// clearScreen clears the terminal and moves the cursor to its top left corner.
+const clearScreen = "\033[H\033[2J"
+
+// runWatch runs the script with the given name and then runs it again whenever it or any of the modules that it
+// imports change. args are returned by the args built-in function. It only returns if the files can't be watched.
+//
+// Each run happens in a new golox process which is killed if the files change before it's finished, so that a script
+// which never finishes or is waiting for input is still run again.
+func runWatch(name string, args []string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watching %s: %s", name, err)
+	}
+	defer watcher.Close()
+
+	for {
+		// The files are watched before the script is run so that changes which are made while it's running aren't
+		// missed.
+		paths := watchedPaths(name)
+		if err := watchDirs(watcher, paths); err != nil {
+			return fmt.Errorf("watching %s: %s", name, err)
+		}
+
+		if isTerminal(os.Stdout) {
+			fmt.Print(clearScreen)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		finished := make(chan struct{})
+		go func() {
+			defer close(finished)
+			err := runScript(ctx, name, args)
+			if ctx.Err() != nil {
+				// The script was killed because the files changed, so it's about to be run again.
+				return
+			}
+			// The script reports its own errors, so only errors from starting it are reported here. They're reported
+			// rather than returned so that the files are still watched.
+			if err != nil && !errors.As(err, new(*exec.ExitError)) {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			fmt.Fprintln(os.Stderr, "Watching for changes. Press Ctrl-C to exit.")
+		}()
+
+		err := waitForChange(watcher, paths)
+		cancel()
+		<-finished
+		if err != nil {
+			return fmt.Errorf("watching %s: %s", name, err)
+		}
+	}
+}
+
+// runScript runs the script with the given name in a new golox process with the same options as this one, except for
+// -watch. The process is killed if ctx is cancelled before it exits.
+func runScript(ctx context.Context, name string, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var cmdArgs []string
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "watch" {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+		}
+	})
+	// -- stops a script whose name starts with - from being parsed as a flag.
+	cmdArgs = append(cmdArgs, "--", name)
+	cmdArgs = append(cmdArgs, args...)
+	cmd := exec.CommandContext(ctx, exe, cmdArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// watchedPaths returns the absolute paths of the script with the given name and all of the modules that it imports,
+// directly or indirectly. Files which can't be read are still included so that the script is run again when they're
+// created.
+func watchedPaths(name string) map[string]bool {
+	paths := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		path, err := filepath.Abs(name)
+		if err != nil || paths[path] {
+			return
+		}
+		paths[path] = true
+		for _, importName := range imports(name) {
+			// Module paths are relative to the directory of the importing file, as they are when the script is run.
+			if !filepath.IsAbs(importName) {
+				importName = filepath.Join(filepath.Dir(name), importName)
+			}
+			visit(importName)
+		}
+	}
+	visit(name)
+	return paths
+}
+
+// imports returns the paths of the modules which are imported by the file with the given name. The file is lexed
+// rather than parsed, so that the imports are still found if it contains syntax errors.
+func imports(name string) []string {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	toks, err := parser.Lex(f)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	var prev token.Token
+	for _, tok := range toks {
+		if tok.Type == token.Comment {
+			continue
+		}
+		if prev.Type == token.Import && tok.Type == token.String {
+			paths = append(paths, tok.Literal)
+		}
+		prev = tok
+	}
+	return paths
+}
+
+// watchDirs updates the watcher so that it watches the directories containing the given paths and nothing else.
+// Directories are watched rather than the files themselves, so that files which are saved by replacing them are still
+// watched afterwards.
+func watchDirs(watcher *fsnotify.Watcher, paths map[string]bool) error {
+	dirs := map[string]bool{}
+	for path := range paths {
+		dirs[filepath.Dir(path)] = true
+	}
+	for _, dir := range watcher.WatchList() {
+		if !dirs[dir] {
+			if err := watcher.Remove(dir); err != nil {
+				return err
+			}
+		}
+	}
+	for dir := range dirs {
+		// A directory which doesn't exist can't be watched, so the script won't be run again when it's created.
+		if err := watcher.Add(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForChange blocks until any of the given paths are created, written to, removed, or renamed and then haven't
+// changed again for watchDebounce. Changes which only affect permissions are ignored.
+func waitForChange(watcher *fsnotify.Watcher, paths map[string]bool) error {
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			if paths[event.Name] && event.Op != fsnotify.Chmod {
+				debounce = time.After(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			return err
+		case <-debounce:
+			return nil
+		}
+	}
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
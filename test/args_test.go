@@ -0,0 +1,44 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestArgs tests that the arguments after the script are passed to it and that the script can be read from stdin.
+func TestArgs(t *testing.T) {
+	src := "#!/usr/bin/env golox\nprint args();\n"
+	path := filepath.Join(t.TempDir(), "args.lox")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+	}{
+		{name: "script", args: []string{path, "a", "-b", "c d"}},
+		{name: "stdin", args: []string{"-", "a", "-b", "c d"}, stdin: src},
+		{name: "command", args: []string{"-c", src, "a", "-b", "c d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := exec.Command(*interpreter, append(strings.Fields(*interpreterArgs), test.args...)...)
+			cmd.Stdin = strings.NewReader(test.stdin)
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			stdout, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("%s\nstderr:\n%s", err, stderr.String())
+			}
+			if diff := cmp.Diff("[\"a\", \"-b\", \"c d\"]\n", string(stdout)); diff != "" {
+				t.Errorf("incorrect output printed to stdout (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const dapProgram = `class Point {
+  init(x, y) {
+    this.x = x;
+    this.y = y;
+  }
+}
+
+fun describe(p, tags) {
+  var label = "point";
+  return label + " " + tags[p.x];
+}
+
+var p = Point(1, 2);
+print describe(p, ["a", "b"]);
+print "done";
+`
+
+// TestDAP tests the debug adapter by sending it requests over stdin and checking the responses and events that it
+// writes to stdout.
+func TestDAP(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dap.lox")
+	if err := os.WriteFile(path, []byte(dapProgram), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := startDAP(t)
+	source := map[string]any{"name": "dap.lox", "path": path}
+
+	c.Request("initialize", map[string]any{"adapterID": "golox"})
+	c.WantEvent("initialized", nil)
+	c.Request("launch", map[string]any{"program": path})
+	c.WantResponse("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": path},
+		"breakpoints": []any{map[string]any{"line": 9}},
+	}, map[string]any{
+		"breakpoints": []any{map[string]any{"verified": true, "line": 9}},
+	})
+	c.Request("configurationDone", nil)
+	c.WantEvent("stopped", map[string]any{"reason": "breakpoint", "threadId": 1, "allThreadsStopped": true})
+
+	c.WantResponse("threads", nil, map[string]any{
+		"threads": []any{map[string]any{"id": 1, "name": "main"}},
+	})
+	c.WantResponse("stackTrace", map[string]any{"threadId": 1}, map[string]any{
+		"stackFrames": []any{
+			map[string]any{"id": 1, "name": "describe", "source": source, "line": 9, "column": 3},
+			map[string]any{"id": 2, "name": "<script>", "source": source, "line": 14, "column": 7},
+		},
+		"totalFrames": 2,
+	})
+	c.WantResponse("scopes", map[string]any{"frameId": 1}, map[string]any{
+		"scopes": []any{
+			map[string]any{"name": "Locals", "presentationHint": "locals", "variablesReference": 1, "expensive": false},
+			map[string]any{"name": "Globals", "variablesReference": 2, "expensive": false},
+		},
+	})
+	c.WantResponse("variables", map[string]any{"variablesReference": 1}, map[string]any{
+		"variables": []any{
+			map[string]any{"name": "p", "value": "[Point object]", "type": "Point", "variablesReference": 3},
+			map[string]any{"name": "tags", "value": `["a", "b"]`, "type": "list", "variablesReference": 4},
+		},
+	})
+	c.WantResponse("variables", map[string]any{"variablesReference": 3}, map[string]any{
+		"variables": []any{
+			map[string]any{"name": "x", "value": "1", "type": "number", "variablesReference": 0},
+			map[string]any{"name": "y", "value": "2", "type": "number", "variablesReference": 0},
+		},
+	})
+	c.WantResponse("variables", map[string]any{"variablesReference": 4}, map[string]any{
+		"variables": []any{
+			map[string]any{"name": "[0]", "value": `"a"`, "type": "string", "variablesReference": 0},
+			map[string]any{"name": "[1]", "value": `"b"`, "type": "string", "variablesReference": 0},
+		},
+	})
+	c.WantResponse("variables", map[string]any{"variablesReference": 2}, map[string]any{
+		"variables": []any{
+			map[string]any{"name": "Point", "value": "[class Point]", "type": "class", "variablesReference": 0},
+			map[string]any{"name": "describe", "value": "[function describe]", "type": "function", "variablesReference": 0},
+			map[string]any{"name": "p", "value": "[Point object]", "type": "Point", "variablesReference": 5},
+		},
+	})
+
+	c.WantResponse("stackTrace", map[string]any{"threadId": 1}, map[string]any{
+		"stackFrames": []any{
+			map[string]any{"id": 1, "name": "describe", "source": source, "line": 9, "column": 3},
+			map[string]any{"id": 2, "name": "<script>", "source": source, "line": 14, "column": 7},
+		},
+		"totalFrames": 2,
+	})
+	c.WantResponse("scopes", map[string]any{"frameId": 2}, map[string]any{
+		"scopes": []any{
+			map[string]any{"name": "Globals", "variablesReference": 6, "expensive": false},
+		},
+	})
+
+	c.Request("next", map[string]any{"threadId": 1})
+	c.WantEvent("stopped", map[string]any{"reason": "step", "threadId": 1, "allThreadsStopped": true})
+	c.WantResponse("evaluate", map[string]any{"expression": "label + tags[1]", "frameId": 1}, map[string]any{
+		"result":             "pointb",
+		"variablesReference": 0,
+	})
+	c.WantError("evaluate", map[string]any{"expression": "missing", "frameId": 1}, "missing has not been declared")
+
+	c.WantResponse("continue", map[string]any{"threadId": 1}, map[string]any{"allThreadsContinued": true})
+	c.WantOutput("stdout", "point b\ndone\n")
+	c.WantEvent("exited", map[string]any{"exitCode": 0})
+	c.WantEvent("terminated", nil)
+	c.WantError("stackTrace", map[string]any{"threadId": 1}, "program is not paused")
+	c.Request("disconnect", nil)
+}
+
+// TestDAPExitCode tests that the debug adapter reports the same exit code for a program as the golox command does.
+func TestDAPExitCode(t *testing.T) {
+	testCases := []struct {
+		name         string
+		program      string
+		wantExitCode int
+	}{
+		{name: "success", program: "print 1;\n", wantExitCode: 0},
+		{name: "runtime error", program: "print nil + 1;\n", wantExitCode: 70},
+		{name: "exit", program: "exit(3);\n", wantExitCode: 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dap.lox")
+			if err := os.WriteFile(path, []byte(tc.program), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c := startDAP(t)
+			c.Request("initialize", map[string]any{"adapterID": "golox"})
+			c.WantEvent("initialized", nil)
+			c.Request("launch", map[string]any{"program": path, "noDebug": true})
+			c.Request("configurationDone", nil)
+			// Any output from the program is ignored.
+			msg := c.read()
+			for msg["type"] == "event" && msg["event"] == "output" {
+				msg = c.read()
+			}
+			wantMsg := normalise(map[string]any{
+				"type":  "event",
+				"event": "exited",
+				"body":  map[string]any{"exitCode": tc.wantExitCode},
+			})
+			delete(msg, "seq")
+			if diff := cmp.Diff(wantMsg, msg); diff != "" {
+				t.Errorf("incorrect exited event (-want +got):\n%s", diff)
+			}
+			c.WantEvent("terminated", nil)
+			c.Request("disconnect", nil)
+		})
+	}
+}
+
+// dapClient sends requests to a debug adapter and checks the responses and events that it sends back.
+type dapClient struct {
+	t   *testing.T
+	w   io.Writer
+	r   *textproto.Reader
+	seq int
+}
+
+func startDAP(t *testing.T) *dapClient {
+	cmd := exec.Command(*interpreter, "dap")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("debug adapter exited with error: %s", err)
+		}
+	})
+	return &dapClient{t: t, w: stdin, r: textproto.NewReader(bufio.NewReader(stdout))}
+}
+
+// Request sends a request and checks that it succeeded.
+func (c *dapClient) Request(command string, args any) {
+	c.t.Helper()
+	if resp := c.request(command, args); !resp["success"].(bool) {
+		c.t.Fatalf("%s request failed: %s", command, resp["message"])
+	}
+}
+
+// WantResponse sends a request and checks the body of its response.
+func (c *dapClient) WantResponse(command string, args any, wantBody map[string]any) {
+	c.t.Helper()
+	resp := c.request(command, args)
+	if !resp["success"].(bool) {
+		c.t.Fatalf("%s request failed: %s", command, resp["message"])
+	}
+	if diff := cmp.Diff(normalise(wantBody), resp["body"]); diff != "" {
+		c.t.Errorf("incorrect %s response body (-want +got):\n%s", command, diff)
+	}
+}
+
+// WantError sends a request and checks that it failed with the given message.
+func (c *dapClient) WantError(command string, args any, wantMessage string) {
+	c.t.Helper()
+	resp := c.request(command, args)
+	if resp["success"].(bool) {
+		c.t.Fatalf("%s request succeeded, want error %q", command, wantMessage)
+	}
+	if got := resp["message"]; got != wantMessage {
+		c.t.Errorf("%s request failed with message %q, want %q", command, got, wantMessage)
+	}
+}
+
+// WantEvent checks that the next message is an event with the given name and body.
+func (c *dapClient) WantEvent(name string, wantBody map[string]any) {
+	c.t.Helper()
+	msg := c.read()
+	if msg["type"] != "event" || msg["event"] != name {
+		c.t.Fatalf("got message %v, want %s event", msg, name)
+	}
+	var want any
+	if wantBody != nil {
+		want = normalise(wantBody)
+	}
+	if diff := cmp.Diff(want, msg["body"]); diff != "" {
+		c.t.Errorf("incorrect %s event body (-want +got):\n%s", name, diff)
+	}
+}
+
+// WantOutput checks that the next messages are output events in the given category which contain the given output.
+func (c *dapClient) WantOutput(category string, want string) {
+	c.t.Helper()
+	var got string
+	for len(got) < len(want) {
+		msg := c.read()
+		body, _ := msg["body"].(map[string]any)
+		if msg["type"] != "event" || msg["event"] != "output" || body["category"] != category {
+			c.t.Fatalf("got message %v, want %s output event", msg, category)
+		}
+		got += body["output"].(string)
+	}
+	if got != want {
+		c.t.Errorf("got %s output %q, want %q", category, got, want)
+	}
+}
+
+func (c *dapClient) request(command string, args any) map[string]any {
+	c.t.Helper()
+	c.seq++
+	req := map[string]any{"seq": c.seq, "type": "request", "command": command}
+	if args != nil {
+		req["arguments"] = args
+	}
+	content, err := json.Marshal(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		c.t.Fatal(err)
+	}
+	resp := c.read()
+	if resp["type"] != "response" || resp["command"] != command || resp["request_seq"] != float64(c.seq) {
+		c.t.Fatalf("got message %v, want response to %s request", resp, command)
+	}
+	return resp
+}
+
+func (c *dapClient) read() map[string]any {
+	c.t.Helper()
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("reading message header: %s", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatalf("reading message header: %s", err)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, content); err != nil {
+		c.t.Fatalf("reading message content: %s", err)
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(content, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// normalise round trips a value through JSON so that it can be compared with a decoded message.
+func normalise(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	var normalised any
+	if err := json.Unmarshal(data, &normalised); err != nil {
+		panic(err)
+	}
+	return normalised
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const debugProgram = `fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+
+fun twice(x) {
+  var y = add(x, x);
+  return y;
+}
+
+print twice(1);
+print twice(2);
+`
+
+// TestDebug tests the debugger by passing it commands on stdin and checking what it prints to stderr.
+func TestDebug(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "debug.lox"), []byte(debugProgram), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	commands := []string{
+		"break 2",
+		"continue",
+		"backtrace",
+		"print a + b",
+		"next",
+		"locals",
+		"out",
+		"print y * 10",
+		"step",
+		"clear 2",
+		"step",
+		"",
+		"frame 1",
+		"print x",
+		"continue",
+	}
+	cmd := exec.Command(*interpreter, "-debug", "debug.lox")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%s\nstderr:\n%s", err, stderr.String())
+	}
+
+	wantStdout := "2\n4\n"
+	if diff := cmp.Diff(wantStdout, string(stdout)); diff != "" {
+		t.Errorf("incorrect output printed to stdout (-want +got):\n%s", diff)
+	}
+	wantStderr := `Paused at debug.lox:1:1 (pause)
+    1 | fun add(a, b) {
+(debug) Breakpoint set at debug.lox:2
+(debug) Paused at debug.lox:2:3 (breakpoint)
+    2 |   var sum = a + b;
+(debug) * #0 add at debug.lox:2:3
+  #1 twice at debug.lox:7:11
+  #2 <script> at debug.lox:11:7
+(debug) 2
+(debug) Paused at debug.lox:3:3 (step)
+    3 |   return sum;
+(debug) Error: [class Error]
+add: [function add]
+args: [builtin function args]
+clock: [builtin function clock]
+exit: [builtin function exit]
+readLine: [builtin function readLine]
+twice: [function twice]
+type: [builtin function type]
+└──a: 1
+   b: 1
+   sum: 2
+(debug) Paused at debug.lox:8:3 (step)
+    8 |   return y;
+(debug) 20
+(debug) Paused at debug.lox:12:1 (step)
+   12 | print twice(2);
+(debug) Breakpoint cleared at debug.lox:2
+(debug) Paused at debug.lox:7:3 (step)
+    7 |   var y = add(x, x);
+(debug) Paused at debug.lox:2:3 (step)
+    2 |   var sum = a + b;
+(debug) #1 twice at debug.lox:7:11
+    7 |   var y = add(x, x);
+(debug) 2
+(debug) `
+	if diff := cmp.Diff(wantStderr, stderr.String()); diff != "" {
+		t.Errorf("incorrect output printed to stderr (-want +got):\n%s", diff)
+	}
+}
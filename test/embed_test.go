@@ -0,0 +1,537 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/marcuscaisey/lox/golox/ast"
+	golox "github.com/marcuscaisey/lox/golox/interpreter"
+	"github.com/marcuscaisey/lox/golox/lox"
+	"github.com/marcuscaisey/lox/golox/parser"
+)
+
+const embedProgram = `class Counter {
+  init(start) {
+    this.count = start;
+  }
+}
+
+fun describe(name, tags) {
+  return name + ": " + tags[0] + ", " + tags[1];
+}
+
+fun total(counts) {
+  return counts[0] + counts[1] + counts[2];
+}
+
+fun fail(message) {
+  throw Error(message);
+}
+
+fun failIndirectly(message) {
+  fail(message);
+}
+
+var greeting = prefix + " world";
+`
+
+// TestEmbed tests the API which is used to embed the interpreter in a Go program.
+func TestEmbed(t *testing.T) {
+	i := golox.New()
+	if err := i.SetGlobal("prefix", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	program, err := parser.Parse(strings.NewReader(embedProgram))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Interpret(program); err != nil {
+		t.Fatal(err)
+	}
+
+	greeting, ok := i.Global("greeting")
+	if !ok {
+		t.Fatal("greeting global is not defined")
+	}
+	if got, want := greeting.Interface(), "hello world"; got != want {
+		t.Errorf("greeting = %v, want %q", got, want)
+	}
+	if _, ok := i.Global("missing"); ok {
+		t.Error("missing global is defined")
+	}
+
+	describe := mustGlobal(t, i, "describe")
+	result, err := i.Call(describe, "lox", []string{"fast", "small"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.Interface(), "lox: fast, small"; got != want {
+		t.Errorf("describe() = %v, want %q", got, want)
+	}
+
+	result, err = i.Call(mustGlobal(t, i, "total"), []int{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.Interface(), 6.0; got != want {
+		t.Errorf("total() = %v, want %v", got, want)
+	}
+
+	counter, err := i.Call(mustGlobal(t, i, "Counter"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := counter.Type(), "Counter"; got != want {
+		t.Errorf("Counter().Type() = %q, want %q", got, want)
+	}
+	if err := i.SetGlobal("counter", counter); err != nil {
+		t.Fatal(err)
+	}
+	program, err = parser.Parse(strings.NewReader("var counts = {counter.count: [true, nil]};"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Interpret(program); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[any]any{5.0: []any{true, nil}}, mustGlobal(t, i, "counts").Interface()); diff != "" {
+		t.Errorf("incorrect value of counts (-want +got):\n%s", diff)
+	}
+
+	program, err = parser.Parse(strings.NewReader("var cycle = [1, nil]; cycle[1] = cycle; var cyclic = {1: cycle};"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Interpret(program); err != nil {
+		t.Fatal(err)
+	}
+	cyclic, ok := mustGlobal(t, i, "cyclic").Interface().(map[any]any)
+	if !ok {
+		t.Fatalf("cyclic.Interface() is not a map[any]any")
+	}
+	cycle, ok := cyclic[1.0].([]any)
+	if !ok || len(cycle) != 2 || cycle[0] != 1.0 {
+		t.Fatalf("cyclic[1].Interface() = %#v, want [1, cyclic[1]]", cyclic[1.0])
+	}
+	if inner, ok := cycle[1].([]any); !ok || &inner[0] != &cycle[0] {
+		t.Errorf("cyclic[1][1].Interface() is not cyclic[1].Interface()")
+	}
+
+	_, err = i.Call(mustGlobal(t, i, "fail"), "boom")
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("fail() returned error %v, want error containing %q", err, "boom")
+	}
+	_, err = i.Call(mustGlobal(t, i, "failIndirectly"), "boom")
+	if err == nil || !strings.Contains(err.Error(), "20:3: in failIndirectly") {
+		t.Errorf("failIndirectly() returned error %v, want error with traceback frame %q", err, "20:3: in failIndirectly")
+	}
+	if _, err := i.Call(describe, "lox"); err == nil || err.Error() != "describe() missing 1 argument: tags" {
+		t.Errorf("describe() with 1 argument returned error %v", err)
+	}
+	if _, err := i.Call(describe, "lox", nil, nil); err == nil || err.Error() != "describe() accepts 2 arguments but 3 were given" {
+		t.Errorf("describe() with 3 arguments returned error %v", err)
+	}
+	if _, err := i.Call(greeting); err == nil || err.Error() != "string object is not callable" {
+		t.Errorf("calling greeting returned error %v", err)
+	}
+	if _, err := golox.ValueOf(struct{}{}); err == nil || err.Error() != "cannot convert struct {} to a Lox value" {
+		t.Errorf("ValueOf(struct{}{}) returned error %v", err)
+	}
+}
+
+func mustGlobal(t *testing.T, i *golox.Interpreter, name string) golox.Value {
+	t.Helper()
+	value, ok := i.Global(name)
+	if !ok {
+		t.Fatalf("%s global is not defined", name)
+	}
+	return value
+}
+
+const nativeProgram = `import "strings" as strings;
+
+var joined = strings.join("-", "a", "b", "c");
+var repeated = strings.repeat("ab", 3);
+var caught;
+try {
+  strings.repeat("ab", -1);
+} catch (e) {
+  caught = [e.message, e.line, e.column];
+}
+strings.fail();
+`
+
+// TestNativeFunctions tests that functions implemented in Go can be registered with the interpreter and called from Lox.
+func TestNativeFunctions(t *testing.T) {
+	var calledWith []any
+	record := golox.NativeFunction{
+		Name:     "record",
+		Variadic: true,
+		Body: func(_ *golox.Interpreter, _ ast.CallExpr, args []golox.Value) (golox.Value, error) {
+			for _, arg := range args {
+				calledWith = append(calledWith, arg.Interface())
+			}
+			return golox.Value{}, nil
+		},
+	}
+	join := golox.NativeFunction{
+		Name:     "join",
+		Params:   []string{"sep"},
+		Variadic: true,
+		Body: func(_ *golox.Interpreter, _ ast.CallExpr, args []golox.Value) (golox.Value, error) {
+			parts := make([]string, len(args)-1)
+			for j, arg := range args[1:] {
+				parts[j] = arg.String()
+			}
+			return golox.ValueOf(strings.Join(parts, args[0].String()))
+		},
+	}
+	repeat := golox.NativeFunction{
+		Name:   "repeat",
+		Params: []string{"s", "n"},
+		Body: func(_ *golox.Interpreter, call ast.CallExpr, args []golox.Value) (golox.Value, error) {
+			n, ok := args[1].Interface().(float64)
+			if !ok || n < 0 {
+				return golox.Value{}, lox.NewErrorFromNode(call.Args[1], "n must be a non-negative number")
+			}
+			return golox.ValueOf(strings.Repeat(args[0].String(), int(n)))
+		},
+	}
+	fail := golox.NativeFunction{
+		Name: "fail",
+		Body: func(*golox.Interpreter, ast.CallExpr, []golox.Value) (golox.Value, error) {
+			return golox.Value{}, errors.New("something went wrong")
+		},
+	}
+	i := golox.New(golox.NativeFunctions(record, fail), golox.NativeModule("strings", join, repeat, fail))
+
+	program, err := parser.Parse(strings.NewReader(nativeProgram))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = i.Interpret(program)
+	var loxErr *lox.Error
+	if !errors.As(err, &loxErr) || loxErr.Message() != "something went wrong" || loxErr.Start().Line != 11 {
+		t.Errorf("Interpret returned error %v, want error from strings.fail() on line 11", err)
+	}
+	for name, want := range map[string]any{
+		"joined":   "a-b-c",
+		"repeated": "ababab",
+		"caught":   []any{"n must be a non-negative number", 7.0, 24.0},
+	} {
+		if diff := cmp.Diff(want, mustGlobal(t, i, name).Interface()); diff != "" {
+			t.Errorf("incorrect value of %s (-want +got):\n%s", name, diff)
+		}
+	}
+
+	program, err = parser.Parse(strings.NewReader(`record(1, "two", [nil]);`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Interpret(program); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]any{1.0, "two", []any{nil}}, calledWith); diff != "" {
+		t.Errorf("record() called with incorrect arguments (-want +got):\n%s", diff)
+	}
+
+	if _, err := i.Call(mustGlobal(t, i, "record")); err != nil {
+		t.Errorf("record() returned error %v", err)
+	}
+	if _, err := i.Call(mustGlobal(t, i, "fail")); err == nil || err.Error() != "something went wrong" {
+		t.Errorf("fail() returned error %v, want %q", err, "something went wrong")
+	}
+	if _, err := i.Call(mustGlobal(t, i, "record"), make(chan int)); err == nil {
+		t.Error("record() with a channel argument returned no error")
+	}
+}
+
+// TestStreams tests that the interpreter reads input from and writes output and diagnostics to the streams that it's
+// given.
+func TestStreams(t *testing.T) {
+	var stdout, stderr strings.Builder
+	warn := golox.NativeFunction{
+		Name:   "warn",
+		Params: []string{"msg"},
+		Body: func(i *golox.Interpreter, _ ast.CallExpr, args []golox.Value) (golox.Value, error) {
+			fmt.Fprintln(i.Stderr(), "warning: "+args[0].String())
+			return golox.Value{}, nil
+		},
+	}
+	i := golox.New(
+		golox.Stdout(&stdout),
+		golox.Stderr(&stderr),
+		golox.Stdin(strings.NewReader("Alice\nBob")),
+		golox.REPLMode(),
+		golox.NativeFunctions(warn),
+	)
+	program, err := parser.Parse(strings.NewReader(`print "name?";
+var name = readLine();
+print "hello " + name;
+readLine();
+readLine();
+warn("no more input");
+fun fail() {
+  nil.x;
+}
+fail();
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = i.Interpret(program)
+	if err == nil {
+		t.Fatal("Interpret returned no error")
+	}
+	fmt.Fprintln(i.Stderr(), err)
+	wantStdout := "name?\nhello Alice\nBob\nnil\nnil\n"
+	if diff := cmp.Diff(wantStdout, stdout.String()); diff != "" {
+		t.Errorf("incorrect stdout (-want +got):\n%s", diff)
+	}
+	wantStderr := "warning: no more input\n" + err.Error() + "\n"
+	if diff := cmp.Diff(wantStderr, stderr.String()); diff != "" {
+		t.Errorf("incorrect stderr (-want +got):\n%s", diff)
+	}
+	if !strings.Contains(stderr.String(), "10:1: in <script>") {
+		t.Errorf("stderr doesn't contain a traceback:\n%s", stderr.String())
+	}
+}
+
+// returnInFinallySrc is a program whose infinite loop is in a try statement with a finally block that returns.
+const returnInFinallySrc = `fun f() {
+  try {
+    while (true) {}
+  } finally {
+    return 1;
+  }
+}
+f();
+print "after";
+`
+
+// callForever is a native function which calls its argument until the call returns an error.
+var callForever = golox.NativeFunction{
+	Name:   "callForever",
+	Params: []string{"f"},
+	Body: func(i *golox.Interpreter, _ ast.CallExpr, args []golox.Value) (golox.Value, error) {
+		for {
+			if _, err := i.Call(args[0]); err != nil {
+				return golox.Value{}, err
+			}
+		}
+	},
+}
+
+// TestInterrupt tests that programs which run for too long are interrupted.
+func TestInterrupt(t *testing.T) {
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name        string
+		opts        []golox.Option
+		ctx         context.Context
+		cancelAfter time.Duration // if non-zero, ctx is cancelled after this long
+		src         string
+		wantErr     error
+		wantPos     string
+	}{
+		{
+			name:    "max statements in while loop",
+			opts:    []golox.Option{golox.MaxStatements(100)},
+			ctx:     context.Background(),
+			src:     "var i = 0;\nwhile (true) {\n  i = i + 1;\n}\n",
+			wantErr: golox.ErrMaxStatementsExceeded,
+			wantPos: "2:1",
+		},
+		{
+			name:    "max statements in recursive calls",
+			opts:    []golox.Option{golox.MaxStatements(100)},
+			ctx:     context.Background(),
+			src:     "fun f(n) {\n  if (n > 0) f(n - 1);\n}\nf(1000);\n",
+			wantErr: golox.ErrMaxStatementsExceeded,
+			wantPos: "2:14",
+		},
+		{
+			name:    "timeout in for loop",
+			opts:    []golox.Option{golox.Timeout(10 * time.Millisecond)},
+			ctx:     context.Background(),
+			src:     "for (;;) {}\n",
+			wantErr: context.DeadlineExceeded,
+			wantPos: "1:1",
+		},
+		{
+			name:    "cancelled context is not caught by try statement",
+			ctx:     cancelledCtx,
+			src:     "try {\n  while (true) {}\n} catch (e) {\n  print e;\n}\n",
+			wantErr: context.Canceled,
+			wantPos: "2:3",
+		},
+		{
+			name:    "max statements is not discarded by return in finally block",
+			opts:    []golox.Option{golox.MaxStatements(100)},
+			ctx:     context.Background(),
+			src:     returnInFinallySrc,
+			wantErr: golox.ErrMaxStatementsExceeded,
+			wantPos: "3:5",
+		},
+		{
+			name:    "timeout is not discarded by return in finally block",
+			opts:    []golox.Option{golox.Timeout(10 * time.Millisecond)},
+			ctx:     context.Background(),
+			src:     returnInFinallySrc,
+			wantErr: context.DeadlineExceeded,
+			wantPos: "3:5",
+		},
+		{
+			name:    "timeout in calls made by native function",
+			opts:    []golox.Option{golox.Timeout(10 * time.Millisecond), golox.NativeFunctions(callForever)},
+			ctx:     context.Background(),
+			src:     "fun f() {\n  1;\n}\ncallForever(f);\n",
+			wantErr: context.DeadlineExceeded,
+			wantPos: "4:1",
+		},
+		{
+			name:        "cancelled context is not discarded by return in finally block",
+			ctx:         context.Background(),
+			cancelAfter: 10 * time.Millisecond,
+			src:         returnInFinallySrc,
+			wantErr:     context.Canceled,
+			wantPos:     "3:5",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program, err := parser.Parse(strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := test.ctx
+			if test.cancelAfter > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				defer cancel()
+				time.AfterFunc(test.cancelAfter, cancel)
+			}
+			err = golox.New(test.opts...).InterpretContext(ctx, program)
+			var interruptedErr *golox.InterruptedError
+			if !errors.As(err, &interruptedErr) || !errors.Is(err, test.wantErr) {
+				t.Fatalf("InterpretContext returned error %v, want %T wrapping %v", err, interruptedErr, test.wantErr)
+			}
+			if got := interruptedErr.Pos.String(); got != test.wantPos {
+				t.Errorf("error position = %s, want %s", got, test.wantPos)
+			}
+		})
+	}
+}
+
+// TestMaxMemory tests that allocations which would exceed the memory limit raise a runtime error.
+func TestMaxMemory(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		stdin   string
+		wantPos string
+	}{
+		{
+			name:    "string multiplication",
+			src:     "var s = \"x\" * 1000000000;\n",
+			wantPos: "1:9",
+		},
+		{
+			name:    "string concatenation",
+			src:     "var s = \"x\";\nwhile (true) {\n  s = s + s;\n}\n",
+			wantPos: "3:7",
+		},
+		{
+			name:    "instances",
+			src:     "class A {}\nvar a;\nwhile (true) a = A();\n",
+			wantPos: "3:18",
+		},
+		{
+			name:    "closures",
+			src:     "var f;\nwhile (true) {\n  f = fun() {};\n}\n",
+			wantPos: "3:7",
+		},
+		{
+			name:    "list literals",
+			src:     "var xs;\nwhile (true) xs = [1, 2, 3];\n",
+			wantPos: "2:19",
+		},
+		{
+			name:    "list concatenation",
+			src:     "var xs = [1];\nwhile (true) {\n  xs = xs + xs;\n}\n",
+			wantPos: "3:8",
+		},
+		{
+			name:    "list slicing",
+			src:     "var xs = [1, 2, 3];\nvar ys;\nwhile (true) {\n  ys = xs[:];\n}\n",
+			wantPos: "4:8",
+		},
+		{
+			name:    "map literals",
+			src:     "var m;\nwhile (true) {\n  m = {};\n}\n",
+			wantPos: "3:7",
+		},
+		{
+			name:    "map entries",
+			src:     "var m = {};\nvar i = 0;\nwhile (true) {\n  m[i] = i;\n  i = i + 1;\n}\n",
+			wantPos: "4:5",
+		},
+		{
+			name:    "readLine",
+			src:     "var s = readLine();\n",
+			stdin:   strings.Repeat("x", 1<<20) + "\n",
+			wantPos: "1:9",
+		},
+		{
+			name:    "string interpolation",
+			src:     "var s = \"x\" * 1000000;\nvar t = \"${s}${s}\";\n",
+			wantPos: "2:9",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program, err := parser.Parse(strings.NewReader(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = golox.New(golox.MaxMemory(1<<20), golox.Stdin(strings.NewReader(test.stdin))).Interpret(program)
+			var loxErr *lox.Error
+			if !errors.As(err, &loxErr) || loxErr.Message() != "memory limit of 1048576 bytes exceeded" {
+				t.Fatalf("Interpret returned error %v, want memory limit error", err)
+			}
+			if got := loxErr.Start().String(); got != test.wantPos {
+				t.Errorf("error position = %s, want %s", got, test.wantPos)
+			}
+		})
+	}
+}
+
+// TestMaxMemoryCaught tests that exceeding the memory limit raises an error which can be caught and that the program
+// can carry on afterwards.
+func TestMaxMemoryCaught(t *testing.T) {
+	program, err := parser.Parse(strings.NewReader(`try {
+  print "x" * 1000000000;
+} catch (e) {
+  print "${e.line}:${e.column}: ${e.message}";
+}
+print "after";
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout strings.Builder
+	if err := golox.New(golox.MaxMemory(1<<20), golox.Stdout(&stdout)).Interpret(program); err != nil {
+		t.Fatalf("Interpret returned error %v", err)
+	}
+	want := "2:9: memory limit of 1048576 bytes exceeded\nafter\n"
+	if diff := cmp.Diff(want, stdout.String()); diff != "" {
+		t.Errorf("incorrect output (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,163 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestFormat tests that formatting each of the test programs is idempotent, preserves their comments, and doesn't
+// change their AST.
+func TestFormat(t *testing.T) {
+	err := filepath.WalkDir("testdata", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".lox" {
+			return nil
+		}
+		t.Run(filepath.ToSlash(path), func(t *testing.T) {
+			t.Parallel()
+			testFormat(t, path)
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testFormat(t *testing.T, path string) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAST, err := runGolox(nil, "-p", path)
+	if err != nil {
+		t.Skip("program doesn't parse")
+	}
+
+	formatted, err := runGolox(nil, "fmt", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reformatted, err := runGolox(formatted, "fmt")
+	if err != nil {
+		t.Fatalf("formatted program doesn't parse: %s\n%s", err, formatted)
+	}
+	if !bytes.Equal(formatted, reformatted) {
+		t.Errorf("formatting is not idempotent:\n%s", cmp.Diff(string(formatted), string(reformatted)))
+	}
+
+	gotAST, err := runGolox(nil, "-p", "-c", string(formatted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wantAST, gotAST) {
+		t.Errorf("formatting changed the AST:\n%s", cmp.Diff(string(wantAST), string(gotAST)))
+	}
+
+	// Comment delimiters can also appear in string literals, but those are printed unchanged so the count is still the
+	// same if all of the comments have been preserved.
+	for _, delim := range []string{"//", "/*"} {
+		if want, got := bytes.Count(src, []byte(delim)), bytes.Count(formatted, []byte(delim)); got != want {
+			t.Errorf("formatted program contains %d %q, want %d:\n%s", got, delim, want, formatted)
+		}
+	}
+}
+
+// TestFormatComments tests that comments are printed in the same place relative to the code around them.
+func TestFormatComments(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "between statements on the same line",
+			src:  "fun g() { print 1; /* y */ print 2; }\n",
+			want: "fun g() {\n  print 1; /* y */\n  print 2;\n}\n",
+		},
+		{
+			name: "between statements on their own line",
+			src:  "print 1;\n// x\n\n/* y */ print 2;\n",
+			want: "print 1;\n// x\n\n/* y */ print 2;\n",
+		},
+		{
+			name: "between methods",
+			src:  "class A { m() {} /* x */ n() {} }\n",
+			want: "class A {\n  m() {} /* x */\n  n() {}\n}\n",
+		},
+		{
+			name: "between methods on their own line",
+			src:  "class A {\n  m() {}\n  // x\n  n() {}\n}\n",
+			want: "class A {\n  m() {}\n  // x\n  n() {}\n}\n",
+		},
+		{
+			name: "line comment before else",
+			src:  "if (true) {\n  print 1;\n} // c\nelse {\n  print 2;\n}\n",
+			want: "if (true) {\n  print 1;\n} // c\nelse {\n  print 2;\n}\n",
+		},
+		{
+			name: "block comment before else",
+			src:  "if (true) { print 1; } /* c */ else { print 2; }\n",
+			want: "if (true) {\n  print 1;\n} /* c */ else {\n  print 2;\n}\n",
+		},
+		{
+			name: "comment on its own line before else",
+			src:  "if (true) { print 1; }\n// c\nelse if (false) print 2; // d\nelse print 3;\n",
+			want: "if (true) {\n  print 1;\n}\n// c\nelse if (false)\n  print 2; // d\nelse\n  print 3;\n",
+		},
+		{
+			name: "before comma",
+			src:  "f(2 /* inline */, 3);\n",
+			want: "f(2 /* inline */, 3);\n",
+		},
+		{
+			name: "before closing parenthesis",
+			src:  "f(2 /* x */ /* y */) ;\n",
+			want: "f(2 /* x */ /* y */);\n",
+		},
+		{
+			name: "before semicolon",
+			src:  "var x = 1 /* c */;\n",
+			want: "var x = 1 /* c */;\n",
+		},
+		{
+			name: "after comma",
+			src:  "f(2, /* inline */ 3);\n",
+			want: "f(2, /* inline */ 3);\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := runGolox([]byte(tc.src), "fmt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("incorrect formatted program (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// runGolox runs the interpreter with the given arguments and stdin and returns its stdout. If the interpreter exits
+// with a non-zero exit code, then an error containing its stderr is returned.
+func runGolox(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command(*interpreter, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stdout, err := cmd.Output()
+	if exitErr := (&exec.ExitError{}); errors.As(err, &exitErr) {
+		return nil, errors.New(string(bytes.TrimSpace(exitErr.Stderr)))
+	}
+	return stdout, err
+}
@@ -9,6 +9,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"unicode"
@@ -19,13 +21,21 @@ import (
 )
 
 var (
-	interpreter = flag.String("interpreter", "", "path to the interpreter to test")
-	update      = flag.Bool("update", false, "updates the expected output of each test")
+	interpreter     = flag.String("interpreter", "", "path to the interpreter to test")
+	interpreterArgs = flag.String("interpreter-args", "", "space-separated flags to pass to the interpreter")
+	update          = flag.Bool("update", false, "updates the expected output of each test")
 
-	printsRe = regexp.MustCompile(`// prints: (.+)`)
-	errorRe  = regexp.MustCompile(`// error: (.+)`)
+	printsRe    = regexp.MustCompile(`// prints: (.+)`)
+	errorRe     = regexp.MustCompile(`// error: (.+)`)
+	tracebackRe = regexp.MustCompile(`// traceback: (.+)`)
+	exitCodeRe  = regexp.MustCompile(`// exit code: (\d+)`)
+
+	tracebackFrameRe = regexp.MustCompile(`(?m)^  .+:(\d+:\d+: in .+)$`)
 )
 
+// exitRuntimeError is the exit code of the interpreter when a runtime error occurs (EX_SOFTWARE from sysexits.h).
+const exitRuntimeError = 70
+
 func TestMain(m *testing.M) {
 	flag.Parse()
 	if *interpreter == "" {
@@ -79,10 +89,11 @@ func snakeToPascalCase(s string) string {
 }
 
 type result struct {
-	Stdout   []byte
-	Stderr   []byte
-	Errors   [][]byte
-	ExitCode int
+	Stdout    []byte
+	Stderr    []byte
+	Errors    [][]byte
+	Traceback [][]byte
+	ExitCode  int
 }
 
 func runTest(t *testing.T, path string) {
@@ -104,15 +115,21 @@ func runTest(t *testing.T, path string) {
 		t.Errorf("incorrect errors printed to stderr:\n%s", computeDiff(want.Errors, got.Errors))
 		t.Errorf("stderr:\n%s", got.Stderr)
 	}
+
+	if !cmp.Equal(want.Traceback, got.Traceback) {
+		t.Errorf("incorrect traceback printed to stderr:\n%s", computeDiff(want.Traceback, got.Traceback))
+		t.Errorf("stderr:\n%s", got.Stderr)
+	}
 }
 
 func runInterpreter(t *testing.T, path string) result {
-	cmd := exec.Command(*interpreter, path)
+	flags := strings.Fields(*interpreterArgs)
+	cmd := exec.Command(*interpreter, append(flags, path)...)
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Logf("%s %s", *interpreter, absPath)
+	t.Log(strings.Join(slices.Concat([]string{*interpreter}, flags, []string{absPath}), " "))
 
 	stdout, err := cmd.Output()
 
@@ -125,12 +142,17 @@ func runInterpreter(t *testing.T, path string) result {
 	for _, match := range errorRe.FindAllSubmatch(exitErr.Stderr, -1) {
 		errors = append(errors, match[1])
 	}
+	var traceback [][]byte
+	for _, match := range tracebackFrameRe.FindAllSubmatch(exitErr.Stderr, -1) {
+		traceback = append(traceback, match[1])
+	}
 
 	return result{
-		Stdout:   stdout,
-		Stderr:   exitErr.Stderr,
-		Errors:   errors,
-		ExitCode: cmd.ProcessState.ExitCode(),
+		Stdout:    stdout,
+		Stderr:    exitErr.Stderr,
+		Errors:    errors,
+		Traceback: traceback,
+		ExitCode:  cmd.ProcessState.ExitCode(),
 	}
 }
 
@@ -157,19 +179,34 @@ func parseExpectedResult(t *testing.T, path string) result {
 		t.Fatal(err)
 	}
 
-	errors := parseExpectedErrors(data)
+	errors := parseExpectedComments(data, errorRe)
 
 	r := result{
-		Stdout: parseExpectedStdout(data),
-		Errors: errors,
+		Stdout:    parseExpectedStdout(data),
+		Errors:    errors,
+		Traceback: parseExpectedComments(data, tracebackRe),
 	}
-	if len(r.Errors) > 0 {
-		r.ExitCode = 1
+	if match := exitCodeRe.FindSubmatch(data); match != nil {
+		r.ExitCode, err = strconv.Atoi(string(match[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		r.ExitCode = impliedExitCode(r.Errors)
 	}
 
 	return r
 }
 
+// impliedExitCode returns the exit code which is expected when there's no "// exit code:" comment. Errors are assumed
+// to be runtime errors.
+func impliedExitCode(errors [][]byte) int {
+	if len(errors) > 0 {
+		return exitRuntimeError
+	}
+	return 0
+}
+
 func parseExpectedStdout(data []byte) []byte {
 	var b bytes.Buffer
 	for _, match := range printsRe.FindAllSubmatch(data, -1) {
@@ -181,12 +218,12 @@ func parseExpectedStdout(data []byte) []byte {
 	return b.Bytes()
 }
 
-func parseExpectedErrors(data []byte) [][]byte {
-	var errors [][]byte
-	for _, match := range errorRe.FindAllSubmatch(data, -1) {
-		errors = append(errors, match[1])
+func parseExpectedComments(data []byte, re *regexp.Regexp) [][]byte {
+	var values [][]byte
+	for _, match := range re.FindAllSubmatch(data, -1) {
+		values = append(values, match[1])
 	}
-	return errors
+	return values
 }
 
 func updateExpectedOutput(t *testing.T, path string) {
@@ -207,6 +244,9 @@ func updateExpectedOutput(t *testing.T, path string) {
 		} else {
 			t.Logf("errors: <empty>")
 		}
+		if len(result.Traceback) > 0 {
+			t.Logf("traceback:\n%s", bytes.Join(result.Traceback, []byte("\n")))
+		}
 	} else {
 		t.Logf("stderr: <empty>")
 	}
@@ -217,7 +257,14 @@ func updateExpectedOutput(t *testing.T, path string) {
 	}
 
 	data = updateExpectedStdout(t, path, data, result.Stdout)
-	data = updateExpectedErrors(t, path, data, result.Errors)
+	data = updateExpectedComments(t, path, data, errorRe, "error", "error", result.Errors)
+	data = updateExpectedComments(t, path, data, tracebackRe, "traceback", "traceback frame", result.Traceback)
+	if exitCodeRe.Match(data) {
+		exitCode := [][]byte{[]byte(strconv.Itoa(result.ExitCode))}
+		data = updateExpectedComments(t, path, data, exitCodeRe, "exit code", "exit code", exitCode)
+	} else if wantExitCode := impliedExitCode(result.Errors); result.ExitCode != wantExitCode {
+		t.Fatalf(`interpreter exited with code %d, add an "// exit code: %[1]d" comment to %s`, result.ExitCode, path)
+	}
 
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		t.Fatal(err)
@@ -255,13 +302,17 @@ func updateExpectedStdout(t *testing.T, path string, data []byte, stdout []byte)
 	return b.Bytes()
 }
 
-func updateExpectedErrors(t *testing.T, path string, data []byte, errors [][]byte) []byte {
-	matches := errorRe.FindAllSubmatchIndex(data, -1)
-	if len(errors) != len(matches) {
-		t.Fatalf(`%d "// error:" %s found in %s but %d %s printed to stderr, these should be equal`,
-			len(matches), pluralise("comment", len(matches)), path, len(errors), pluralise("error", len(errors)))
+// updateExpectedComments replaces the values of the "// <label>:" comments matched by re with the given values. noun
+// describes what each value is, such as "error".
+func updateExpectedComments(
+	t *testing.T, path string, data []byte, re *regexp.Regexp, label string, noun string, values [][]byte,
+) []byte {
+	matches := re.FindAllSubmatchIndex(data, -1)
+	if len(values) != len(matches) {
+		t.Fatalf(`%d "// %s:" %s found in %s but %d %s printed to stderr, these should be equal`,
+			len(matches), label, pluralise("comment", len(matches)), path, len(values), pluralise(noun, len(values)))
 	}
-	if len(errors) == 0 {
+	if len(values) == 0 {
 		return data
 	}
 
@@ -270,7 +321,7 @@ func updateExpectedErrors(t *testing.T, path string, data []byte, errors [][]byt
 	for i, match := range matches {
 		start, end := match[2], match[3]
 		b.Write(data[lastEnd:start])
-		b.Write(errors[i])
+		b.Write(values[i])
 		lastEnd = end
 	}
 	b.Write(data[lastEnd:])
@@ -0,0 +1,320 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const lspURI = "file:///tmp/lsp.lox"
+
+const lspProgram = `fun add(x, y) {
+  return x + y;
+}
+
+class Counter {
+  init(start) {
+    this.count = start;
+  }
+
+  increment() {
+    this.count = this.count + 1;
+  }
+}
+
+var emoji = "😀"; print emoji;
+print add(1, 2);
+`
+
+// lspSyntaxErrorProgram contains a syntax error.
+const lspSyntaxErrorProgram = `fun add(x, y) {
+  return x +;
+}
+
+print add(1, 2);
+`
+
+// lspResolverErrorProgram parses but contains an error which is reported by the resolver.
+const lspResolverErrorProgram = `{
+  var unused = 1;
+}
+`
+
+// TestLSP tests the language server by sending it requests over stdin and checking the responses and notifications
+// that it writes to stdout.
+func TestLSP(t *testing.T) {
+	c := startLSP(t)
+	textDocument := map[string]any{"uri": lspURI}
+
+	c.Request("initialize", map[string]any{"capabilities": map[string]any{}})
+	c.Notify("initialized", map[string]any{})
+	c.Notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": lspURI, "languageId": "lox", "version": 1, "text": lspProgram},
+	})
+	c.WantDiagnostics(lspURI, []any{})
+
+	c.WantResponse("textDocument/definition", map[string]any{
+		"textDocument": textDocument,
+		"position":     lspPosition(15, 7),
+	}, map[string]any{"uri": lspURI, "range": lspRange(0, 4, 0, 7)})
+	c.WantResponse("textDocument/definition", map[string]any{
+		"textDocument": textDocument,
+		"position":     lspPosition(3, 0),
+	}, nil)
+
+	c.WantResponse("textDocument/references", map[string]any{
+		"textDocument": textDocument,
+		"position":     lspPosition(0, 8),
+		"context":      map[string]any{"includeDeclaration": true},
+	}, []any{
+		map[string]any{"uri": lspURI, "range": lspRange(0, 8, 0, 9)},
+		map[string]any{"uri": lspURI, "range": lspRange(1, 9, 1, 10)},
+	})
+	c.WantResponse("textDocument/references", map[string]any{
+		"textDocument": textDocument,
+		"position":     lspPosition(0, 8),
+		"context":      map[string]any{"includeDeclaration": false},
+	}, []any{
+		map[string]any{"uri": lspURI, "range": lspRange(1, 9, 1, 10)},
+	})
+
+	// Positions are measured in UTF-16 code units. The emoji is 4 bytes in UTF-8 but 2 code units in UTF-16, so the
+	// second emoji identifier starts at character 24 but byte 26.
+	c.WantResponse("textDocument/references", map[string]any{
+		"textDocument": textDocument,
+		"position":     lspPosition(14, 24),
+		"context":      map[string]any{"includeDeclaration": true},
+	}, []any{
+		map[string]any{"uri": lspURI, "range": lspRange(14, 4, 14, 9)},
+		map[string]any{"uri": lspURI, "range": lspRange(14, 24, 14, 29)},
+	})
+
+	c.WantResponse("textDocument/hover", map[string]any{
+		"textDocument": textDocument,
+		"position":     lspPosition(15, 8),
+	}, map[string]any{
+		"contents": map[string]any{"kind": "markdown", "value": "```lox\n(function) add(x, y)\n```"},
+		"range":    lspRange(15, 6, 15, 9),
+	})
+	c.WantResponse("textDocument/hover", map[string]any{
+		"textDocument": textDocument,
+		"position":     lspPosition(4, 8),
+	}, map[string]any{
+		"contents": map[string]any{"kind": "markdown", "value": "```lox\n(class) Counter\n```"},
+		"range":    lspRange(4, 6, 4, 13),
+	})
+
+	c.WantResponse("textDocument/documentSymbol", map[string]any{"textDocument": textDocument}, []any{
+		map[string]any{
+			"name":           "add",
+			"detail":         "(x, y)",
+			"kind":           12,
+			"range":          lspRange(0, 0, 2, 1),
+			"selectionRange": lspRange(0, 4, 0, 7),
+		},
+		map[string]any{
+			"name":           "Counter",
+			"kind":           5,
+			"range":          lspRange(4, 0, 12, 1),
+			"selectionRange": lspRange(4, 6, 4, 13),
+			"children": []any{
+				map[string]any{
+					"name":           "init",
+					"detail":         "(start)",
+					"kind":           6,
+					"range":          lspRange(5, 2, 7, 3),
+					"selectionRange": lspRange(5, 2, 5, 6),
+				},
+				map[string]any{
+					"name":           "increment",
+					"detail":         "()",
+					"kind":           6,
+					"range":          lspRange(9, 2, 11, 3),
+					"selectionRange": lspRange(9, 2, 9, 11),
+				},
+			},
+		},
+	})
+
+	// Identifiers can still be navigated in a document which doesn't parse.
+	c.Notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": lspURI, "version": 2},
+		"contentChanges": []any{map[string]any{"text": lspSyntaxErrorProgram}},
+	})
+	c.WantDiagnostics(lspURI, []any{
+		map[string]any{
+			"range":    lspRange(1, 12, 1, 13),
+			"severity": 1,
+			"source":   "golox",
+			"message":  "expected expression",
+		},
+	})
+	c.WantResponse("textDocument/definition", map[string]any{
+		"textDocument": textDocument,
+		"position":     lspPosition(4, 7),
+	}, map[string]any{"uri": lspURI, "range": lspRange(0, 4, 0, 7)})
+
+	c.Notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": lspURI, "version": 3},
+		"contentChanges": []any{map[string]any{"text": lspResolverErrorProgram}},
+	})
+	c.WantDiagnostics(lspURI, []any{
+		map[string]any{
+			"range":    lspRange(1, 6, 1, 12),
+			"severity": 1,
+			"source":   "golox",
+			"message":  "unused has been declared but is never used",
+		},
+	})
+
+	c.Notify("textDocument/didClose", map[string]any{"textDocument": textDocument})
+	c.WantDiagnostics(lspURI, []any{})
+	c.WantError("textDocument/hover", map[string]any{
+		"textDocument": textDocument,
+		"position":     lspPosition(0, 0),
+	}, "document has not been opened: "+lspURI)
+	c.Request("shutdown", nil)
+	c.Notify("exit", nil)
+}
+
+func lspPosition(line, character int) map[string]any {
+	return map[string]any{"line": line, "character": character}
+}
+
+func lspRange(startLine, startCharacter, endLine, endCharacter int) map[string]any {
+	return map[string]any{"start": lspPosition(startLine, startCharacter), "end": lspPosition(endLine, endCharacter)}
+}
+
+// lspClient sends requests and notifications to a language server and checks the messages that it sends back.
+type lspClient struct {
+	t  *testing.T
+	w  io.Writer
+	r  *textproto.Reader
+	id int
+}
+
+func startLSP(t *testing.T) *lspClient {
+	cmd := exec.Command(*interpreter, "lsp")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("language server exited with error: %s", err)
+		}
+	})
+	return &lspClient{t: t, w: stdin, r: textproto.NewReader(bufio.NewReader(stdout))}
+}
+
+// Request sends a request and checks that it succeeded.
+func (c *lspClient) Request(method string, params any) {
+	c.t.Helper()
+	if resp := c.request(method, params); resp["error"] != nil {
+		c.t.Fatalf("%s request failed: %v", method, resp["error"])
+	}
+}
+
+// WantResponse sends a request and checks its result.
+func (c *lspClient) WantResponse(method string, params any, wantResult any) {
+	c.t.Helper()
+	resp := c.request(method, params)
+	if resp["error"] != nil {
+		c.t.Fatalf("%s request failed: %v", method, resp["error"])
+	}
+	if diff := cmp.Diff(normalise(wantResult), resp["result"]); diff != "" {
+		c.t.Errorf("incorrect %s result (-want +got):\n%s", method, diff)
+	}
+}
+
+// WantError sends a request and checks that it failed with the given message.
+func (c *lspClient) WantError(method string, params any, wantMessage string) {
+	c.t.Helper()
+	resp := c.request(method, params)
+	respErr, ok := resp["error"].(map[string]any)
+	if !ok {
+		c.t.Fatalf("%s request succeeded, want error %q", method, wantMessage)
+	}
+	if got := respErr["message"]; got != wantMessage {
+		c.t.Errorf("%s request failed with message %q, want %q", method, got, wantMessage)
+	}
+}
+
+// Notify sends a notification.
+func (c *lspClient) Notify(method string, params any) {
+	c.t.Helper()
+	c.write(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// WantDiagnostics checks that the next message publishes the given diagnostics for a document.
+func (c *lspClient) WantDiagnostics(uri string, want []any) {
+	c.t.Helper()
+	msg := c.read()
+	if msg["method"] != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("got message %v, want textDocument/publishDiagnostics notification", msg)
+	}
+	wantParams := map[string]any{"uri": uri, "diagnostics": want}
+	if diff := cmp.Diff(normalise(wantParams), msg["params"]); diff != "" {
+		c.t.Errorf("incorrect diagnostics (-want +got):\n%s", diff)
+	}
+}
+
+func (c *lspClient) request(method string, params any) map[string]any {
+	c.t.Helper()
+	c.id++
+	c.write(map[string]any{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	resp := c.read()
+	if _, ok := resp["method"]; ok || resp["id"] != float64(c.id) {
+		c.t.Fatalf("got message %v, want response to %s request", resp, method)
+	}
+	return resp
+}
+
+func (c *lspClient) write(msg map[string]any) {
+	c.t.Helper()
+	content, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *lspClient) read() map[string]any {
+	c.t.Helper()
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("reading message header: %s", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatalf("reading message header: %s", err)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, content); err != nil {
+		c.t.Fatalf("reading message content: %s", err)
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(content, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
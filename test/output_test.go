@@ -0,0 +1,38 @@
+package test
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestOutputNotHeldBack tests that each line of output is written as soon as it's printed, so that it's displayed
+// before a program which runs forever is interrupted.
+func TestOutputNotHeldBack(t *testing.T) {
+	src := "print \"started\"; while (true) {}"
+	cmd := exec.Command(*interpreter, append(strings.Fields(*interpreterArgs), "-c", src)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Signal(syscall.SIGINT)
+		_ = cmd.Wait()
+	})
+	lines := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	wantLines(t, lines, "started")
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestREPL tests the REPL by passing it input on stdin and checking what it prints to stdout and stderr.
+func TestREPL(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lib.lox"), []byte("fun double(x) {\n  return x * 2;\n}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	input := []string{
+		"fun add(a, b) {",
+		"  return a + b;",
+		"}",
+		"print add(1,",
+		"  2);",
+		"var xs = [1, 2]",
+		";",
+		"print 1",
+		"",
+		":type xs",
+		":type add(1, 2)",
+		":ast print -1;",
+		":load lib.lox",
+		"double(4);",
+		":reset",
+		":env",
+		"add;",
+		":unknown",
+	}
+
+	for _, args := range [][]string{nil, {"-vm"}} {
+		t.Run(strings.Join(append([]string{"args"}, args...), " "), func(t *testing.T) {
+			cmd := exec.Command(*interpreter, args...)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "HOME="+t.TempDir())
+			cmd.Stdin = strings.NewReader(strings.Join(input, "\n") + "\n")
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			stdout, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("%s\nstderr:\n%s", err, stderr.String())
+			}
+
+			wantStdout := `3
+list
+number
+(Program
+  (PrintStmt
+    (UnaryExpr
+      Op: -
+      Right: 1)))
+8
+Error: [class Error]
+args: [builtin function args]
+clock: [builtin function clock]
+exit: [builtin function exit]
+readLine: [builtin function readLine]
+type: [builtin function type]
+`
+			if diff := cmp.Diff(wantStdout, string(stdout)); diff != "" {
+				t.Errorf("incorrect output printed to stdout (-want +got):\n%s", diff)
+			}
+			wantStderr := `Welcome to the Lox REPL. Type :help for a list of commands or press Ctrl-D to exit.
+1:8: error: expected ';'
+print 1
+1:1: error: add has not been declared
+add;
+~~~
+unknown command :unknown, type :help for a list of commands
+`
+			if diff := cmp.Diff(wantStderr, stderr.String()); diff != "" {
+				t.Errorf("incorrect output printed to stderr (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
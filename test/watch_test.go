@@ -0,0 +1,87 @@
+package test
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const watchingMessage = "Watching for changes. Press Ctrl-C to exit."
+
+// TestWatch tests that the -watch flag runs the script again when it or a module that it imports changes, even if it
+// hasn't finished running.
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "main.lox")
+	libPath := filepath.Join(dir, "lib.lox")
+	writeFile(t, mainPath, "import \"lib.lox\" as lib;\nprint lib.x;\n")
+	writeFile(t, libPath, "var x = 1;\n")
+
+	cmd := exec.Command(*interpreter, append(strings.Fields(*interpreterArgs), "-watch", mainPath)...)
+	r, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		w.Close()
+	})
+	lines := make(chan string, 100)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	wantLines(t, lines, "1", watchingMessage)
+	writeFile(t, libPath, "var x = 2;\n")
+	wantLines(t, lines, "2", watchingMessage)
+	writeFile(t, libPath, "var x = ;\n")
+	wantLines(t, lines, "lib.lox:1:9: error: expected expression", "var x = ;", "        ~", watchingMessage)
+	writeFile(t, mainPath, "print \"main\";\n")
+	wantLines(t, lines, "main", watchingMessage)
+	// A script which never finishes is stopped and run again when it changes.
+	writeFile(t, mainPath, "print \"looping\";\nwhile (true) {}\n")
+	wantLines(t, lines, "looping")
+	writeFile(t, mainPath, "print \"stopped\";\n")
+	wantLines(t, lines, "stopped", watchingMessage)
+}
+
+func writeFile(t *testing.T, path string, src string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wantLines checks that the next lines which are output are the wanted ones. Any text before the last path separator
+// is removed from each line, so that errors can be compared without the temporary directory that they refer to.
+func wantLines(t *testing.T, lines <-chan string, want ...string) {
+	t.Helper()
+	for _, wantLine := range want {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("output ended, want %q", wantLine)
+			}
+			if i := strings.LastIndex(line, string(filepath.Separator)); i != -1 {
+				line = line[i+1:]
+			}
+			if line != wantLine {
+				t.Fatalf("output line = %q, want %q", line, wantLine)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for output line %q", wantLine)
+		}
+	}
+}
@@ -25,7 +25,7 @@
 (call_expression
   callee: (identifier) @function.call)
 
-((identifier) @function.builtin (#any-of? @function.builtin "clock" "type"))
+((identifier) @function.builtin (#any-of? @function.builtin "clock" "type" "readLine" "args" "exit"))
 
 (method_declaration
   name: (identifier) @function.method)